@@ -0,0 +1,414 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"freenet/internal/configs"
+	"freenet/internal/keys"
+	"freenet/internal/services"
+
+	"github.com/urfave/cli/v2"
+)
+
+// insertCommand inserts a file into the network and prints the key it was inserted under.
+func insertCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "insert",
+		Usage:     "insert a file into the network and print its key",
+		ArgsUsage: " <file>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "key",
+				Usage: "key to insert the file under (default: the CHK of the file)",
+			},
+			&cli.StringFlag{
+				Name:  "keypair",
+				Usage: "key pair file to sign the file with, inserting it under an SSK",
+			},
+			&cli.StringFlag{
+				Name:  "name",
+				Usage: "document name of the SSK (default: the name of the file)",
+			},
+			&cli.Int64Flag{
+				Name:  "edition",
+				Usage: "insert the signed file as this edition of an updatable key (USK)",
+			},
+		},
+		Action: func(cCtx *cli.Context) error {
+			if cCtx.NArg() != 1 {
+				fmt.Fprintf(originalStderr, "Error: insert expects exactly one file path\n")
+
+				return fmt.Errorf("insert expects exactly one file path, got %d arguments", cCtx.NArg())
+			}
+
+			data, err := os.ReadFile(cCtx.Args().First())
+			if err != nil {
+				fmt.Fprintf(originalStderr, "Error: %v\n", err)
+
+				return fmt.Errorf("failed to read file: %v", err)
+			}
+
+			// Start the service client to reach the network.
+			if err := services.Client.Start(cCtx.Context); err != nil {
+				fmt.Fprintf(originalStderr, "Error: %v\n", err)
+
+				return fmt.Errorf("failed to start listening: %v", err)
+			}
+
+			if cCtx.IsSet("edition") && cCtx.String("keypair") == "" {
+				fmt.Fprintf(originalStderr, "Error: --edition requires --keypair\n")
+
+				return fmt.Errorf("--edition requires --keypair")
+			}
+
+			var result services.Result
+			if cCtx.String("keypair") != "" {
+				// Sign the file and insert it in the subspace of the key pair
+				keyPair, err := keys.LoadKeyPair(cCtx.String("keypair"))
+				if err != nil {
+					fmt.Fprintf(originalStderr, "Error: %v\n", err)
+
+					return fmt.Errorf("failed to load key pair: %v", err)
+				}
+
+				docName := cCtx.String("name")
+				if docName == "" {
+					docName = filepath.Base(cCtx.Args().First())
+				}
+				if cCtx.IsSet("edition") {
+					result, err = services.Client.InsertEdition(cCtx.Context, keyPair, docName, cCtx.Int64("edition"), data)
+				} else {
+					result, err = services.Client.InsertSigned(cCtx.Context, keyPair, docName, data)
+				}
+			} else {
+				result, err = services.Client.Insert(cCtx.Context, cCtx.String("key"), data)
+			}
+			if err != nil {
+				fmt.Fprintf(originalStderr, "Error: insert of %s failed: %v\n", result.Key, err)
+
+				return fmt.Errorf("insert failed: %v", err)
+			}
+
+			fmt.Fprintf(originalStderr, "Inserted %d bytes, last stored by %s after %s hops in %s\n", len(data), result.Location, strconv.Itoa(result.Hops), result.Elapsed)
+			fmt.Fprintln(originalStdout, result.Key)
+			return nil
+		},
+	}
+}
+
+// keygenCommand generates a key pair owning a subspace for signed subspace keys.
+func keygenCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "keygen",
+		Usage: "generate a key pair for signed subspace keys and print its SSK root",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "out",
+				Value: "keypair.yaml",
+				Usage: "key pair file path",
+			},
+		},
+		Action: func(cCtx *cli.Context) error {
+			path := cCtx.String("out")
+			if _, err := os.Stat(path); err == nil {
+				fmt.Fprintf(originalStderr, "Error: %s already exists\n", path)
+
+				return fmt.Errorf("refusing to overwrite key pair %s", path)
+			}
+
+			keyPair, err := keys.GenerateKeyPair()
+			if err != nil {
+				fmt.Fprintf(originalStderr, "Error: %v\n", err)
+
+				return err
+			}
+			if err := keyPair.Save(path); err != nil {
+				fmt.Fprintf(originalStderr, "Error: %v\n", err)
+
+				return fmt.Errorf("failed to save key pair: %v", err)
+			}
+
+			fmt.Fprintf(originalStderr, "Key pair written to %s\n", path)
+			fmt.Fprintln(originalStdout, keyPair.SSKRoot())
+			return nil
+		},
+	}
+}
+
+// fingerprintCommand prints the fingerprint of the TLS certificate of the node, so that neighbors can pin it.
+func fingerprintCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "fingerprint",
+		Usage: "print the fingerprint of the TLS certificate of this node, generating the certificate if needed",
+		Action: func(cCtx *cli.Context) error {
+			cert, err := services.LoadOrCreateCertificate(configs.GlobalConfig.WarehouseConfig.CertificatePath())
+			if err != nil {
+				fmt.Fprintf(originalStderr, "Error: %v\n", err)
+
+				return fmt.Errorf("failed to load TLS certificate: %v", err)
+			}
+
+			fmt.Fprintln(originalStdout, services.Fingerprint(cert))
+			return nil
+		},
+	}
+}
+
+// identityCommand prints the node ID of the node, so that neighbors can pin its certificate under it.
+func identityCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "identity",
+		Usage: "print the node ID of this node, generating its identity if needed",
+		Action: func(cCtx *cli.Context) error {
+			fmt.Fprintln(originalStdout, services.Client.NodeID())
+			return nil
+		},
+	}
+}
+
+// subscribeCommand polls the network for new editions of an updatable key and prints their keys as they appear.
+func subscribeCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "subscribe",
+		Usage:     "print the key of every new edition of an updatable key (USK) until interrupted",
+		ArgsUsage: " <USK@.../name/edition>",
+		Action: func(cCtx *cli.Context) error {
+			if cCtx.NArg() != 1 {
+				fmt.Fprintf(originalStderr, "Error: subscribe expects exactly one key\n")
+
+				return fmt.Errorf("subscribe expects exactly one key, got %d arguments", cCtx.NArg())
+			}
+
+			// Start the service client to reach the network.
+			if err := services.Client.Start(cCtx.Context); err != nil {
+				fmt.Fprintf(originalStderr, "Error: %v\n", err)
+
+				return fmt.Errorf("failed to start listening: %v", err)
+			}
+
+			err := services.Client.Subscribe(cCtx.Context, cCtx.Args().First(), func(key string, edition int64) {
+				fmt.Fprintln(originalStdout, key)
+			})
+			if err != nil {
+				fmt.Fprintf(originalStderr, "Error: %v\n", err)
+
+				return fmt.Errorf("failed to subscribe: %v", err)
+			}
+
+			// Poll until the command is interrupted
+			<-cCtx.Context.Done()
+			return nil
+		},
+	}
+}
+
+// Exit statuses of the search command, so that scripts can tell why a file was not found.
+const (
+	exitNotFound      = 2 // Every reachable neighbor was asked and none had the file
+	exitRouteNotFound = 3 // The request ran out of hops-to-live before finding the file
+	exitTimedOut      = 4 // The search did not complete before its deadline
+)
+
+// searchOutput is the JSON output of the search command.
+type searchOutput struct {
+	Key       string `json:"key"`
+	Status    string `json:"status"`
+	Location  string `json:"location,omitempty"`
+	Hops      int    `json:"hops"`
+	ElapsedMS int64  `json:"elapsed_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// searchCommand searches the network for a key and prints where the file is, exiting with a status telling the outcome.
+func searchCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "search",
+		Usage:     "search the network for a key and print the node holding the file",
+		ArgsUsage: " <key>",
+		Description: "Exits with status 0 when the file is found, 2 when no neighbor has it, 3 when the request ran out of\n" +
+			"hops-to-live, 4 when the search timed out and 1 on any other error.",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the result as JSON",
+			},
+		},
+		Action: func(cCtx *cli.Context) error {
+			if cCtx.NArg() != 1 {
+				fmt.Fprintf(originalStderr, "Error: search expects exactly one key\n")
+
+				return fmt.Errorf("search expects exactly one key, got %d arguments", cCtx.NArg())
+			}
+
+			// Start the service client to reach the network.
+			if err := services.Client.Start(cCtx.Context); err != nil {
+				fmt.Fprintf(originalStderr, "Error: %v\n", err)
+
+				return fmt.Errorf("failed to start listening: %v", err)
+			}
+			defer services.Client.Stop()
+
+			key := cCtx.Args().First()
+			result, err := services.Client.Search(cCtx.Context, key)
+			if result.Key == "" {
+				result.Key = key
+			}
+
+			if cCtx.Bool("json") {
+				output := searchOutput{
+					Key:       result.Key,
+					Status:    string(result.Status),
+					Location:  result.Location,
+					Hops:      result.Hops,
+					ElapsedMS: result.Elapsed.Milliseconds(),
+				}
+				if err != nil {
+					output.Error = err.Error()
+				}
+				data, _ := json.Marshal(output)
+				fmt.Fprintln(originalStdout, string(data))
+			} else if err == nil {
+				fmt.Fprintf(originalStdout, "%s found at %s after %d hops in %s\n", result.Key, result.Location, result.Hops, result.Elapsed)
+			}
+
+			switch {
+			case err == nil:
+				return nil
+			case errors.Is(err, services.ErrNotFound):
+				return cli.Exit(searchError(cCtx, result.Key, err), exitNotFound)
+			case errors.Is(err, services.ErrRouteNotFound):
+				return cli.Exit(searchError(cCtx, result.Key, err), exitRouteNotFound)
+			case errors.Is(err, services.ErrTimedOut):
+				return cli.Exit(searchError(cCtx, result.Key, err), exitTimedOut)
+			default:
+				return cli.Exit(searchError(cCtx, result.Key, err), 1)
+			}
+		},
+	}
+}
+
+// searchError formats the error of a failed search for stderr, or returns an empty message when the JSON output already carries it.
+func searchError(cCtx *cli.Context, key string, err error) string {
+	if cCtx.Bool("json") {
+		return ""
+	}
+	return "Error: search of " + key + " failed: " + err.Error()
+}
+
+// warehouseCommand lists and edits the files of the warehouse without starting the node.
+func warehouseCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "warehouse",
+		Usage: "list and edit the files of the warehouse",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "list",
+				Usage: "print the key and the location of every file, sorted by key",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "print the files as a JSON object mapping keys to locations",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					files := services.Client.Warehouse()
+					if cCtx.Bool("json") {
+						data, _ := json.Marshal(files)
+						fmt.Fprintln(originalStdout, string(data))
+						return nil
+					}
+
+					keys := make([]string, 0, len(files))
+					for key := range files {
+						keys = append(keys, key)
+					}
+					slices.Sort(keys)
+					for _, key := range keys {
+						fmt.Fprintf(originalStdout, "%s\t%s\n", key, files[key])
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "add",
+				Usage:     "record the node holding a file, \"local\" if its content is in the datastore",
+				ArgsUsage: " <key> <node ID, address or local>",
+				Action: func(cCtx *cli.Context) error {
+					if cCtx.NArg() != 2 {
+						fmt.Fprintf(originalStderr, "Error: warehouse add expects a key and a location\n")
+
+						return fmt.Errorf("warehouse add expects a key and a location, got %d arguments", cCtx.NArg())
+					}
+
+					// A local file must have its content in the datastore, which only insert puts there
+					key, err := services.Client.SetFileLocation(cCtx.Args().Get(0), cCtx.Args().Get(1))
+					if err != nil {
+						fmt.Fprintf(originalStderr, "Error: %v\n", err)
+
+						return fmt.Errorf("failed to store file: %v", err)
+					}
+
+					fmt.Fprintf(originalStderr, "File %s recorded at %s\n", key, cCtx.Args().Get(1))
+					return nil
+				},
+			},
+			{
+				Name:      "remove",
+				Usage:     "forget the location of a file, leaving its content in the datastore if any",
+				ArgsUsage: " <key>",
+				Action: func(cCtx *cli.Context) error {
+					if cCtx.NArg() != 1 {
+						fmt.Fprintf(originalStderr, "Error: warehouse remove expects exactly one key\n")
+
+						return fmt.Errorf("warehouse remove expects exactly one key, got %d arguments", cCtx.NArg())
+					}
+
+					key, err := services.Client.RemoveFileLocation(cCtx.Args().First())
+					if err != nil {
+						fmt.Fprintf(originalStderr, "Error: %v\n", err)
+
+						return fmt.Errorf("failed to remove file: %v", err)
+					}
+
+					fmt.Fprintf(originalStderr, "File %s removed\n", key)
+					return nil
+				},
+			},
+		},
+	}
+}
+
+// pingCommand checks whether a node answers, printing its node ID and the protocol negotiated with it.
+func pingCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "ping",
+		Usage:     "check whether a node answers and print its node ID",
+		ArgsUsage: " <address or node ID>",
+		Action: func(cCtx *cli.Context) error {
+			if cCtx.NArg() != 1 {
+				fmt.Fprintf(originalStderr, "Error: ping expects exactly one address\n")
+
+				return fmt.Errorf("ping expects exactly one address, got %d arguments", cCtx.NArg())
+			}
+
+			result, err := services.Client.Ping(cCtx.Context, cCtx.Args().First())
+			if err != nil {
+				return cli.Exit("Error: "+err.Error(), 1)
+			}
+
+			features := "none"
+			if len(result.Features) > 0 {
+				features = strings.Join(result.Features, ", ")
+			}
+			fmt.Fprintf(originalStdout, "%s is node %s, protocol version %d, features: %s, answered in %s\n", result.Address, result.NodeID, result.Version, features, result.Elapsed)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,73 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"freenet/internal/events"
+	"freenet/internal/services"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// keepAliveInterval is the time between two comments sent on an idle event stream, so that
+// clients and proxies do not close it.
+const keepAliveInterval = 15 * time.Second
+
+// handleEvents serves GET /events, a stream of Server-Sent Events carrying the events of the node as JSON
+// from the time of the request. The types query parameter, a comma-separated list, keeps only those types.
+func (s *server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	var types []events.Type
+	if value := r.URL.Query().Get("types"); value != "" {
+		for _, name := range strings.Split(value, ",") {
+			eventType, valid := events.ParseType(strings.TrimSpace(name))
+			if !valid {
+				writeError(w, http.StatusBadRequest, "unknown event type "+name)
+				return
+			}
+			types = append(types, eventType)
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	// The request context ends when the client goes away or the node stops, closing the subscription
+	stream := services.Client.Events(r.Context(), types...)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event, open := <-stream:
+			if !open {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,138 @@
+package admin
+
+import (
+	"context"
+	"freenet/internal/services"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// searchRetention is how long the result of a completed search stays available after it completed.
+const searchRetention = 10 * time.Minute
+
+// searchStatus is the JSON representation of a search started through the admin API.
+type searchStatus struct {
+	ID        string    `json:"id"`
+	Key       string    `json:"key"`
+	Status    string    `json:"status"`               // pending, fulfilled, failed or timed_out
+	RequestID string    `json:"request_id,omitempty"` // Request of the RequestsStore, empty if the file was already in the warehouse
+	Location  string    `json:"location,omitempty"`
+	Hops      int       `json:"hops"`
+	ElapsedMS int64     `json:"elapsed_ms"`
+	Error     string    `json:"error,omitempty"`
+	Started   time.Time `json:"started"`
+}
+
+// search is a search started through the admin API.
+type search struct {
+	id        string
+	key       string
+	future    *services.SearchFuture
+	started   time.Time
+	completed time.Time // Zero while the search is pending
+}
+
+// searches holds the searches started through the admin API until some time after they complete.
+type searches struct {
+	mu       sync.Mutex
+	searches map[string]*search
+}
+
+// newSearches creates an empty set of searches.
+func newSearches() *searches {
+	return &searches{searches: make(map[string]*search)}
+}
+
+// start starts a search and returns its status.
+func (s *searches) start(ctx context.Context, key string) searchStatus {
+	search := &search{
+		id:      uuid.New().String(),
+		key:     key,
+		future:  services.Client.SearchAsync(ctx, key),
+		started: time.Now(),
+	}
+
+	s.mu.Lock()
+	s.searches[search.id] = search
+	s.mu.Unlock()
+	return search.status()
+}
+
+// get returns the status of a search.
+func (s *searches) get(id string) (searchStatus, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked()
+
+	search, exists := s.searches[id]
+	if !exists {
+		return searchStatus{}, false
+	}
+	return search.status(), true
+}
+
+// list returns the status of every search, oldest first.
+func (s *searches) list() []searchStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked()
+
+	statuses := make([]searchStatus, 0, len(s.searches))
+	for _, search := range s.searches {
+		statuses = append(statuses, search.status())
+	}
+	slices.SortFunc(statuses, func(a, b searchStatus) int {
+		return a.Started.Compare(b.Started)
+	})
+	return statuses
+}
+
+// pruneLocked forgets the searches completed for longer than searchRetention.
+func (s *searches) pruneLocked() {
+	for id, search := range s.searches {
+		select {
+		case <-search.future.Done():
+			if search.completed.IsZero() {
+				search.completed = time.Now()
+			} else if time.Since(search.completed) > searchRetention {
+				delete(s.searches, id)
+			}
+		default:
+		}
+	}
+}
+
+// status returns the current status of the search.
+func (search *search) status() searchStatus {
+	status := searchStatus{
+		ID:      search.id,
+		Key:     search.key,
+		Status:  "pending",
+		Started: search.started,
+	}
+
+	select {
+	case <-search.future.Done():
+	default:
+		status.ElapsedMS = time.Since(search.started).Milliseconds()
+		return status
+	}
+
+	// The search has completed, Wait returns at once
+	result, err := search.future.Wait(context.Background())
+	if result.Key != "" {
+		status.Key = result.Key
+	}
+	status.Status = string(result.Status)
+	status.RequestID = result.RequestID
+	status.Location = result.Location
+	status.Hops = result.Hops
+	status.ElapsedMS = result.Elapsed.Milliseconds()
+	if err != nil {
+		status.Error = err.Error()
+	}
+	return status
+}
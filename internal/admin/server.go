@@ -0,0 +1,361 @@
+// Package admin serves a local JSON API over HTTP to control a running node.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"freenet/internal/configs"
+	"freenet/internal/keys"
+	"freenet/internal/logger"
+	"freenet/internal/services"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBodySize bounds the size of the JSON bodies of the requests.
+const maxBodySize = 1 << 20
+
+// shutdownTimeout bounds the time given to the requests in progress when the node stops.
+const shutdownTimeout = 5 * time.Second
+
+// server holds the state of the admin API.
+type server struct {
+	ctx      context.Context
+	searches *searches
+	started  time.Time
+}
+
+// Start serves the admin API on the configured address until the context is cancelled.
+// It does nothing when the admin port is 0.
+func Start(ctx context.Context, config configs.AdminConfig) error {
+	if config.Port == 0 {
+		return nil
+	}
+	if config.Port < 0 || config.Port > 65535 {
+		return fmt.Errorf("invalid admin port: %d", config.Port)
+	}
+
+	address := net.JoinHostPort(config.Address, strconv.Itoa(config.Port))
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to start the admin API on %s: %v", address, err)
+	}
+	if ip := net.ParseIP(config.Address); ip == nil || !ip.IsLoopback() {
+		logger.GlobalLogger.Warn("The admin API has no authentication and listens on " + address + ", reachable from other hosts")
+	}
+
+	s := &server{ctx: ctx, searches: newSearches(), started: time.Now()}
+	httpServer := &http.Server{
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.GlobalLogger.Error("Admin API stopped: " + err.Error())
+		}
+	}()
+
+	logger.GlobalLogger.Info("Admin API listening on http://" + address)
+	return nil
+}
+
+// routes returns the handler of the endpoints of the admin API.
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/searches", s.handleSearches)
+	mux.HandleFunc("/searches/", s.handleSearch)
+	mux.HandleFunc("/warehouse", s.handleWarehouse)
+	mux.HandleFunc("/warehouse/", s.handleWarehouseFile)
+	mux.HandleFunc("/requests", s.handleRequests)
+	mux.HandleFunc("/peers", s.handlePeers)
+	mux.HandleFunc("/log-level", s.handleLogLevel)
+	mux.HandleFunc("/events", s.handleEvents)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "no endpoint "+r.URL.Path)
+	})
+	return mux
+}
+
+// statusView is the JSON representation of the state of the node.
+type statusView struct {
+	NodeID          string                           `json:"node_id"`
+	Address         string                           `json:"address"`
+	Location        uint64                           `json:"location"`
+	ProtocolVersion int                              `json:"protocol_version"`
+	UptimeSeconds   int64                            `json:"uptime_seconds"`
+	Files           int                              `json:"files"`
+	Peers           int                              `json:"peers"`
+	Requests        int                              `json:"requests"`
+	LogLevel        string                           `json:"log_level"`
+	Messages        map[string]services.MessageStats `json:"messages"` // Messages received by type
+}
+
+// handleStatus serves GET /status.
+func (s *server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, statusView{
+		NodeID:          services.Client.NodeID(),
+		Address:         services.Client.Address(),
+		Location:        services.Client.Location(),
+		ProtocolVersion: services.ProtocolVersion,
+		UptimeSeconds:   int64(time.Since(s.started).Seconds()),
+		Files:           len(services.Client.Warehouse()),
+		Peers:           len(services.Client.Peers()),
+		Requests:        len(services.Client.Requests()),
+		LogLevel:        logger.Level.String(),
+		Messages:        services.Client.MessageStats(),
+	})
+}
+
+// handleSearches serves GET /searches, listing the searches, and POST /searches, starting one.
+func (s *server) handleSearches(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, s.searches.list())
+		return
+	}
+
+	var body struct {
+		Key string `json:"key"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if body.Key == "" {
+		writeError(w, http.StatusBadRequest, "missing key")
+		return
+	}
+
+	// The search outlives the HTTP request, it is polled afterwards
+	status := s.searches.start(s.ctx, body.Key)
+	w.Header().Set("Location", "/searches/"+status.ID)
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+// handleSearch serves GET /searches/{id}, the status of a search.
+func (s *server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/searches/")
+	status, exists := s.searches.get(id)
+	if !exists {
+		writeError(w, http.StatusNotFound, "no search "+id)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleWarehouse serves GET /warehouse, the files of the warehouse mapped to their location.
+func (s *server) handleWarehouse(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, services.Client.Warehouse())
+}
+
+// handleWarehouseFile serves GET, PUT and DELETE /warehouse/{key}, reading, recording and forgetting the location of a file.
+func (s *server) handleWarehouseFile(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPut, http.MethodDelete) {
+		return
+	}
+	key, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/warehouse/"))
+	if err != nil || key == "" {
+		writeError(w, http.StatusBadRequest, "invalid key")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		// The warehouse records URIs under their routing key
+		if routingKey, err := keys.RoutingKey(key); err == nil {
+			key = routingKey
+		}
+		location, exists := services.Client.Warehouse()[key]
+		if !exists {
+			writeError(w, http.StatusNotFound, "file "+key+" not in the warehouse")
+			return
+		}
+		writeJSON(w, http.StatusOK, fileView{Key: key, Location: location})
+	case http.MethodPut:
+		var body struct {
+			Location string `json:"location"`
+		}
+		if !readJSON(w, r, &body) {
+			return
+		}
+		key, err := services.Client.SetFileLocation(key, body.Location)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, fileView{Key: key, Location: body.Location})
+	case http.MethodDelete:
+		if _, err := services.Client.RemoveFileLocation(key); err != nil {
+			if errors.Is(err, services.ErrNotInWarehouse) {
+				writeError(w, http.StatusNotFound, err.Error())
+			} else {
+				writeError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// fileView is the JSON representation of a file of the warehouse.
+type fileView struct {
+	Key      string `json:"key"`
+	Location string `json:"location"`
+}
+
+// requestView is the JSON representation of a request of the RequestsStore, without the content of inserts.
+type requestView struct {
+	ID               string   `json:"id"`
+	Key              string   `json:"key"`
+	NodeID           string   `json:"node_id"` // Node the request came from, "local" if it was created by this node
+	VisitedNeighbors []string `json:"visited_neighbors"`
+	HTL              int      `json:"htl"`
+	HTLExhausted     bool     `json:"htl_exhausted"`
+	PendingNeighbor  string   `json:"pending_neighbor,omitempty"`
+	Status           string   `json:"status"`
+	Insert           bool     `json:"insert"`
+	Size             int      `json:"size,omitempty"` // Size of the content of an insert
+}
+
+// handleRequests serves GET /requests, the requests of the RequestsStore sorted by ID.
+// The status query parameter keeps only the requests with that status.
+func (s *server) handleRequests(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	status := r.URL.Query().Get("status")
+
+	views := make([]requestView, 0)
+	for id, request := range services.Client.Requests() {
+		if status != "" && string(request.Status) != status {
+			continue
+		}
+		views = append(views, requestView{
+			ID:               id,
+			Key:              request.Key,
+			NodeID:           request.NodeID,
+			VisitedNeighbors: request.VisitedNeighbors,
+			HTL:              request.HTL,
+			HTLExhausted:     request.HTLExhausted,
+			PendingNeighbor:  request.PendingNeighbor,
+			Status:           string(request.Status),
+			Insert:           request.Insert,
+			Size:             request.Size,
+		})
+	}
+	slices.SortFunc(views, func(a, b requestView) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	writeJSON(w, http.StatusOK, views)
+}
+
+// peerView is the JSON representation of a neighbor of the peer table.
+type peerView struct {
+	ID          string    `json:"id,omitempty"` // Empty while the node ID of the neighbor is not known
+	Address     string    `json:"address"`
+	Location    uint64    `json:"location"`
+	State       string    `json:"state"`
+	LastSeen    time.Time `json:"last_seen"`
+	Penalty     int       `json:"penalty"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+}
+
+// handlePeers serves GET /peers, the neighbors of the peer table.
+func (s *server) handlePeers(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	views := make([]peerView, 0)
+	for _, peer := range services.Client.Peers() {
+		views = append(views, peerView{
+			ID:          peer.ID,
+			Address:     peer.Address,
+			Location:    peer.Location,
+			State:       string(peer.State),
+			LastSeen:    peer.LastSeen,
+			Penalty:     peer.Penalty,
+			Fingerprint: peer.Fingerprint,
+		})
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+// handleLogLevel serves GET /log-level and PUT /log-level, reading and changing the level of the logs.
+func (s *server) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPut) {
+		return
+	}
+	if r.Method == http.MethodPut {
+		var body struct {
+			Level string `json:"level"`
+		}
+		if !readJSON(w, r, &body) {
+			return
+		}
+		if err := logger.SetLevel(body.Level); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		logger.GlobalLogger.Info("Log level set to " + body.Level + " through the admin API")
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"level": logger.Level.String()})
+}
+
+// allowMethods checks the method of a request, answering 405 with the allowed methods otherwise.
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	if slices.Contains(methods, r.Method) {
+		return true
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "method "+r.Method+" not allowed on "+r.URL.Path)
+	return false
+}
+
+// readJSON decodes the JSON body of a request, answering 400 if it is invalid.
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// writeJSON writes a JSON response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error response.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,254 @@
+package admin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"freenet/internal/configs"
+	"freenet/internal/events"
+	"freenet/internal/logger"
+	"freenet/internal/services"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TestMain initializes the node served by the admin API, without neighbors.
+func TestMain(m *testing.M) {
+	logger.GlobalLogger = zap.NewNop()
+	dir, err := os.MkdirTemp("", "freenet-admin")
+	if err != nil {
+		panic(err)
+	}
+
+	configs.GlobalConfig = configs.Config{
+		WarehouseConfig: configs.WarehouseConfig{Path: filepath.Join(dir, "warehouse.yaml")},
+		NetworkConfig: configs.NetworkConfig{
+			Address:        "127.0.0.1",
+			MaxFrameSize:   1 << 20,
+			MaxConnections: 32,
+			IdleTimeout:    2 * time.Minute,
+			QueueSize:      64,
+		},
+		RoutingConfig: configs.RoutingConfig{
+			Router:            "circular",
+			DefaultHTL:        10,
+			MaxHTL:            18,
+			HopTimeout:        5 * time.Second,
+			SearchTimeout:     30 * time.Second,
+			SubscribeInterval: time.Minute,
+		},
+		SplitfileConfig: configs.SplitfileConfig{BlockSize: 32 << 10, Redundancy: 0.5},
+		BatchConfig:     configs.BatchConfig{Concurrency: 4, Retries: 2},
+	}
+	if err := services.InitServiceClient(context.Background()); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestServer serves the admin API over a local HTTP server until the end of the test.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	s := &server{ctx: context.Background(), searches: newSearches(), started: time.Now()}
+	httpServer := httptest.NewServer(s.routes())
+	t.Cleanup(httpServer.Close)
+	return httpServer
+}
+
+// call sends a request with a JSON body, if any, and decodes the JSON response into v, if not nil.
+func call(t *testing.T, httpServer *httptest.Server, method, path, body string, v interface{}) *http.Response {
+	t.Helper()
+	request, err := http.NewRequest(method, httpServer.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if v != nil {
+		if err := json.NewDecoder(response.Body).Decode(v); err != nil {
+			t.Fatalf("%s %s: invalid JSON response: %v", method, path, err)
+		}
+	}
+	return response
+}
+
+func TestStatus(t *testing.T) {
+	httpServer := newTestServer(t)
+
+	var status statusView
+	if response := call(t, httpServer, http.MethodGet, "/status", "", &status); response.StatusCode != http.StatusOK {
+		t.Fatalf("GET /status answered %d", response.StatusCode)
+	}
+	if status.NodeID != services.Client.NodeID() || status.ProtocolVersion != services.ProtocolVersion {
+		t.Fatalf("status %+v does not describe the node", status)
+	}
+
+	// A method not allowed is answered with the allowed ones
+	response := call(t, httpServer, http.MethodPost, "/status", "", nil)
+	if response.StatusCode != http.StatusMethodNotAllowed || response.Header.Get("Allow") != http.MethodGet {
+		t.Fatalf("POST /status answered %d, allowing %q", response.StatusCode, response.Header.Get("Allow"))
+	}
+	if response := call(t, httpServer, http.MethodGet, "/unknown", "", nil); response.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET /unknown answered %d, expected 404", response.StatusCode)
+	}
+}
+
+func TestWarehouseEndpoints(t *testing.T) {
+	httpServer := newTestServer(t)
+
+	var file fileView
+	response := call(t, httpServer, http.MethodPut, "/warehouse/admin-file", `{"location": "127.0.0.1:1"}`, &file)
+	if response.StatusCode != http.StatusOK || file != (fileView{Key: "admin-file", Location: "127.0.0.1:1"}) {
+		t.Fatalf("PUT answered %d with %+v", response.StatusCode, file)
+	}
+
+	var warehouse map[string]string
+	call(t, httpServer, http.MethodGet, "/warehouse", "", &warehouse)
+	if warehouse["admin-file"] != "127.0.0.1:1" {
+		t.Fatalf("warehouse %v does not have the recorded file", warehouse)
+	}
+	file = fileView{}
+	if call(t, httpServer, http.MethodGet, "/warehouse/admin-file", "", &file); file.Location != "127.0.0.1:1" {
+		t.Fatalf("GET answered %+v", file)
+	}
+
+	// The node holding the file became a neighbor
+	var peers []peerView
+	call(t, httpServer, http.MethodGet, "/peers", "", &peers)
+	if !slices.ContainsFunc(peers, func(peer peerView) bool { return peer.Address == "127.0.0.1:1" }) {
+		t.Fatalf("peers %+v do not have the node holding the file", peers)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+	}{
+		{"remove", http.MethodDelete, "", http.StatusNoContent},
+		{"remove again", http.MethodDelete, "", http.StatusNotFound},
+		{"read removed", http.MethodGet, "", http.StatusNotFound},
+		{"local without content", http.MethodPut, `{"location": "local"}`, http.StatusBadRequest},
+		{"unknown field", http.MethodPut, `{"location": "127.0.0.1:1", "size": 1}`, http.StatusBadRequest},
+		{"invalid JSON", http.MethodPut, `{"location"`, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		if response := call(t, httpServer, test.method, "/warehouse/admin-file", test.body, nil); response.StatusCode != test.status {
+			t.Fatalf("%s: answered %d, expected %d", test.name, response.StatusCode, test.status)
+		}
+	}
+}
+
+func TestSearchEndpoints(t *testing.T) {
+	httpServer := newTestServer(t)
+	if _, err := services.Client.SetFileLocation("admin-search", "127.0.0.1:2"); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, expected := range map[string]string{"admin-search": "fulfilled", "admin-missing": "failed"} {
+		var started searchStatus
+		response := call(t, httpServer, http.MethodPost, "/searches", `{"key": "`+key+`"}`, &started)
+		if response.StatusCode != http.StatusAccepted || response.Header.Get("Location") != "/searches/"+started.ID {
+			t.Fatalf("POST /searches answered %d at %q", response.StatusCode, response.Header.Get("Location"))
+		}
+
+		// The search is polled until it completes
+		status := started
+		for deadline := time.Now().Add(5 * time.Second); status.Status == "pending" && time.Now().Before(deadline); {
+			time.Sleep(10 * time.Millisecond)
+			call(t, httpServer, http.MethodGet, "/searches/"+started.ID, "", &status)
+		}
+		if status.Status != expected || status.Key != key {
+			t.Fatalf("search of %s ended with %+v, expected %s", key, status, expected)
+		}
+		if expected == "fulfilled" && status.Location != "127.0.0.1:2" {
+			t.Fatalf("search found the file at %q", status.Location)
+		}
+	}
+
+	var list []searchStatus
+	if call(t, httpServer, http.MethodGet, "/searches", "", &list); len(list) != 2 {
+		t.Fatalf("%d searches listed, expected 2", len(list))
+	}
+	if response := call(t, httpServer, http.MethodPost, "/searches", `{}`, nil); response.StatusCode != http.StatusBadRequest {
+		t.Fatalf("POST without a key answered %d", response.StatusCode)
+	}
+	if response := call(t, httpServer, http.MethodGet, "/searches/unknown", "", nil); response.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET of an unknown search answered %d", response.StatusCode)
+	}
+}
+
+func TestLogLevelEndpoint(t *testing.T) {
+	httpServer := newTestServer(t)
+	defer logger.Level.SetLevel(logger.Level.Level())
+
+	var level map[string]string
+	if call(t, httpServer, http.MethodPut, "/log-level", `{"level": "debug"}`, &level); level["level"] != "debug" {
+		t.Fatalf("PUT answered %v", level)
+	}
+	if logger.Level.String() != "debug" {
+		t.Fatalf("log level is %s", logger.Level.String())
+	}
+	if response := call(t, httpServer, http.MethodPut, "/log-level", `{"level": "loud"}`, nil); response.StatusCode != http.StatusBadRequest {
+		t.Fatalf("PUT of an unknown level answered %d", response.StatusCode)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	httpServer := newTestServer(t)
+	if response := call(t, httpServer, http.MethodGet, "/events?types=unknown", "", nil); response.StatusCode != http.StatusBadRequest {
+		t.Fatalf("GET of an unknown event type answered %d", response.StatusCode)
+	}
+
+	response, err := http.Get(httpServer.URL + "/events?types=" + string(events.WarehouseChanged))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("stream served as %q", response.Header.Get("Content-Type"))
+	}
+
+	// The events are published once the stream is connected
+	lines := bufio.NewScanner(response.Body)
+	if !lines.Scan() || lines.Text() != ": connected" {
+		t.Fatalf("stream started with %q", lines.Text())
+	}
+	services.Client.SearchAsync(context.Background(), "admin-unrelated") // Its events are of other types
+	if _, err := services.Client.SetFileLocation("admin-event", "127.0.0.1:3"); err != nil {
+		t.Fatal(err)
+	}
+
+	fields := make(map[string]string)
+	for lines.Scan() {
+		line := lines.Text()
+		if line == "" && len(fields) > 0 {
+			break
+		}
+		if name, value, found := strings.Cut(line, ": "); found && name != "" {
+			fields[name] = value
+		}
+	}
+	var event events.Event
+	if err := json.Unmarshal([]byte(fields["data"]), &event); err != nil {
+		t.Fatalf("invalid event data %q: %v", fields["data"], err)
+	}
+	if fields["event"] != string(events.WarehouseChanged) || event.Key != "admin-event" || event.Location != "127.0.0.1:3" {
+		t.Fatalf("received %v, expected the recorded file", fields)
+	}
+}
@@ -0,0 +1,7 @@
+package configs
+
+// AdminConfig holds the settings of the local admin HTTP API.
+type AdminConfig struct {
+	Address string // The address the admin API listens on, localhost by default as it has no authentication
+	Port    int    // The port number of the admin API, 0 to disable it
+}
@@ -0,0 +1,7 @@
+package configs
+
+// BatchConfig holds the settings of the searches of many keys at once.
+type BatchConfig struct {
+	Concurrency int // Maximum number of searches of a batch running at once
+	Retries     int // Number of times the search of a key is retried after failing
+}
@@ -8,4 +8,9 @@ type Config struct {
 	LoggerConfig // Configuration settings for the logger.
 	WarehouseConfig
 	NetworkConfig
+	RoutingConfig
+	SplitfileConfig
+	BatchConfig
+	AdminConfig
+	FCPConfig
 }
@@ -0,0 +1,7 @@
+package configs
+
+// FCPConfig holds the settings of the FCP server, the client protocol of Freenet.
+type FCPConfig struct {
+	Address string // The address the FCP server listens on, localhost by default as it has no authentication
+	Port    int    // The port number of the FCP server, 0 to disable it
+}
@@ -4,4 +4,11 @@ package configs
 type LoggerConfig struct {
 	// Debug indicates whether debug logging is enabled.
 	Debug bool
+	// Headless indicates that the node runs without the interface, so logs are written to File or stdout
+	// instead of being captured for the log view.
+	Headless bool
+	// File is the path of a file the logs are appended to, in addition to the log view, or instead of stdout when headless.
+	File string
+	// Quiet indicates that logs are only written to File when headless, so that they do not mix with the output of a command.
+	Quiet bool
 }
@@ -1,6 +1,19 @@
 package configs
 
+import "time"
+
 type NetworkConfig struct {
 	Address string // The address this node listens on
 	Port    int    // The port number to listen on
+
+	MaxFrameSize   int           // Maximum size in bytes of a single message frame
+	MaxConnections int           // Maximum number of persistent neighbor connections
+	IdleTimeout    time.Duration // Neighbor connections unused for this long are closed
+	QueueSize      int           // Number of messages that can wait on a single neighbor connection
+	RateLimit      int           // Number of messages per second accepted from a single neighbor, 0 for no limit
+
+	Compression bool // Whether large messages are compressed on the connections to neighbors supporting it
+
+	TLS     bool // Whether neighbor connections use mutually authenticated TLS
+	Darknet bool // Whether connections from nodes whose certificate is not pinned in the peer table are rejected
 }
@@ -0,0 +1,17 @@
+package configs
+
+import "time"
+
+// RoutingConfig holds the settings controlling how far requests travel through the network.
+type RoutingConfig struct {
+	Router string // Name of the routing strategy: ascii, circular, xor or random
+
+	DefaultHTL       int  // Hops-to-live given to the requests created by this node
+	MaxHTL           int  // Upper bound applied to the hops-to-live of every request
+	ProbabilisticHTL bool // Randomly skip the decrement at max and min HTL to hide the originator
+
+	HopTimeout    time.Duration // Time given to a neighbor to answer before trying the next one
+	SearchTimeout time.Duration // Time given to a local request before it is reported as timed out
+
+	SubscribeInterval time.Duration // Time between two polls for new editions of a subscribed updatable key
+}
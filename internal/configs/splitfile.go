@@ -0,0 +1,7 @@
+package configs
+
+// SplitfileConfig holds the settings controlling how large files are split into blocks.
+type SplitfileConfig struct {
+	BlockSize  int     // Size in bytes of the blocks files larger than one block are split into
+	Redundancy float64 // Number of check blocks inserted per data block, from 0 (none) to 1
+}
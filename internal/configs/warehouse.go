@@ -1,5 +1,46 @@
 package configs
 
+import (
+	"path/filepath"
+	"strings"
+)
+
 type WarehouseConfig struct {
-	Path string
+	Path        string
+	Peers       string // Path of the peer table, derived from the warehouse path when empty
+	Datastore   string // Directory holding the content of local files, derived from the warehouse path when empty
+	Certificate string // Path of the TLS certificate of the node, derived from the warehouse path when empty
+	Identity    string // Path of the identity key pair of the node, derived from the warehouse path when empty
+}
+
+// PeersPath returns the path of the peer table, next to the warehouse file unless configured otherwise.
+func (c WarehouseConfig) PeersPath() string {
+	if c.Peers != "" {
+		return c.Peers
+	}
+	return strings.TrimSuffix(c.Path, filepath.Ext(c.Path)) + ".peers.yaml"
+}
+
+// DatastorePath returns the directory of the datastore, next to the warehouse file unless configured otherwise.
+func (c WarehouseConfig) DatastorePath() string {
+	if c.Datastore != "" {
+		return c.Datastore
+	}
+	return strings.TrimSuffix(c.Path, filepath.Ext(c.Path)) + ".data"
+}
+
+// CertificatePath returns the path of the TLS certificate of the node, next to the warehouse file unless configured otherwise.
+func (c WarehouseConfig) CertificatePath() string {
+	if c.Certificate != "" {
+		return c.Certificate
+	}
+	return strings.TrimSuffix(c.Path, filepath.Ext(c.Path)) + ".cert.pem"
+}
+
+// IdentityPath returns the path of the identity key pair of the node, next to the warehouse file unless configured otherwise.
+func (c WarehouseConfig) IdentityPath() string {
+	if c.Identity != "" {
+		return c.Identity
+	}
+	return strings.TrimSuffix(c.Path, filepath.Ext(c.Path)) + ".identity.yaml"
 }
@@ -0,0 +1,115 @@
+// Package events publishes the activity of the node, requests, warehouse and neighbors, to local subscribers
+// such as the interface and the admin API.
+package events
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Type is the kind of an event.
+type Type string
+
+const (
+	RequestCreated   Type = "request_created"   // A request was created locally or received from a neighbor
+	RequestForwarded Type = "request_forwarded" // A request was sent to a neighbor
+	RequestPositive  Type = "request_positive"  // A request was fulfilled, or an insert acknowledged
+	RequestNegative  Type = "request_negative"  // A request failed on this node, no neighbor being left to try
+	RequestTimedOut  Type = "request_timed_out" // A local request did not complete in time
+	WarehouseChanged Type = "warehouse_changed" // The location of a file was recorded or forgotten
+	PeerUp           Type = "peer_up"           // A connection to a neighbor was opened
+	PeerDown         Type = "peer_down"         // The connection to a neighbor was closed or could not be opened
+)
+
+// Types lists every type of event.
+var Types = []Type{
+	RequestCreated, RequestForwarded, RequestPositive, RequestNegative, RequestTimedOut,
+	WarehouseChanged, PeerUp, PeerDown,
+}
+
+// Event is something that happened on the node. Only the fields relevant to its type are set.
+type Event struct {
+	ID        uint64    `json:"id"` // Sequence number of the event, a gap tells a subscriber of every type that it missed events
+	Type      Type      `json:"type"`
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	Key       string    `json:"key,omitempty"`      // Key of the file requested or recorded in the warehouse
+	Insert    bool      `json:"insert,omitempty"`   // Whether the request is an insert
+	Peer      string    `json:"peer,omitempty"`     // Neighbor the request came from, was sent to or was answered by, or neighbor up or down
+	Address   string    `json:"address,omitempty"`  // Address of the neighbor up or down
+	Location  string    `json:"location,omitempty"` // Node holding the file, empty when a file is forgotten
+	HTL       int       `json:"htl,omitempty"`      // Hops-to-live of the request
+	Hops      int       `json:"hops,omitempty"`     // Number of hops to the node that fulfilled the request
+	Reason    string    `json:"reason,omitempty"`   // Why a request failed
+}
+
+// Bus delivers the events published to its subscribers. Publishing never blocks, a subscriber too slow
+// to keep up misses the events that do not fit in its buffer.
+type Bus struct {
+	mu          sync.Mutex
+	lastID      uint64
+	subscribers map[*subscriber]struct{}
+}
+
+// subscriber is a consumer of the events of a bus.
+type subscriber struct {
+	events chan Event
+	types  []Type // Types of events delivered, all of them when empty
+}
+
+// NewBus creates a bus without subscribers.
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[*subscriber]struct{})}
+}
+
+// Publish numbers and timestamps an event and delivers it to the subscribers interested in its type.
+func (bus *Bus) Publish(event Event) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	bus.lastID++
+	event.ID = bus.lastID
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	for sub := range bus.subscribers {
+		if len(sub.types) > 0 && !slices.Contains(sub.types, event.Type) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			// The subscriber is not keeping up, it will notice the gap in the IDs
+		}
+	}
+}
+
+// Subscribe returns a channel receiving the events of the given types, or of every type when none is given,
+// published from now on. Up to buffer events wait for the subscriber to read them. The channel is closed once
+// the context is cancelled.
+func (bus *Bus) Subscribe(ctx context.Context, buffer int, types ...Type) <-chan Event {
+	sub := &subscriber{events: make(chan Event, buffer), types: types}
+
+	bus.mu.Lock()
+	bus.subscribers[sub] = struct{}{}
+	bus.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		bus.mu.Lock()
+		defer bus.mu.Unlock()
+		delete(bus.subscribers, sub)
+		close(sub.events)
+	}()
+
+	return sub.events
+}
+
+// ParseType returns the type of event with the given name.
+func ParseType(name string) (Type, bool) {
+	eventType := Type(name)
+	return eventType, slices.Contains(Types, eventType)
+}
@@ -0,0 +1,130 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// receive returns the next event of a subscription, failing the test if none arrives.
+func receive(t *testing.T, stream <-chan Event) Event {
+	t.Helper()
+	select {
+	case event, open := <-stream:
+		if !open {
+			t.Fatal("subscription closed")
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+	return Event{}
+}
+
+func TestPublishNumbersEvents(t *testing.T) {
+	bus := NewBus()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := bus.Subscribe(ctx, 8)
+
+	recorded := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bus.Publish(Event{Type: RequestCreated, RequestID: "request"})
+	bus.Publish(Event{Type: WarehouseChanged, Key: "file", Time: recorded})
+
+	first, second := receive(t, stream), receive(t, stream)
+	if first.ID != 1 || first.Type != RequestCreated || first.RequestID != "request" || first.Time.IsZero() {
+		t.Fatalf("first event %+v", first)
+	}
+	// The time of an event is kept when set by the publisher
+	if second.ID != 2 || second.Key != "file" || !second.Time.Equal(recorded) {
+		t.Fatalf("second event %+v", second)
+	}
+}
+
+func TestSubscribeFiltersTypes(t *testing.T) {
+	bus := NewBus()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	peers := bus.Subscribe(ctx, 8, PeerUp, PeerDown)
+	all := bus.Subscribe(ctx, 8)
+
+	for _, eventType := range []Type{PeerUp, RequestForwarded, PeerDown} {
+		bus.Publish(Event{Type: eventType})
+	}
+
+	// The IDs are shared by every type, the gap tells that an event of another type was published
+	for _, expected := range []Event{{ID: 1, Type: PeerUp}, {ID: 3, Type: PeerDown}} {
+		if event := receive(t, peers); event.ID != expected.ID || event.Type != expected.Type {
+			t.Fatalf("received %s %d, expected %s %d", event.Type, event.ID, expected.Type, expected.ID)
+		}
+	}
+	for id := uint64(1); id <= 3; id++ {
+		if event := receive(t, all); event.ID != id {
+			t.Fatalf("received event %d, expected %d", event.ID, id)
+		}
+	}
+}
+
+func TestSlowSubscriberMissesEvents(t *testing.T) {
+	bus := NewBus()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	slow := bus.Subscribe(ctx, 1)
+	fast := bus.Subscribe(ctx, 8)
+
+	// Publishing does not wait for the slow subscriber, which keeps the first event only
+	for i := 0; i < 3; i++ {
+		bus.Publish(Event{Type: RequestPositive})
+	}
+	if event := receive(t, slow); event.ID != 1 {
+		t.Fatalf("slow subscriber received event %d, expected 1", event.ID)
+	}
+	bus.Publish(Event{Type: RequestPositive})
+	if event := receive(t, slow); event.ID != 4 {
+		t.Fatalf("slow subscriber received event %d after the gap, expected 4", event.ID)
+	}
+
+	// The other subscribers are not affected
+	for id := uint64(1); id <= 4; id++ {
+		if event := receive(t, fast); event.ID != id {
+			t.Fatalf("fast subscriber received event %d, expected %d", event.ID, id)
+		}
+	}
+}
+
+func TestSubscriptionClosedWithContext(t *testing.T) {
+	bus := NewBus()
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := bus.Subscribe(ctx, 8)
+	bus.Publish(Event{Type: RequestTimedOut})
+	cancel()
+
+	// The events waiting are still delivered, then the channel is closed
+	deadline := time.After(time.Second)
+	for open := true; open; {
+		select {
+		case _, open = <-stream:
+		case <-deadline:
+			t.Fatal("subscription not closed after its context was cancelled")
+		}
+	}
+
+	// Publishing after the subscriber left does not reach it
+	bus.Publish(Event{Type: RequestTimedOut})
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	if len(bus.subscribers) != 0 {
+		t.Fatalf("%d subscribers left", len(bus.subscribers))
+	}
+}
+
+func TestParseType(t *testing.T) {
+	for _, eventType := range Types {
+		if parsed, valid := ParseType(string(eventType)); !valid || parsed != eventType {
+			t.Fatalf("ParseType(%q) returned %q, %v", eventType, parsed, valid)
+		}
+	}
+	if _, valid := ParseType("request"); valid {
+		t.Fatal("unknown type accepted")
+	}
+}
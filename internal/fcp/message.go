@@ -0,0 +1,139 @@
+package fcp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxLineLength bounds the length of a line of a message, name or field.
+const maxLineLength = 64 << 10
+
+// maxFields bounds the number of fields of a message.
+const maxFields = 256
+
+// errLineTooLong is returned when a line of a message exceeds maxLineLength.
+var errLineTooLong = errors.New("line too long")
+
+// Message is an FCP message: a name, fields and, for some messages, a payload.
+//
+//	ClientGet
+//	Identifier=my-request
+//	URI=CHK@...
+//	EndMessage
+//
+// A message carrying a payload ends with "Data" instead of "EndMessage", followed by DataLength bytes.
+type Message struct {
+	Name   string
+	Fields map[string]string
+	Data   []byte // Payload, nil when the message has none
+}
+
+// newMessage creates a message with the given fields, as name and value pairs.
+func newMessage(name string, fields ...string) *Message {
+	message := &Message{Name: name, Fields: make(map[string]string, len(fields)/2)}
+	for i := 0; i+1 < len(fields); i += 2 {
+		message.Fields[fields[i]] = fields[i+1]
+	}
+	return message
+}
+
+// readMessage reads the next message from a connection. Empty lines between messages are skipped.
+// The payload of a message is limited to maxData bytes.
+func readMessage(reader *bufio.Reader, maxData int64) (*Message, error) {
+	var name string
+	for name == "" {
+		line, err := readLine(reader)
+		if err != nil {
+			return nil, err
+		}
+		name = line
+	}
+
+	message := &Message{Name: name, Fields: make(map[string]string)}
+	for {
+		line, err := readLine(reader)
+		if err != nil {
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		switch line {
+		case "EndMessage", "End":
+			return message, nil
+		case "Data":
+			length, err := strconv.ParseInt(message.Fields["DataLength"], 10, 64)
+			if err != nil || length < 0 {
+				return nil, &protocolError{code: errorParsingNumber, field: "DataLength", fatal: true}
+			}
+			if length > maxData {
+				return nil, &protocolError{code: invalidField, field: "DataLength", extra: fmt.Sprintf("payload larger than %d bytes", maxData), fatal: true}
+			}
+			message.Data = make([]byte, length)
+			if _, err := io.ReadFull(reader, message.Data); err != nil {
+				return nil, err
+			}
+			return message, nil
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found || key == "" {
+			return nil, &protocolError{code: messageParseError, extra: "invalid field line " + strconv.Quote(line), fatal: true}
+		}
+		if len(message.Fields) >= maxFields {
+			return nil, &protocolError{code: messageParseError, extra: "too many fields", fatal: true}
+		}
+		message.Fields[key] = value
+	}
+}
+
+// readLine reads a line without its line ending.
+func readLine(reader *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		line = append(line, chunk...)
+		if len(line) > maxLineLength {
+			return "", errLineTooLong
+		}
+		if !isPrefix {
+			return strings.TrimSpace(string(line)), nil
+		}
+	}
+}
+
+// write writes the message in the wire format, fields sorted by name.
+func (message *Message) write(writer io.Writer) error {
+	var builder strings.Builder
+	builder.WriteString(message.Name + "\n")
+
+	keys := make([]string, 0, len(message.Fields))
+	for key := range message.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		builder.WriteString(key + "=" + message.Fields[key] + "\n")
+	}
+
+	if message.Data == nil {
+		builder.WriteString("EndMessage\n")
+		_, err := io.WriteString(writer, builder.String())
+		return err
+	}
+	builder.WriteString("Data\n")
+	if _, err := io.WriteString(writer, builder.String()); err != nil {
+		return err
+	}
+	_, err := writer.Write(message.Data)
+	return err
+}
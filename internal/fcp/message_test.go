@@ -0,0 +1,101 @@
+package fcp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		message *Message
+	}{
+		{"fields only", newMessage("ClientGet", "Identifier", "get-1", "URI", "CHK@key")},
+		{"payload", &Message{Name: "ClientPut", Fields: map[string]string{"DataLength": "5"}, Data: []byte("hello")}},
+		{"empty payload", &Message{Name: "ClientPut", Fields: map[string]string{"DataLength": "0"}, Data: []byte{}}},
+	}
+
+	var wire bytes.Buffer
+	for _, test := range tests {
+		if err := test.message.write(&wire); err != nil {
+			t.Fatalf("%s: write: %v", test.name, err)
+		}
+	}
+
+	// Messages written back to back are read one at a time
+	reader := bufio.NewReader(&wire)
+	for _, test := range tests {
+		message, err := readMessage(reader, maxDataLength)
+		if err != nil {
+			t.Fatalf("%s: readMessage: %v", test.name, err)
+		}
+		if message.Name != test.message.Name || len(message.Fields) != len(test.message.Fields) {
+			t.Fatalf("%s: read %+v, expected %+v", test.name, message, test.message)
+		}
+		for key, value := range test.message.Fields {
+			if message.Fields[key] != value {
+				t.Fatalf("%s: field %s is %q, expected %q", test.name, key, message.Fields[key], value)
+			}
+		}
+		if !bytes.Equal(message.Data, test.message.Data) || (message.Data == nil) != (test.message.Data == nil) {
+			t.Fatalf("%s: payload %q, expected %q", test.name, message.Data, test.message.Data)
+		}
+	}
+	if _, err := readMessage(reader, maxDataLength); err != io.EOF {
+		t.Fatalf("readMessage after the last message returned %v, expected io.EOF", err)
+	}
+}
+
+func TestReadMessageToleratesBlankLines(t *testing.T) {
+	wire := "\r\n\nClientHello\r\nName = ignored spaces \r\nExpectedVersion=2.0\r\nEnd\r\n"
+	message, err := readMessage(bufio.NewReader(strings.NewReader(wire)), maxDataLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Name != "ClientHello" || message.Fields["ExpectedVersion"] != "2.0" {
+		t.Fatalf("read %+v", message)
+	}
+}
+
+func TestReadMessageErrors(t *testing.T) {
+	var manyFields string
+	for i := 0; i <= maxFields; i++ {
+		manyFields += "Field" + strconv.Itoa(i) + "=value\n"
+	}
+
+	tests := []struct {
+		name string
+		wire string
+		code int // Code of the ProtocolError, 0 when the error is not reported to the client
+		err  error
+	}{
+		{"field without value", "ClientGet\nIdentifier\nEndMessage\n", messageParseError, nil},
+		{"field without name", "ClientGet\n=value\nEndMessage\n", messageParseError, nil},
+		{"too many fields", "ClientGet\n" + manyFields, messageParseError, nil},
+		{"payload without length", "ClientPut\nData\n", errorParsingNumber, nil},
+		{"negative payload length", "ClientPut\nDataLength=-1\nData\n", errorParsingNumber, nil},
+		{"oversize payload", "ClientPut\nDataLength=11\nData\n", invalidField, nil},
+		{"truncated payload", "ClientPut\nDataLength=10\nData\nshort", 0, io.ErrUnexpectedEOF},
+		{"truncated message", "ClientGet\nIdentifier=get-1\n", 0, io.ErrUnexpectedEOF},
+		{"line too long", "ClientGet\nURI=" + strings.Repeat("a", maxLineLength) + "\n", 0, errLineTooLong},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := readMessage(bufio.NewReader(strings.NewReader(test.wire)), 10)
+			var protocolErr *protocolError
+			if test.code != 0 {
+				if !errors.As(err, &protocolErr) || protocolErr.code != test.code || !protocolErr.fatal {
+					t.Fatalf("readMessage returned %v, expected a fatal ProtocolError %d", err, test.code)
+				}
+			} else if !errors.Is(err, test.err) {
+				t.Fatalf("readMessage returned %v, expected %v", err, test.err)
+			}
+		})
+	}
+}
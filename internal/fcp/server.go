@@ -0,0 +1,433 @@
+// Package fcp serves a subset of FCPv2, the client protocol of Freenet, so that tools written for it can drive the node.
+// Only ClientHello, ClientGet and ClientPut are supported, any other message is answered with a ProtocolError.
+package fcp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"freenet/internal/configs"
+	"freenet/internal/keys"
+	"freenet/internal/logger"
+	"freenet/internal/services"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Version is the FCP version announced in NodeHello.
+const Version = "2.0"
+
+// nodeName is the implementation announced in NodeHello, so that clients do not take the node for the reference one.
+const nodeName = "go-freenet"
+
+// maxDataLength bounds the size of the content of a ClientPut.
+const maxDataLength = 64 << 20
+
+// Codes of the ProtocolError messages, as defined by FCPv2.
+const (
+	clientHelloMustBeFirst = 1
+	noLateClientHellos     = 2
+	messageParseError      = 3
+	missingField           = 5
+	errorParsingNumber     = 6
+	invalidMessage         = 7
+	invalidField           = 8
+	identifierCollision    = 14
+	notSupported           = 16
+)
+
+// protocolErrorDescriptions are the descriptions of the ProtocolError codes.
+var protocolErrorDescriptions = map[int]string{
+	clientHelloMustBeFirst: "Client must say hello first",
+	noLateClientHellos:     "No late ClientHello's accepted",
+	messageParseError:      "Error parsing message",
+	missingField:           "Missing field",
+	errorParsingNumber:     "Error parsing a numeric field",
+	invalidMessage:         "Don't know what to do with message",
+	invalidField:           "Invalid field value",
+	identifierCollision:    "Identifier collision",
+	notSupported:           "Operation not supported",
+}
+
+// protocolError is an error reported to the client as a ProtocolError message.
+type protocolError struct {
+	code       int
+	field      string // Field at fault, if any
+	extra      string // Details on the error
+	identifier string // Identifier of the request at fault, if any
+	fatal      bool   // Whether the connection is closed after the error
+}
+
+func (e *protocolError) Error() string {
+	description := protocolErrorDescriptions[e.code]
+	if e.field != "" {
+		description += ": " + e.field
+	}
+	if e.extra != "" {
+		description += " (" + e.extra + ")"
+	}
+	return description
+}
+
+// message returns the ProtocolError message reporting the error.
+func (e *protocolError) message() *Message {
+	message := newMessage("ProtocolError",
+		"Code", strconv.Itoa(e.code),
+		"CodeDescription", protocolErrorDescriptions[e.code],
+		"Fatal", strconv.FormatBool(e.fatal),
+		"Global", "false",
+	)
+	extra := e.extra
+	if e.field != "" {
+		extra = strings.TrimSpace(e.field + " " + extra)
+	}
+	if extra != "" {
+		message.Fields["ExtraDescription"] = extra
+	}
+	if e.identifier != "" {
+		message.Fields["Identifier"] = e.identifier
+	}
+	return message
+}
+
+// Start serves FCP on the configured address until the context is cancelled.
+// It does nothing when the FCP port is 0.
+func Start(ctx context.Context, config configs.FCPConfig) error {
+	if config.Port == 0 {
+		return nil
+	}
+	if config.Port < 0 || config.Port > 65535 {
+		return fmt.Errorf("invalid FCP port: %d", config.Port)
+	}
+
+	address := net.JoinHostPort(config.Address, strconv.Itoa(config.Port))
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to start the FCP server on %s: %v", address, err)
+	}
+	if ip := net.ParseIP(config.Address); ip == nil || !ip.IsLoopback() {
+		logger.GlobalLogger.Warn("The FCP server has no authentication and listens on " + address + ", reachable from other hosts")
+	}
+
+	// Closing the listener unblocks the pending Accept on shutdown
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				logger.GlobalLogger.Error("Error accepting FCP connection: " + err.Error())
+				continue
+			}
+			go newSession(ctx, conn).run()
+		}
+	}()
+
+	logger.GlobalLogger.Info("FCP server listening on " + address)
+	return nil
+}
+
+// session is the connection of an FCP client. Requests run concurrently, their replies are written one at a time.
+type session struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	conn    net.Conn
+	writeMu sync.Mutex
+	hello   bool // Whether the client has sent its ClientHello
+
+	requestsMu sync.Mutex
+	requests   map[string]bool // Identifiers of the requests running
+}
+
+// newSession creates the session of a new FCP connection, cancelled when the connection closes or the node stops.
+func newSession(ctx context.Context, conn net.Conn) *session {
+	ctx, cancel := context.WithCancel(ctx)
+	return &session{ctx: ctx, cancel: cancel, conn: conn, requests: make(map[string]bool)}
+}
+
+// startRequest reserves the identifier of a new request, refusing it if a request of the session already uses it.
+func (s *session) startRequest(identifier string) error {
+	s.requestsMu.Lock()
+	defer s.requestsMu.Unlock()
+	if s.requests[identifier] {
+		return &protocolError{code: identifierCollision, extra: "a request with this identifier is still running", identifier: identifier}
+	}
+	s.requests[identifier] = true
+	return nil
+}
+
+// finishRequest frees the identifier of a request before its last reply, so that the client can reuse it
+// as soon as it gets that reply.
+func (s *session) finishRequest(identifier string) {
+	s.requestsMu.Lock()
+	defer s.requestsMu.Unlock()
+	delete(s.requests, identifier)
+}
+
+// run reads and handles the messages of the client until the connection is closed.
+func (s *session) run() {
+	defer s.conn.Close()
+	defer s.cancel()
+
+	// Unblock the read on shutdown
+	go func() {
+		<-s.ctx.Done()
+		s.conn.Close()
+	}()
+
+	logger.GlobalLogger.Debug("New FCP connection from " + s.conn.RemoteAddr().String())
+	reader := bufio.NewReader(s.conn)
+	for {
+		message, err := readMessage(reader, maxDataLength)
+		if err != nil {
+			var protocolErr *protocolError
+			if errors.As(err, &protocolErr) {
+				s.send(protocolErr.message())
+			} else if err != io.EOF && s.ctx.Err() == nil {
+				logger.GlobalLogger.Debug("FCP connection from " + s.conn.RemoteAddr().String() + " failed: " + err.Error())
+			}
+			return
+		}
+
+		if err := s.handle(message); err != nil {
+			var protocolErr *protocolError
+			if !errors.As(err, &protocolErr) {
+				logger.GlobalLogger.Debug("FCP connection from " + s.conn.RemoteAddr().String() + " failed: " + err.Error())
+				return
+			}
+			logger.GlobalLogger.Warn("FCP " + message.Name + " from " + s.conn.RemoteAddr().String() + " refused: " + protocolErr.Error())
+			if err := s.send(protocolErr.message()); err != nil || protocolErr.fatal {
+				return
+			}
+		}
+	}
+}
+
+// handle dispatches a message to the handler of its name.
+func (s *session) handle(message *Message) error {
+	if !s.hello && message.Name != "ClientHello" {
+		return &protocolError{code: clientHelloMustBeFirst, fatal: true}
+	}
+
+	switch message.Name {
+	case "ClientHello":
+		return s.handleClientHello(message)
+	case "ClientGet":
+		return s.handleClientGet(message)
+	case "ClientPut":
+		return s.handleClientPut(message)
+	default:
+		return &protocolError{code: invalidMessage, extra: "unsupported message " + message.Name, identifier: message.Fields["Identifier"]}
+	}
+}
+
+// handleClientHello answers the ClientHello opening the session with a NodeHello.
+func (s *session) handleClientHello(message *Message) error {
+	if s.hello {
+		return &protocolError{code: noLateClientHellos}
+	}
+	if message.Fields["Name"] == "" {
+		return &protocolError{code: missingField, field: "Name", fatal: true}
+	}
+	if message.Fields["ExpectedVersion"] == "" {
+		return &protocolError{code: missingField, field: "ExpectedVersion", fatal: true}
+	}
+	s.hello = true
+
+	logger.GlobalLogger.Info("FCP client " + message.Fields["Name"] + " connected from " + s.conn.RemoteAddr().String())
+	return s.send(newMessage("NodeHello",
+		"FCPVersion", Version,
+		"Node", nodeName,
+		"Version", nodeName+","+strconv.Itoa(services.ProtocolVersion)+","+Version,
+		"Build", strconv.Itoa(services.ProtocolVersion),
+		"ConnectionIdentifier", uuid.New().String(),
+		"NodeID", services.Client.NodeID(),
+		"Testnet", "false",
+		"CompressionCodecs", "0",
+	))
+}
+
+// handleClientGet fetches a file and returns its content in an AllData message, or only its size in a DataFound
+// message when ReturnType is none. Only direct and none return types are supported.
+func (s *session) handleClientGet(message *Message) error {
+	identifier, uri := message.Fields["Identifier"], message.Fields["URI"]
+	if identifier == "" {
+		return &protocolError{code: missingField, field: "Identifier"}
+	}
+	if uri == "" {
+		return &protocolError{code: missingField, field: "URI", identifier: identifier}
+	}
+
+	returnType := message.Fields["ReturnType"]
+	if returnType == "" {
+		returnType = "direct"
+	}
+	if returnType != "direct" && returnType != "none" {
+		return &protocolError{code: notSupported, extra: "ReturnType " + returnType + ", only direct and none are supported", identifier: identifier}
+	}
+
+	maxSize := int64(-1)
+	if value, exists := message.Fields["MaxSize"]; exists {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size < 0 {
+			return &protocolError{code: errorParsingNumber, field: "MaxSize", identifier: identifier}
+		}
+		maxSize = size
+	}
+
+	// The fetch runs in the background so that the client can send other requests meanwhile
+	if err := s.startRequest(identifier); err != nil {
+		return err
+	}
+	go func() {
+		data, _, err := services.Client.Fetch(s.ctx, uri)
+		s.finishRequest(identifier)
+		if err != nil {
+			s.send(getFailed(identifier, uri, err))
+			return
+		}
+		if maxSize >= 0 && int64(len(data)) > maxSize {
+			s.send(newMessage("GetFailed",
+				"Identifier", identifier,
+				"Code", "21",
+				"CodeDescription", "Too big",
+				"ExpectedDataLength", strconv.Itoa(len(data)),
+				"Fatal", "true",
+				"Global", "false",
+			))
+			return
+		}
+
+		s.send(newMessage("DataFound",
+			"Identifier", identifier,
+			"DataLength", strconv.Itoa(len(data)),
+			"Metadata.ContentType", "application/octet-stream",
+			"Global", "false",
+		))
+		if returnType == "direct" {
+			allData := newMessage("AllData",
+				"Identifier", identifier,
+				"DataLength", strconv.Itoa(len(data)),
+				"Global", "false",
+			)
+			allData.Data = data
+			s.send(allData)
+		}
+	}()
+	return nil
+}
+
+// getFailed returns the GetFailed message reporting why a fetch failed, with the codes of FCPv2.
+func getFailed(identifier, uri string, err error) *Message {
+	code, description := 17, "Internal error"
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		code, description = 13, "Data not found"
+	case errors.Is(err, services.ErrRouteNotFound):
+		code, description = 14, "Route not found"
+	case errors.Is(err, services.ErrTimedOut):
+		code, description = 18, "Transfer failed"
+	case errors.Is(err, services.ErrContentUnavailable):
+		code, description = 28, "All data not found"
+	case errors.Is(err, keys.ErrDecryption), errors.Is(err, keys.ErrHashMismatch), errors.Is(err, keys.ErrInvalidSignature):
+		code, description = 6, "Block decode error"
+	case errors.Is(err, context.Canceled):
+		code, description = 25, "Cancelled"
+	case !keys.IsUSK(uri):
+		if _, uriErr := keys.RoutingKey(uri); uriErr != nil {
+			code, description = 20, "Invalid URI"
+		}
+	}
+
+	return newMessage("GetFailed",
+		"Identifier", identifier,
+		"Code", strconv.Itoa(code),
+		"CodeDescription", description,
+		"ExtraDescription", err.Error(),
+		"Fatal", "true",
+		"Global", "false",
+	)
+}
+
+// handleClientPut inserts the content of the message under its content hash key and returns the key in URIGenerated
+// and PutSuccessful messages. Only CHK@ inserts with the content sent directly are supported.
+func (s *session) handleClientPut(message *Message) error {
+	identifier, uri := message.Fields["Identifier"], message.Fields["URI"]
+	if identifier == "" {
+		return &protocolError{code: missingField, field: "Identifier"}
+	}
+	if uri == "" {
+		return &protocolError{code: missingField, field: "URI", identifier: identifier}
+	}
+	if uploadFrom := message.Fields["UploadFrom"]; uploadFrom != "" && uploadFrom != "direct" {
+		return &protocolError{code: notSupported, extra: "UploadFrom " + uploadFrom + ", only direct is supported", identifier: identifier}
+	}
+	if message.Data == nil {
+		return &protocolError{code: missingField, field: "DataLength", identifier: identifier}
+	}
+
+	if err := s.startRequest(identifier); err != nil {
+		return err
+	}
+
+	// The node inserts signed keys with key pair files, an FCP client can only insert content under its hash
+	if uri != keys.CHKPrefix && !strings.HasPrefix(uri, keys.CHKPrefix+"/") {
+		s.finishRequest(identifier)
+		return s.send(newMessage("PutFailed",
+			"Identifier", identifier,
+			"Code", "1",
+			"CodeDescription", "Caller supplied a URI we cannot use",
+			"ExtraDescription", "only CHK@ inserts are supported",
+			"Fatal", "true",
+			"Global", "false",
+		))
+	}
+
+	go func() {
+		result, err := services.Client.Insert(s.ctx, "", message.Data)
+		s.finishRequest(identifier)
+		if err != nil {
+			code, description := 3, "Internal error"
+			switch {
+			case errors.Is(err, services.ErrRouteNotFound), errors.Is(err, services.ErrNotFound), errors.Is(err, services.ErrTimedOut):
+				code, description = 5, "Route not found"
+			case errors.Is(err, services.ErrKeyCollision):
+				code, description = 9, "Insert collided with different, pre-existing data at the same key"
+			case errors.Is(err, context.Canceled):
+				code, description = 10, "Cancelled by caller"
+			}
+			s.send(newMessage("PutFailed",
+				"Identifier", identifier,
+				"Code", strconv.Itoa(code),
+				"CodeDescription", description,
+				"ExtraDescription", err.Error(),
+				"Fatal", "true",
+				"Global", "false",
+			))
+			return
+		}
+
+		s.send(newMessage("URIGenerated", "Identifier", identifier, "URI", result.Key, "Global", "false"))
+		s.send(newMessage("PutSuccessful", "Identifier", identifier, "URI", result.Key, "Global", "false"))
+	}()
+	return nil
+}
+
+// send writes a message to the client.
+func (s *session) send(message *Message) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return message.write(s.conn)
+}
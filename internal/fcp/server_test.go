@@ -0,0 +1,158 @@
+package fcp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+
+	"freenet/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	logger.GlobalLogger = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+// fcpClient is the client end of a session, sending raw messages and reading the replies.
+type fcpClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// startSession runs a session over a pipe until the end of the test and returns its client end.
+func startSession(t *testing.T) *fcpClient {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	go newSession(ctx, serverConn).run()
+	t.Cleanup(func() {
+		cancel()
+		clientConn.Close()
+	})
+	return &fcpClient{conn: clientConn, reader: bufio.NewReader(clientConn)}
+}
+
+// exchange sends a message in the wire format and reads the reply.
+func (c *fcpClient) exchange(t *testing.T, wire string) *Message {
+	t.Helper()
+	if _, err := io.WriteString(c.conn, wire); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	reply, err := readMessage(c.reader, maxDataLength)
+	if err != nil {
+		t.Fatalf("reading the reply to %q: %v", wire, err)
+	}
+	return reply
+}
+
+// expectProtocolError checks that a reply is a ProtocolError with the given code.
+func expectProtocolError(t *testing.T, reply *Message, code int, fatal bool) {
+	t.Helper()
+	if reply.Name != "ProtocolError" || reply.Fields["Code"] != strconv.Itoa(code) || reply.Fields["Fatal"] != strconv.FormatBool(fatal) {
+		t.Fatalf("received %s %v, expected a ProtocolError %d with Fatal=%v", reply.Name, reply.Fields, code, fatal)
+	}
+}
+
+const clientHello = "ClientHello\nName=test\nExpectedVersion=2.0\nEndMessage\n"
+
+func TestClientHelloMustBeFirst(t *testing.T) {
+	client := startSession(t)
+	expectProtocolError(t, client.exchange(t, "ClientGet\nIdentifier=get-1\nURI=CHK@key\nEndMessage\n"), clientHelloMustBeFirst, true)
+
+	// The session is over
+	if _, err := readMessage(client.reader, maxDataLength); err != io.EOF {
+		t.Fatalf("read after a fatal error returned %v, expected io.EOF", err)
+	}
+}
+
+func TestNodeHello(t *testing.T) {
+	client := startSession(t)
+	reply := client.exchange(t, clientHello)
+	if reply.Name != "NodeHello" || reply.Fields["FCPVersion"] != Version || reply.Fields["Node"] != nodeName {
+		t.Fatalf("received %s %v, expected a NodeHello", reply.Name, reply.Fields)
+	}
+	if reply.Fields["ConnectionIdentifier"] == "" {
+		t.Fatal("NodeHello has no connection identifier")
+	}
+	expectProtocolError(t, client.exchange(t, clientHello), noLateClientHellos, false)
+}
+
+func TestClientHelloMissingFields(t *testing.T) {
+	client := startSession(t)
+	reply := client.exchange(t, "ClientHello\nName=test\nEndMessage\n")
+	expectProtocolError(t, reply, missingField, true)
+	if reply.Fields["ExtraDescription"] != "ExpectedVersion" {
+		t.Fatalf("missing field reported as %q", reply.Fields["ExtraDescription"])
+	}
+}
+
+func TestInvalidRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		wire       string
+		code       int
+		identifier string
+	}{
+		{"unsupported message", "ListPeers\nIdentifier=list-1\nEndMessage\n", invalidMessage, "list-1"},
+		{"get without identifier", "ClientGet\nURI=CHK@key\nEndMessage\n", missingField, ""},
+		{"get without URI", "ClientGet\nIdentifier=get-1\nEndMessage\n", missingField, "get-1"},
+		{"get to disk", "ClientGet\nIdentifier=get-1\nURI=CHK@key\nReturnType=disk\nEndMessage\n", notSupported, "get-1"},
+		{"get with invalid maximum size", "ClientGet\nIdentifier=get-1\nURI=CHK@key\nMaxSize=big\nEndMessage\n", errorParsingNumber, "get-1"},
+		{"put from disk", "ClientPut\nIdentifier=put-1\nURI=CHK@\nUploadFrom=disk\nEndMessage\n", notSupported, "put-1"},
+		{"put without content", "ClientPut\nIdentifier=put-1\nURI=CHK@\nEndMessage\n", missingField, "put-1"},
+	}
+
+	// The errors are not fatal, every request goes through the same session
+	client := startSession(t)
+	client.exchange(t, clientHello)
+	for _, test := range tests {
+		reply := client.exchange(t, test.wire)
+		expectProtocolError(t, reply, test.code, false)
+		if reply.Fields["Identifier"] != test.identifier {
+			t.Fatalf("%s: error reported for identifier %q, expected %q", test.name, reply.Fields["Identifier"], test.identifier)
+		}
+	}
+}
+
+func TestPutOfSignedKeyRefused(t *testing.T) {
+	client := startSession(t)
+	client.exchange(t, clientHello)
+
+	for i := 0; i < 2; i++ {
+		reply := client.exchange(t, "ClientPut\nIdentifier=put-1\nURI=SSK@key\nDataLength=5\nData\nhello")
+		if reply.Name != "PutFailed" || reply.Fields["Identifier"] != "put-1" || reply.Fields["Code"] != "1" {
+			t.Fatalf("attempt %d: received %s %v, expected a PutFailed", i, reply.Name, reply.Fields)
+		}
+	}
+}
+
+func TestIdentifierCollision(t *testing.T) {
+	s := newSession(context.Background(), nil)
+	if err := s.startRequest("get-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.startRequest("get-2"); err != nil {
+		t.Fatalf("another identifier refused: %v", err)
+	}
+
+	var protocolErr *protocolError
+	if err := s.startRequest("get-1"); !errors.As(err, &protocolErr) || protocolErr.code != identifierCollision || protocolErr.fatal {
+		t.Fatalf("startRequest of a running identifier returned %v, expected a ProtocolError %d", err, identifierCollision)
+	}
+	if message := protocolErr.message(); message.Fields["Identifier"] != "get-1" {
+		t.Fatalf("collision reported for identifier %q", message.Fields["Identifier"])
+	}
+
+	// Once the request has finished, its identifier can be reused
+	s.finishRequest("get-1")
+	if err := s.startRequest("get-1"); err != nil {
+		t.Fatalf("identifier of a finished request refused: %v", err)
+	}
+}
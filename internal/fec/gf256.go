@@ -0,0 +1,52 @@
+package fec
+
+// Arithmetic in GF(2^8) with the polynomial x^8 + x^4 + x^3 + x^2 + 1, through logarithm tables.
+// Addition and subtraction are both XOR.
+
+const gfPolynomial = 0x11d
+
+var (
+	gfExp [512]byte // gfExp[i] = 2^i, doubled so that the sum of two logarithms needs no modulo
+	gfLog [256]byte // gfLog[2^i] = i, gfLog[0] is unused
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= gfPolynomial
+		}
+	}
+	for i := 255; i < len(gfExp); i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+// gfMul multiplies two elements.
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+// gfInv returns the multiplicative inverse of a non-zero element.
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+// gfMulAdd adds coefficient * in to out, byte by byte.
+func gfMulAdd(out, in []byte, coefficient byte) {
+	if coefficient == 0 {
+		return
+	}
+	logCoefficient := int(gfLog[coefficient])
+	for i, b := range in {
+		if b != 0 {
+			out[i] ^= gfExp[logCoefficient+int(gfLog[b])]
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Package fec implements a systematic Reed-Solomon erasure code: data shards are kept as they are and
+// check shards are added, so that the data can be rebuilt from any subset of shards as large as the data.
+package fec
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxShards is the maximum number of data and check shards of a code, bounded by the size of GF(2^8).
+const MaxShards = 256
+
+// ErrTooFewShards is returned when not enough shards are left to rebuild the data.
+var ErrTooFewShards = errors.New("too few shards to rebuild the data")
+
+// Code encodes a fixed number of data shards into check shards.
+type Code struct {
+	dataShards  int
+	checkShards int
+	matrix      [][]byte // Rows of the check shards: a Cauchy matrix, whose square submatrices are all invertible
+}
+
+// New creates a code adding checkShards check shards to dataShards data shards.
+func New(dataShards, checkShards int) (*Code, error) {
+	if dataShards <= 0 || checkShards < 0 || dataShards+checkShards > MaxShards {
+		return nil, fmt.Errorf("invalid code with %d data shards and %d check shards", dataShards, checkShards)
+	}
+
+	// Check row i and data column j hold 1 / (x_i + y_j), with x_i = dataShards + i and y_j = j all distinct
+	matrix := make([][]byte, checkShards)
+	for i := range matrix {
+		matrix[i] = make([]byte, dataShards)
+		for j := range matrix[i] {
+			matrix[i][j] = gfInv(byte(dataShards+i) ^ byte(j))
+		}
+	}
+	return &Code{dataShards: dataShards, checkShards: checkShards, matrix: matrix}, nil
+}
+
+// Encode returns the check shards of the data shards, which must all have the same length.
+func (c *Code) Encode(data [][]byte) ([][]byte, error) {
+	if len(data) != c.dataShards {
+		return nil, fmt.Errorf("expected %d data shards, got %d", c.dataShards, len(data))
+	}
+	size := len(data[0])
+	for _, shard := range data {
+		if len(shard) != size {
+			return nil, errors.New("data shards must have the same length")
+		}
+	}
+
+	check := make([][]byte, c.checkShards)
+	for i, row := range c.matrix {
+		check[i] = make([]byte, size)
+		for j, shard := range data {
+			gfMulAdd(check[i], shard, row[j])
+		}
+	}
+	return check, nil
+}
+
+// Reconstruct rebuilds the missing data shards in place. shards holds the data shards followed by the check shards,
+// missing shards being nil. At least as many shards as data shards must be present.
+func (c *Code) Reconstruct(shards [][]byte) error {
+	if len(shards) != c.dataShards+c.checkShards {
+		return fmt.Errorf("expected %d shards, got %d", c.dataShards+c.checkShards, len(shards))
+	}
+
+	missing := false
+	for _, shard := range shards[:c.dataShards] {
+		if shard == nil {
+			missing = true
+		}
+	}
+	if !missing {
+		return nil
+	}
+
+	// Pick the first shards present, data shards first, with their row of the generator matrix
+	rows := make([][]byte, 0, c.dataShards)
+	present := make([][]byte, 0, c.dataShards)
+	size := -1
+	for index, shard := range shards {
+		if shard == nil {
+			continue
+		}
+		if size >= 0 && len(shard) != size {
+			return errors.New("shards must have the same length")
+		}
+		size = len(shard)
+		rows = append(rows, c.generatorRow(index))
+		present = append(present, shard)
+		if len(rows) == c.dataShards {
+			break
+		}
+	}
+	if len(rows) < c.dataShards {
+		return fmt.Errorf("%w: %d of %d", ErrTooFewShards, len(rows), c.dataShards)
+	}
+
+	// The present shards are rows * data, so the data is the inverse of rows times the present shards
+	inverse, err := invert(rows)
+	if err != nil {
+		return err
+	}
+	for j := range shards[:c.dataShards] {
+		if shards[j] != nil {
+			continue
+		}
+		shard := make([]byte, size)
+		for k, coefficient := range inverse[j] {
+			gfMulAdd(shard, present[k], coefficient)
+		}
+		shards[j] = shard
+	}
+	return nil
+}
+
+// generatorRow returns the row of a shard in the generator matrix: the identity for data shards,
+// the Cauchy matrix for check shards.
+func (c *Code) generatorRow(index int) []byte {
+	if index >= c.dataShards {
+		return c.matrix[index-c.dataShards]
+	}
+	row := make([]byte, c.dataShards)
+	row[index] = 1
+	return row
+}
+
+// invert inverts a square matrix by Gauss-Jordan elimination.
+func invert(matrix [][]byte) ([][]byte, error) {
+	n := len(matrix)
+
+	// Work on [matrix | identity] until it becomes [identity | inverse]
+	work := make([][]byte, n)
+	for i, row := range matrix {
+		work[i] = make([]byte, 2*n)
+		copy(work[i], row)
+		work[i][n+i] = 1
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := col
+		for pivot < n && work[pivot][col] == 0 {
+			pivot++
+		}
+		if pivot == n {
+			return nil, errors.New("singular matrix")
+		}
+		work[col], work[pivot] = work[pivot], work[col]
+
+		// Scale the pivot row to 1, then clear the column in every other row
+		scale := gfInv(work[col][col])
+		for k := range work[col] {
+			work[col][k] = gfMul(work[col][k], scale)
+		}
+		for row := 0; row < n; row++ {
+			if row != col && work[row][col] != 0 {
+				gfMulAdd(work[row], work[col], work[row][col])
+			}
+		}
+	}
+
+	inverse := make([][]byte, n)
+	for i := range work {
+		inverse[i] = work[i][n:]
+	}
+	return inverse, nil
+}
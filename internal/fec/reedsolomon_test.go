@@ -0,0 +1,92 @@
+package fec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestReconstruct(t *testing.T) {
+	tests := []struct {
+		dataShards, checkShards int
+	}{
+		{1, 0}, {1, 1}, {3, 2}, {4, 4}, {10, 5}, {128, 64}, {128, 128}, {200, 56},
+	}
+
+	random := rand.New(rand.NewSource(1))
+	for _, test := range tests {
+		code, err := New(test.dataShards, test.checkShards)
+		if err != nil {
+			t.Fatalf("New(%d, %d): %v", test.dataShards, test.checkShards, err)
+		}
+		data := make([][]byte, test.dataShards)
+		for i := range data {
+			data[i] = make([]byte, 64)
+			random.Read(data[i])
+		}
+		check, err := code.Encode(data)
+		if err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		original := append(data, check...)
+
+		// The shards are erased from the start, from the end or anywhere, a shard too many cannot be recovered
+		perm := random.Perm(len(original))
+		patterns := map[string]func(i int) int{
+			"first":  func(i int) int { return i },
+			"last":   func(i int) int { return len(original) - 1 - i },
+			"random": func(i int) int { return perm[i] },
+		}
+		step := max(1, test.checkShards/4)
+		for erased := 0; erased <= test.checkShards+step; erased += step {
+			erased := min(erased, test.checkShards+1)
+			for pattern, index := range patterns {
+				t.Run(fmt.Sprintf("%d+%d/%d %s", test.dataShards, test.checkShards, erased, pattern), func(t *testing.T) {
+					shards := append([][]byte{}, original...)
+					for i := 0; i < erased; i++ {
+						shards[index(i)] = nil
+					}
+
+					err := code.Reconstruct(shards)
+					if erased > test.checkShards {
+						if !errors.Is(err, ErrTooFewShards) {
+							t.Fatalf("Reconstruct returned %v, expected ErrTooFewShards", err)
+						}
+						return
+					}
+					if err != nil {
+						t.Fatalf("Reconstruct: %v", err)
+					}
+					for i := range data {
+						if !bytes.Equal(shards[i], original[i]) {
+							t.Fatalf("data shard %d differs after reconstruction", i)
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestReconstructRejectsMismatchedShards(t *testing.T) {
+	code, err := New(2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := code.Reconstruct([][]byte{nil, {1, 2}, {3}, {4, 5}}); err == nil {
+		t.Fatal("Reconstruct accepted shards of different lengths")
+	}
+	if err := code.Reconstruct([][]byte{nil, {1}}); err == nil {
+		t.Fatal("Reconstruct accepted the wrong number of shards")
+	}
+}
+
+func TestNewRejectsInvalidCodes(t *testing.T) {
+	for _, shards := range [][2]int{{0, 1}, {-1, 1}, {1, -1}, {200, 57}} {
+		if _, err := New(shards[0], shards[1]); err == nil {
+			t.Errorf("New(%d, %d) accepted an invalid code", shards[0], shards[1])
+		}
+	}
+}
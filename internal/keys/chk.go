@@ -0,0 +1,94 @@
+package keys
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CHKPrefix is the prefix of content hash keys.
+const CHKPrefix = "CHK@"
+
+// ErrHashMismatch is returned when content does not hash to the key it was received for.
+var ErrHashMismatch = errors.New("content does not match its key")
+
+// ComputeCHK returns the content hash key of the data, derived from its SHA-256 hash.
+// It is the routing key under which the data is stored in the network.
+func ComputeCHK(data []byte) string {
+	sum := sha256.Sum256(data)
+	return CHKPrefix + encodeHash(sum[:])
+}
+
+// EncryptCHK encrypts data with a key derived from its content and returns the URI of the data,
+// CHK@<routing key>,<crypto key>, with the encrypted block to store under the routing key of the URI.
+// The crypto key is the hash of the data, so that the same data always gives the same URI.
+func EncryptCHK(data []byte) (string, []byte) {
+	cryptoKey := sha256.Sum256(data)
+	// The crypto key only ever encrypts this data, a fixed nonce is therefore safe
+	block := mustSeal(cryptoKey[:], make([]byte, nonceSize), data)
+	return ComputeCHK(block) + "," + encodeHash(cryptoKey[:]), block
+}
+
+// IsCHK tells whether the key is a content hash key.
+func IsCHK(key string) bool {
+	return strings.HasPrefix(key, CHKPrefix)
+}
+
+// ParseCHK returns the SHA-256 hash carried by a content hash key, with or without its crypto key.
+func ParseCHK(key string) ([]byte, error) {
+	routingKey, _, err := parseCHK(key)
+	return routingKey, err
+}
+
+// parseCHK returns the routing hash and the crypto key of a content hash key, the crypto key being nil
+// for the keys of unencrypted content.
+func parseCHK(key string) ([]byte, []byte, error) {
+	if !IsCHK(key) {
+		return nil, nil, fmt.Errorf("%q is not a CHK key", key)
+	}
+
+	routingPart, cryptoPart, encrypted := strings.Cut(strings.TrimPrefix(key, CHKPrefix), ",")
+	hash, err := base64.RawURLEncoding.DecodeString(routingPart)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CHK key %q: %v", key, err)
+	}
+	if len(hash) != sha256.Size {
+		return nil, nil, fmt.Errorf("invalid CHK key %q: hash is %d bytes long", key, len(hash))
+	}
+	if !encrypted {
+		return hash, nil, nil
+	}
+
+	cryptoKey, err := base64.RawURLEncoding.DecodeString(cryptoPart)
+	if err != nil || len(cryptoKey) != sha256.Size {
+		return nil, nil, fmt.Errorf("invalid crypto key in CHK key %q", key)
+	}
+	return hash, cryptoKey, nil
+}
+
+// decryptCHK decrypts a block stored under a content hash key and checks that it is the content of the key.
+func decryptCHK(key string, block []byte) ([]byte, error) {
+	_, cryptoKey, err := parseCHK(key)
+	if err != nil {
+		return nil, err
+	}
+	if cryptoKey == nil {
+		return block, nil
+	}
+
+	data, err := open(cryptoKey, make([]byte, nonceSize), block)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDecryption, key)
+	}
+	if sum := sha256.Sum256(data); string(sum[:]) != string(cryptoKey) {
+		return nil, fmt.Errorf("%w: %s", ErrHashMismatch, key)
+	}
+	return data, nil
+}
+
+// encodeHash encodes a hash for a key.
+func encodeHash(hash []byte) string {
+	return base64.RawURLEncoding.EncodeToString(hash)
+}
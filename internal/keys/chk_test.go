@@ -0,0 +1,78 @@
+package keys
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncryptCHKRoundTrip(t *testing.T) {
+	data := []byte("the content of a document")
+	uri, block := EncryptCHK(data)
+
+	routingKey, err := RoutingKey(uri)
+	if err != nil {
+		t.Fatalf("RoutingKey: %v", err)
+	}
+	if routingKey != ComputeCHK(block) || strings.Contains(routingKey, ",") {
+		t.Fatalf("routing key %s of %s is not the hash of the block alone", routingKey, uri)
+	}
+	if err := Verify(routingKey, block); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if bytes.Contains(block, data) {
+		t.Fatal("the block holds the document in clear")
+	}
+
+	decoded, err := Decode(uri, block)
+	if err != nil || !bytes.Equal(decoded, data) {
+		t.Fatalf("Decode returned %q, %v", decoded, err)
+	}
+
+	// The same content always gives the same key
+	if again, _ := EncryptCHK(data); again != uri {
+		t.Fatalf("content encrypted again under %s, expected %s", again, uri)
+	}
+}
+
+func TestCHKRejectsTamperedBlocks(t *testing.T) {
+	uri, block := EncryptCHK([]byte("the content of a document"))
+	routingKey, _ := RoutingKey(uri)
+	otherURI, otherBlock := EncryptCHK([]byte("another document"))
+
+	tampered := bytes.Clone(block)
+	tampered[0] ^= 1
+	if err := Verify(routingKey, tampered); !errors.Is(err, ErrHashMismatch) {
+		t.Fatalf("Verify of a tampered block returned %v, expected ErrHashMismatch", err)
+	}
+	if _, err := Decode(uri, tampered); !errors.Is(err, ErrDecryption) {
+		t.Fatalf("Decode of a tampered block returned %v, expected ErrDecryption", err)
+	}
+	if err := Verify(routingKey, otherBlock); !errors.Is(err, ErrHashMismatch) {
+		t.Fatalf("Verify of the block of another key returned %v, expected ErrHashMismatch", err)
+	}
+
+	// The crypto key of another document cannot open the block
+	_, otherCryptoKey, _ := strings.Cut(otherURI, ",")
+	if _, err := Decode(routingKey+","+otherCryptoKey, block); !errors.Is(err, ErrDecryption) {
+		t.Fatalf("Decode with the crypto key of another document returned %v, expected ErrDecryption", err)
+	}
+}
+
+func TestParseCHK(t *testing.T) {
+	uri, _ := EncryptCHK([]byte("content"))
+	routingKey, _ := RoutingKey(uri)
+
+	for _, key := range []string{uri, routingKey, ComputeCHK([]byte("plain content"))} {
+		if hash, err := ParseCHK(key); err != nil || len(hash) != 32 {
+			t.Errorf("ParseCHK(%q) returned %d bytes, %v", key, len(hash), err)
+		}
+	}
+
+	for _, key := range []string{"55", "CHK@", "CHK@not base64!", "CHK@c2hvcnQ", routingKey + ",c2hvcnQ"} {
+		if _, err := ParseCHK(key); err == nil {
+			t.Errorf("ParseCHK(%q) succeeded", key)
+		}
+	}
+}
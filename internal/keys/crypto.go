@@ -0,0 +1,40 @@
+package keys
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+)
+
+// nonceSize is the size of the nonces of AES-GCM.
+const nonceSize = 12
+
+// ErrDecryption is returned when content cannot be decrypted with the key of its URI.
+var ErrDecryption = errors.New("content cannot be decrypted")
+
+// newAEAD creates an AES-256-GCM cipher with a 32 bytes key.
+func newAEAD(key []byte) cipher.AEAD {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic("invalid AES key: " + err.Error())
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic("failed to create AES-GCM: " + err.Error())
+	}
+	return aead
+}
+
+// mustSeal encrypts and authenticates data with AES-256-GCM.
+func mustSeal(key, nonce, data []byte) []byte {
+	return newAEAD(key).Seal(nil, nonce, data, nil)
+}
+
+// open decrypts data sealed by mustSeal.
+func open(key, nonce, sealed []byte) ([]byte, error) {
+	data, err := newAEAD(key).Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return data, nil
+}
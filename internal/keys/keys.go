@@ -0,0 +1,67 @@
+package keys
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+// Verify checks that the data is the content stored under a routing key: the content of a CHK must hash to the key,
+// and the content of an SSK must be signed by the owner of its subspace.
+// Plain string keys carry no integrity information and are always accepted.
+func Verify(routingKey string, data []byte) error {
+	switch {
+	case IsCHK(routingKey):
+		return verifyCHK(routingKey, data)
+	case IsSSK(routingKey):
+		return verifySSK(routingKey, data)
+	default:
+		return nil
+	}
+}
+
+// RoutingKey returns the key the content of a URI is stored under in the network. The crypto key of a CHK and
+// the document name of an SSK are left out, so that the nodes storing the content cannot decrypt it.
+// Routing keys and plain string keys are returned as they are.
+func RoutingKey(key string) (string, error) {
+	switch {
+	case IsCHK(key):
+		hash, err := ParseCHK(key)
+		if err != nil {
+			return "", err
+		}
+		return CHKPrefix + encodeHash(hash), nil
+	case IsSSK(key) && !isSSKRoutingKey(key):
+		return sskRoutingKeyOf(key)
+	case IsUSK(key):
+		return "", fmt.Errorf("%q designates the editions of a document, each edition has its own routing key", key)
+	default:
+		return key, nil
+	}
+}
+
+// Decode returns the document designated by a URI from the data stored under its routing key,
+// decrypting it with the crypto key of a CHK or the document name of an SSK.
+func Decode(key string, data []byte) ([]byte, error) {
+	switch {
+	case IsCHK(key):
+		return decryptCHK(key, data)
+	case IsSSK(key) && !isSSKRoutingKey(key):
+		return decryptSSK(key, data)
+	default:
+		return data, nil
+	}
+}
+
+// verifyCHK checks that the data hashes to the content hash key.
+func verifyCHK(key string, data []byte) error {
+	hash, err := ParseCHK(key)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	if string(sum[:]) != string(hash) {
+		return fmt.Errorf("%w: %s", ErrHashMismatch, key)
+	}
+	return nil
+}
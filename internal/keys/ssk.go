@@ -0,0 +1,247 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// SSKPrefix is the prefix of signed subspace keys.
+const SSKPrefix = "SSK@"
+
+// ErrInvalidSignature is returned when signed content is missing its signature or is not signed by the owner of its key.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// KeyPair is the ed25519 identity owning a subspace.
+type KeyPair struct {
+	PublicKey  ed25519.PublicKey
+	PrivateKey ed25519.PrivateKey
+}
+
+// keyPairFile is the on-disk representation of a key pair.
+type keyPairFile struct {
+	PublicKey  string `yaml:"public_key"`  // Base64 encoded ed25519 public key
+	PrivateKey string `yaml:"private_key"` // Base64 encoded ed25519 private key
+}
+
+// SignedBlock is the content stored under the routing key of a signed subspace key: the encrypted document
+// with the signature of its owner. It lets any node check the signature without learning the document name.
+type SignedBlock struct {
+	PublicKey   []byte `json:"public_key"`    // Public key of the owner of the subspace
+	DocNameHash []byte `json:"doc_name_hash"` // Hash of the document name
+	Signature   []byte `json:"signature"`     // Signature of the routing key and the encrypted data
+	Data        []byte `json:"data"`          // Document encrypted with a key derived from its URI
+}
+
+// GenerateKeyPair creates a new random key pair.
+func GenerateKeyPair() (*KeyPair, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key pair: %v", err)
+	}
+	return &KeyPair{PublicKey: publicKey, PrivateKey: privateKey}, nil
+}
+
+// LoadKeyPair reads a key pair written by Save.
+func LoadKeyPair(path string) (*KeyPair, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file keyPairFile
+	if err := yaml.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("invalid key pair file %s: %v", path, err)
+	}
+
+	publicKey, err := base64.StdEncoding.DecodeString(file.PublicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key in %s", path)
+	}
+	privateKey, err := base64.StdEncoding.DecodeString(file.PrivateKey)
+	if err != nil || len(privateKey) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid private key in %s", path)
+	}
+
+	return &KeyPair{PublicKey: publicKey, PrivateKey: privateKey}, nil
+}
+
+// Save writes the key pair to a file only readable by its owner.
+func (kp *KeyPair) Save(path string) error {
+	raw, err := yaml.Marshal(keyPairFile{
+		PublicKey:  base64.StdEncoding.EncodeToString(kp.PublicKey),
+		PrivateKey: base64.StdEncoding.EncodeToString(kp.PrivateKey),
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, raw, 0600)
+}
+
+// SSKRoot returns the subspace of the key pair, the prefix shared by all its signed subspace keys.
+func (kp *KeyPair) SSKRoot() string {
+	return SSKPrefix + publicKeyHash(kp.PublicKey) + "/"
+}
+
+// SSK returns the signed subspace key of a document of the key pair.
+func (kp *KeyPair) SSK(docName string) string {
+	return kp.SSKRoot() + docName
+}
+
+// Sign encrypts and signs a document and returns its signed subspace key, the routing key the document is
+// stored under in the network and the signed block to store.
+func (kp *KeyPair) Sign(docName string, data []byte) (string, string, []byte, error) {
+	if docName == "" || strings.Contains(docName, "/") {
+		return "", "", nil, fmt.Errorf("invalid document name %q", docName)
+	}
+
+	key := kp.SSK(docName)
+	hash, _ := base64.RawURLEncoding.DecodeString(publicKeyHash(kp.PublicKey))
+	docNameHash := sha256.Sum256([]byte(docName))
+	routingKey := sskRoutingKey(hash, docNameHash[:])
+
+	// The nonce is random as the document of a key may be inserted again with another content
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", nil, err
+	}
+	encrypted := append(nonce, mustSeal(sskCryptoKey(hash, docName), nonce, data)...)
+
+	block, err := json.Marshal(SignedBlock{
+		PublicKey:   kp.PublicKey,
+		DocNameHash: docNameHash[:],
+		Signature:   ed25519.Sign(kp.PrivateKey, signedPayload(routingKey, encrypted)),
+		Data:        encrypted,
+	})
+	if err != nil {
+		return "", "", nil, err
+	}
+	return key, routingKey, block, nil
+}
+
+// IsSSK tells whether the key is a signed subspace key.
+func IsSSK(key string) bool {
+	return strings.HasPrefix(key, SSKPrefix)
+}
+
+// ParseSSK splits a signed subspace key into the hash of the owner's public key and the document name.
+func ParseSSK(key string) (string, string, error) {
+	if !IsSSK(key) {
+		return "", "", fmt.Errorf("%q is not an SSK key", key)
+	}
+
+	hash, docName, found := strings.Cut(strings.TrimPrefix(key, SSKPrefix), "/")
+	if !found || hash == "" || docName == "" {
+		return "", "", fmt.Errorf("invalid SSK key %q, expected SSK@<public key hash>/<document name>", key)
+	}
+	return hash, docName, nil
+}
+
+// isSSKRoutingKey tells whether a signed subspace key is a routing key rather than the URI of a document.
+func isSSKRoutingKey(key string) bool {
+	return IsSSK(key) && !strings.Contains(key, "/")
+}
+
+// sskRoutingKeyOf returns the routing key of the URI of a signed subspace key.
+func sskRoutingKeyOf(key string) (string, error) {
+	hash, docName, err := ParseSSK(key)
+	if err != nil {
+		return "", err
+	}
+	rawHash, err := base64.RawURLEncoding.DecodeString(hash)
+	if err != nil || len(rawHash) != sha256.Size {
+		return "", fmt.Errorf("invalid public key hash in SSK key %q", key)
+	}
+	docNameHash := sha256.Sum256([]byte(docName))
+	return sskRoutingKey(rawHash, docNameHash[:]), nil
+}
+
+// sskRoutingKey derives the routing key of a document from the hash of the owner's public key and the hash of
+// the document name, so that nodes storing the document do not learn its name.
+func sskRoutingKey(publicKeyHash, docNameHash []byte) string {
+	sum := sha256.Sum256(append(append([]byte{}, publicKeyHash...), docNameHash...))
+	return SSKPrefix + base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// sskCryptoKey derives the key encrypting a document, which requires its name.
+func sskCryptoKey(publicKeyHash []byte, docName string) []byte {
+	sum := sha256.Sum256(append(append([]byte("SSK encryption key "), publicKeyHash...), docName...))
+	return sum[:]
+}
+
+// verifySSK checks that the block stored under a routing key is signed by the owner of the subspace of the key.
+func verifySSK(routingKey string, raw []byte) error {
+	if !isSSKRoutingKey(routingKey) {
+		return fmt.Errorf("%q is not an SSK routing key", routingKey)
+	}
+
+	var block SignedBlock
+	if err := json.Unmarshal(raw, &block); err != nil || len(block.Signature) == 0 {
+		return fmt.Errorf("%w: %s is not signed", ErrInvalidSignature, routingKey)
+	}
+	if len(block.PublicKey) != ed25519.PublicKeySize || len(block.DocNameHash) != sha256.Size {
+		return fmt.Errorf("%w: %s is not signed", ErrInvalidSignature, routingKey)
+	}
+	hash := sha256.Sum256(block.PublicKey)
+	if sskRoutingKey(hash[:], block.DocNameHash) != routingKey {
+		return fmt.Errorf("%w: %s is signed by another key", ErrInvalidSignature, routingKey)
+	}
+	if !ed25519.Verify(block.PublicKey, signedPayload(routingKey, block.Data), block.Signature) {
+		return fmt.Errorf("%w: %s", ErrInvalidSignature, routingKey)
+	}
+	return nil
+}
+
+// decryptSSK decrypts the document of a signed block stored under the routing key of a signed subspace key.
+func decryptSSK(key string, raw []byte) ([]byte, error) {
+	hash, docName, err := ParseSSK(key)
+	if err != nil {
+		return nil, err
+	}
+	rawHash, _ := base64.RawURLEncoding.DecodeString(hash)
+
+	var block SignedBlock
+	if err := json.Unmarshal(raw, &block); err != nil {
+		return nil, fmt.Errorf("invalid signed block for %s: %v", key, err)
+	}
+	if len(block.Data) < nonceSize {
+		return nil, fmt.Errorf("%w: %s", ErrDecryption, key)
+	}
+	data, err := open(sskCryptoKey(rawHash, docName), block.Data[:nonceSize], block.Data[nonceSize:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDecryption, key)
+	}
+	return data, nil
+}
+
+// signedPayload binds the data to its routing key so that a signed block cannot be replayed under another document name.
+func signedPayload(key string, data []byte) []byte {
+	payload := make([]byte, 0, len(key)+1+len(data))
+	payload = append(payload, key...)
+	payload = append(payload, 0)
+	return append(payload, data...)
+}
+
+// ID returns the hash of the public key of the key pair, which identifies its owner.
+func (kp *KeyPair) ID() string {
+	return publicKeyHash(kp.PublicKey)
+}
+
+// PublicKeyID returns the identifier of the owner of a public key, as returned by ID.
+func PublicKeyID(publicKey ed25519.PublicKey) string {
+	return publicKeyHash(publicKey)
+}
+
+// publicKeyHash returns the identifier of a subspace, the hash of the public key of its owner.
+func publicKeyHash(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,138 @@
+package keys
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestKeyPair generates a key pair or fails the test.
+func newTestKeyPair(t *testing.T) *KeyPair {
+	t.Helper()
+	keyPair, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyPair
+}
+
+func TestSignRoundTrip(t *testing.T) {
+	keyPair := newTestKeyPair(t)
+	data := []byte("the content of a document")
+
+	key, routingKey, block, err := keyPair.Sign("site", data)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if key != keyPair.SSK("site") || !strings.HasPrefix(key, keyPair.SSKRoot()) {
+		t.Fatalf("document signed under %s, expected %s", key, keyPair.SSK("site"))
+	}
+	if derived, err := RoutingKey(key); err != nil || derived != routingKey {
+		t.Fatalf("RoutingKey(%s) = %s, %v, expected %s", key, derived, err, routingKey)
+	}
+	if err := Verify(routingKey, block); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	decoded, err := Decode(key, block)
+	if err != nil || !bytes.Equal(decoded, data) {
+		t.Fatalf("Decode returned %q, %v", decoded, err)
+	}
+}
+
+func TestSSKRoutingKeyHidesDocumentName(t *testing.T) {
+	keyPair := newTestKeyPair(t)
+	_, routingKey, block, err := keyPair.Sign("my-secret-site", []byte("the content of a document"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The nodes storing the block learn neither the document name, nor the owner, nor the content
+	for _, secret := range []string{"my-secret-site", keyPair.ID(), "the content of a document"} {
+		if strings.Contains(routingKey, secret) || bytes.Contains(block, []byte(secret)) {
+			t.Fatalf("the routing key or the block reveals %q", secret)
+		}
+	}
+	if _, otherRoutingKey, _, _ := keyPair.Sign("other-site", nil); otherRoutingKey == routingKey {
+		t.Fatal("two documents share a routing key")
+	}
+
+	// Without the document name, the content cannot be decrypted
+	if _, err := Decode(keyPair.SSK("guessed-site"), block); !errors.Is(err, ErrDecryption) {
+		t.Fatalf("Decode under another document name returned %v, expected ErrDecryption", err)
+	}
+}
+
+func TestSSKRejectsTamperedBlocks(t *testing.T) {
+	owner, attacker := newTestKeyPair(t), newTestKeyPair(t)
+	_, routingKey, block, err := owner.Sign("site", []byte("the content of a document"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, forged, _ := attacker.Sign("site", []byte("forged content"))
+	_, _, otherDocument, _ := owner.Sign("other-site", []byte("another document"))
+
+	// modify decodes the block, lets the test change it and encodes it again
+	modify := func(change func(block *SignedBlock)) []byte {
+		var signed SignedBlock
+		if err := json.Unmarshal(block, &signed); err != nil {
+			t.Fatal(err)
+		}
+		change(&signed)
+		raw, _ := json.Marshal(signed)
+		return raw
+	}
+
+	tests := []struct {
+		name  string
+		block []byte
+	}{
+		{"tampered content", modify(func(block *SignedBlock) { block.Data[len(block.Data)-1] ^= 1 })},
+		{"tampered signature", modify(func(block *SignedBlock) { block.Signature[0] ^= 1 })},
+		{"missing signature", modify(func(block *SignedBlock) { block.Signature = nil })},
+		{"content signed by another key", modify(func(block *SignedBlock) {
+			var other SignedBlock
+			json.Unmarshal(forged, &other)
+			block.Data, block.Signature = other.Data, other.Signature
+		})},
+		{"block of another key pair", forged},
+		{"block of another document", otherDocument},
+		{"not a signed block", []byte("unsigned content")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := Verify(routingKey, test.block); !errors.Is(err, ErrInvalidSignature) {
+				t.Fatalf("Verify returned %v, expected ErrInvalidSignature", err)
+			}
+		})
+	}
+}
+
+func TestSignRejectsInvalidDocumentNames(t *testing.T) {
+	keyPair := newTestKeyPair(t)
+	for _, docName := range []string{"", "site/index"} {
+		if _, _, _, err := keyPair.Sign(docName, nil); err == nil {
+			t.Errorf("Sign(%q) succeeded", docName)
+		}
+	}
+}
+
+func TestKeyPairSaveLoad(t *testing.T) {
+	keyPair := newTestKeyPair(t)
+	path := filepath.Join(t.TempDir(), "keypair.yaml")
+	if err := keyPair.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadKeyPair(path)
+	if err != nil {
+		t.Fatalf("LoadKeyPair: %v", err)
+	}
+	if !loaded.PublicKey.Equal(keyPair.PublicKey) || !loaded.PrivateKey.Equal(keyPair.PrivateKey) {
+		t.Fatal("loaded key pair differs from the saved one")
+	}
+}
@@ -0,0 +1,88 @@
+package keys
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// USKPrefix is the prefix of updatable subspace keys.
+const USKPrefix = "USK@"
+
+// USK returns the updatable subspace key of an edition of a document of the key pair.
+func (kp *KeyPair) USK(docName string, edition int64) string {
+	return FormatUSK(publicKeyHash(kp.PublicKey), docName, edition)
+}
+
+// SignEdition encrypts and signs an edition of the document and returns its updatable subspace key, the routing key
+// of the signed subspace key of that edition and the signed block to store under it.
+func (kp *KeyPair) SignEdition(docName string, edition int64, data []byte) (string, string, []byte, error) {
+	if edition < 0 {
+		return "", "", nil, fmt.Errorf("invalid edition %d", edition)
+	}
+
+	_, routingKey, block, err := kp.Sign(editionName(docName, edition), data)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return kp.USK(docName, edition), routingKey, block, nil
+}
+
+// FormatUSK builds the updatable subspace key of an edition of a document.
+func FormatUSK(hash, docName string, edition int64) string {
+	return USKPrefix + hash + "/" + docName + "/" + strconv.FormatInt(edition, 10)
+}
+
+// IsUSK tells whether the key is an updatable subspace key.
+func IsUSK(key string) bool {
+	return strings.HasPrefix(key, USKPrefix)
+}
+
+// ParseUSK splits an updatable subspace key into the hash of the owner's public key, the document name and the edition.
+func ParseUSK(key string) (string, string, int64, error) {
+	if !IsUSK(key) {
+		return "", "", 0, fmt.Errorf("%q is not a USK key", key)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(key, USKPrefix), "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		return "", "", 0, fmt.Errorf("invalid USK key %q, expected USK@<public key hash>/<document name>/<edition>", key)
+	}
+	edition, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || edition < 0 {
+		return "", "", 0, fmt.Errorf("invalid edition in USK key %q", key)
+	}
+	return parts[0], parts[1], edition, nil
+}
+
+// USKBase returns the key shared by all the editions of an updatable subspace key, without the edition.
+func USKBase(key string) (string, error) {
+	hash, docName, _, err := ParseUSK(key)
+	if err != nil {
+		return "", err
+	}
+	return USKPrefix + hash + "/" + docName, nil
+}
+
+// WithEdition returns the updatable subspace key of another edition of the same document.
+func WithEdition(key string, edition int64) (string, error) {
+	hash, docName, _, err := ParseUSK(key)
+	if err != nil {
+		return "", err
+	}
+	return FormatUSK(hash, docName, edition), nil
+}
+
+// EditionSSK returns the signed subspace key an edition of an updatable subspace key is stored under.
+func EditionSSK(key string, edition int64) (string, error) {
+	hash, docName, _, err := ParseUSK(key)
+	if err != nil {
+		return "", err
+	}
+	return SSKPrefix + hash + "/" + editionName(docName, edition), nil
+}
+
+// editionName is the document name of an edition in the subspace.
+func editionName(docName string, edition int64) string {
+	return docName + "-" + strconv.FormatInt(edition, 10)
+}
@@ -0,0 +1,81 @@
+package keys
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSignEditionMapsToSSK(t *testing.T) {
+	keyPair := newTestKeyPair(t)
+	data := []byte("edition 3 of the site")
+
+	usk, routingKey, block, err := keyPair.SignEdition("site", 3, data)
+	if err != nil {
+		t.Fatalf("SignEdition: %v", err)
+	}
+	if usk != keyPair.USK("site", 3) {
+		t.Fatalf("edition signed under %s, expected %s", usk, keyPair.USK("site", 3))
+	}
+
+	// Each edition is stored under the signed subspace key of its own document name
+	ssk, err := EditionSSK(usk, 3)
+	if err != nil || ssk != keyPair.SSK("site-3") {
+		t.Fatalf("EditionSSK returned %s, %v, expected %s", ssk, err, keyPair.SSK("site-3"))
+	}
+	if derived, _ := RoutingKey(ssk); derived != routingKey {
+		t.Fatalf("routing key of %s is %s, expected %s", ssk, derived, routingKey)
+	}
+	if err := Verify(routingKey, block); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if decoded, err := Decode(ssk, block); err != nil || !bytes.Equal(decoded, data) {
+		t.Fatalf("Decode returned %q, %v", decoded, err)
+	}
+
+	// The block of an edition is not accepted as another edition
+	next, _ := EditionSSK(usk, 4)
+	nextRoutingKey, _ := RoutingKey(next)
+	if nextRoutingKey == routingKey {
+		t.Fatal("two editions share a routing key")
+	}
+	if err := Verify(nextRoutingKey, block); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("Verify of an edition under the next one returned %v, expected ErrInvalidSignature", err)
+	}
+
+	if _, _, _, err := keyPair.SignEdition("site", -1, data); err == nil {
+		t.Fatal("SignEdition of a negative edition succeeded")
+	}
+}
+
+func TestParseUSK(t *testing.T) {
+	keyPair := newTestKeyPair(t)
+	usk := keyPair.USK("site", 7)
+
+	hash, docName, edition, err := ParseUSK(usk)
+	if err != nil || hash != keyPair.ID() || docName != "site" || edition != 7 {
+		t.Fatalf("ParseUSK(%s) = %s, %s, %d, %v", usk, hash, docName, edition, err)
+	}
+	if base, _ := USKBase(usk); base != USKPrefix+keyPair.ID()+"/site" {
+		t.Fatalf("USKBase(%s) = %s", usk, base)
+	}
+	if other, _ := WithEdition(usk, 8); other != keyPair.USK("site", 8) {
+		t.Fatalf("WithEdition(%s, 8) = %s", usk, other)
+	}
+	if _, err := RoutingKey(usk); err == nil {
+		t.Fatal("RoutingKey of a USK succeeded, each edition has its own routing key")
+	}
+
+	for _, key := range []string{
+		keyPair.SSK("site"),
+		USKPrefix + keyPair.ID() + "/site",
+		USKPrefix + keyPair.ID() + "/site/-1",
+		USKPrefix + keyPair.ID() + "/site/latest",
+		USKPrefix + "/site/1",
+		USKPrefix + keyPair.ID() + "//1",
+	} {
+		if _, _, _, err := ParseUSK(key); err == nil {
+			t.Errorf("ParseUSK(%q) succeeded", key)
+		}
+	}
+}
@@ -15,6 +15,9 @@ import (
 // GlobalLogger is a globally accessible logger instance.
 var GlobalLogger *zap.Logger
 
+// Level is the level of the global logger, which can be changed while the node runs.
+var Level = zap.NewAtomicLevel()
+
 // PipeReader is the reader end of the pipe to capture logs for the UI.
 var PipeReader *os.File
 
@@ -23,17 +26,34 @@ var PipeWriter *os.File
 
 // InitGlobalLogger initializes the global logger with a specified log level and configuration.
 func InitGlobalLogger(ctx context.Context, config configs.LoggerConfig) error {
-	// Create the pipe for redirecting logs to the UI.
-	var err error
-	PipeReader, PipeWriter, err = os.Pipe()
-	if err != nil {
-		return fmt.Errorf("failed to create pipe: %v", err)
+	// Logs are written to stdout, captured for the UI unless headless, and to the log file if any.
+	outputPaths := []string{"stdout"}
+	levelEncoder := zapcore.CapitalColorLevelEncoder
+	if config.Headless {
+		// Colors are noise in a file or a service journal
+		levelEncoder = zapcore.CapitalLevelEncoder
+		if config.File != "" {
+			outputPaths = []string{config.File}
+		} else if config.Quiet {
+			outputPaths = nil
+		}
+	} else {
+		// Create the pipe for redirecting logs to the UI.
+		var err error
+		PipeReader, PipeWriter, err = os.Pipe()
+		if err != nil {
+			return fmt.Errorf("failed to create pipe: %v", err)
+		}
+
+		// Redirect stdout and stderr to the PipeWriter
+		os.Stdout = PipeWriter
+		os.Stderr = PipeWriter
+
+		if config.File != "" {
+			outputPaths = append(outputPaths, config.File)
+		}
 	}
 
-	// Redirect stdout and stderr to the PipeWriter
-	os.Stdout = PipeWriter
-	os.Stderr = PipeWriter
-
 	// Set default log level to "info"
 	level := "info"
 	if config.Debug {
@@ -41,36 +61,35 @@ func InitGlobalLogger(ctx context.Context, config configs.LoggerConfig) error {
 		level = "debug"
 	}
 
-	var lvl zapcore.Level
 	// Set the zapcore level based on the specified log level
-	if err := lvl.Set(level); err != nil {
-		return fmt.Errorf("invalid log-level: %v", err)
+	if err := SetLevel(level); err != nil {
+		return err
 	}
 
 	// Create an encoder configuration for formatting log messages
 	encoderCfg := zapcore.EncoderConfig{
-		TimeKey:        "time",                           // Key for the log entry time
-		LevelKey:       "level",                          // Key for the log entry level
-		NameKey:        "logger",                         // Key for the logger name
-		MessageKey:     "msg",                            // Key for the log message
-		LineEnding:     zapcore.DefaultLineEnding,        // Line ending character
-		EncodeLevel:    zapcore.CapitalColorLevelEncoder, // Function to encode the level in capital letters with color
-		EncodeTime:     humanReadableTimeEncoder,         // Function to encode the time in a human-readable format
-		EncodeDuration: zapcore.StringDurationEncoder,    // Function to encode the duration as a string
-		EncodeCaller:   zapcore.ShortCallerEncoder,       // Function to encode the caller information in a short format
+		TimeKey:        "time",                        // Key for the log entry time
+		LevelKey:       "level",                       // Key for the log entry level
+		NameKey:        "logger",                      // Key for the logger name
+		MessageKey:     "msg",                         // Key for the log message
+		LineEnding:     zapcore.DefaultLineEnding,     // Line ending character
+		EncodeLevel:    levelEncoder,                  // Function to encode the level in capital letters, with color for the UI
+		EncodeTime:     humanReadableTimeEncoder,      // Function to encode the time in a human-readable format
+		EncodeDuration: zapcore.StringDurationEncoder, // Function to encode the duration as a string
+		EncodeCaller:   zapcore.ShortCallerEncoder,    // Function to encode the caller information in a short format
 	}
 
 	// Create a zap configuration
 	cfg := zap.Config{
-		Level:       zap.NewAtomicLevelAt(lvl), // Set the atomic level to the specified log level
-		Development: false,                     // Set development mode to false
+		Level:       Level, // Use the shared level, so that it can be changed later
+		Development: false, // Set development mode to false
 		Sampling: &zap.SamplingConfig{ // Sampling configuration for the logger
 			Initial:    100, // Initial number of logs to sample
 			Thereafter: 100, // Number of logs to sample thereafter
 		},
 		Encoding:         "console",          // Set the encoding to console format
 		EncoderConfig:    encoderCfg,         // Use the specified encoder configuration
-		OutputPaths:      []string{"stdout"}, // Output logs to stdout
+		OutputPaths:      outputPaths,        // Output logs to stdout and/or the log file
 		ErrorOutputPaths: []string{"stderr"}, // Output error logs to stderr
 	}
 
@@ -87,6 +106,16 @@ func InitGlobalLogger(ctx context.Context, config configs.LoggerConfig) error {
 	return nil
 }
 
+// SetLevel changes the level of the global logger: "debug", "info", "warn" or "error".
+func SetLevel(level string) error {
+	var lvl zapcore.Level
+	if err := lvl.Set(level); err != nil {
+		return fmt.Errorf("invalid log-level: %v", err)
+	}
+	Level.SetLevel(lvl)
+	return nil
+}
+
 // humanReadableTimeEncoder formats the log entry time in a human-readable format.
 func humanReadableTimeEncoder(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
 	enc.AppendString(t.Format("2006-01-02 15:04:05"))
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"fmt"
+	"freenet/internal/logger"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Datastore : Répertoire contenant le contenu réel des fichiers stockés localement
+type Datastore struct {
+	dir string // chemin vers le répertoire du datastore
+}
+
+// NewDatastore initialise le datastore en créant son répertoire si besoin
+func NewDatastore(dir string) (*Datastore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Datastore{dir: dir}, nil
+}
+
+// path retourne le chemin du fichier contenant le contenu d'une clé
+func (d *Datastore) path(key string) (string, error) {
+	// Les clés peuvent contenir des caractères interdits dans un nom de fichier, comme "/", mais "." et ".." ne sont
+	// pas échappés et désigneraient le répertoire du datastore ou son parent
+	if key == "" || key == "." || key == ".." {
+		return "", fmt.Errorf("invalid datastore key %q", key)
+	}
+	return filepath.Join(d.dir, url.PathEscape(key)), nil
+}
+
+// Put enregistre le contenu d'une clé dans le datastore
+func (d *Datastore) Put(key string, data []byte) error {
+	path, err := d.path(key)
+	if err != nil {
+		return err
+	}
+
+	// Écrit dans un fichier temporaire puis renomme, pour ne jamais laisser de contenu partiel
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	logger.GlobalLogger.Debug("Contenu de " + key + " enregistré dans le datastore (" + strconv.Itoa(len(data)) + " octets)")
+	return nil
+}
+
+// Get récupère le contenu d'une clé, os.ErrNotExist si elle n'est pas dans le datastore
+func (d *Datastore) Get(key string) ([]byte, error) {
+	path, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+// Has indique si le contenu d'une clé est présent dans le datastore
+func (d *Datastore) Has(key string) bool {
+	path, err := d.path(key)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// Remove supprime le contenu d'une clé du datastore
+func (d *Datastore) Remove(key string) error {
+	path, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDatastoreRoundTrip(t *testing.T) {
+	store, err := NewDatastore(filepath.Join(t.TempDir(), "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"55", "SSK@abc/site", "USK@abc/site/3", "100%", "..."} {
+		if err := store.Put(key, []byte("content of "+key)); err != nil {
+			t.Fatalf("Put(%q): %v", key, err)
+		}
+		data, err := store.Get(key)
+		if err != nil || !bytes.Equal(data, []byte("content of "+key)) {
+			t.Fatalf("Get(%q) returned %q, %v", key, data, err)
+		}
+		if !store.Has(key) {
+			t.Fatalf("Has(%q) is false after Put", key)
+		}
+		if err := store.Remove(key); err != nil || store.Has(key) {
+			t.Fatalf("Remove(%q) returned %v, Has: %v", key, err, store.Has(key))
+		}
+	}
+}
+
+func TestDatastoreRejectsDirectoryKeys(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDatastore(filepath.Join(dir, "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"", ".", ".."} {
+		if err := store.Put(key, []byte("content")); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+		if _, err := store.Get(key); err == nil {
+			t.Errorf("Get(%q) succeeded", key)
+		}
+		if store.Has(key) {
+			t.Errorf("Has(%q) is true", key)
+		}
+		if err := store.Remove(key); err == nil {
+			t.Errorf("Remove(%q) succeeded", key)
+		}
+	}
+
+	// Nothing was written next to the datastore
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("directory of the datastore holds %v, %v", entries, err)
+	}
+}
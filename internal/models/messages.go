@@ -4,24 +4,78 @@ import "encoding/json"
 
 // Message is a wrapper structure to detect the type of incoming messages.
 type Message struct {
-	Type     string          `json:"type"`      // Type of the message: "request", "positive", or "negative"
-	Data     json.RawMessage `json:"data"`      // Raw data for the actual message
-	SenderID string          `json:"sender_id"` // ID of the node that sent the message
+	Type           string          `json:"type"`            // Type of the message: "request", "positive", "negative", "route_not_found", "data_request", "data_reply", "insert", "insert_ack", "insert_collision" or "error"
+	Data           json.RawMessage `json:"data"`            // Raw data for the actual message
+	SenderID       string          `json:"sender_id"`       // Node ID of the node that sent the message, proven by the connection handshake
+	SenderLocation uint64          `json:"sender_location"` // Location of the sender in the keyspace
 }
 
 // RequestMessage represents a message to request a file from the network.
 type RequestMessage struct {
 	RequestID string `json:"request_id"` // RequestID is the unique identifier for this request.
 	Key       string `json:"key"`        // Key is the unique identifier of the file being requested.
+	HTL       int    `json:"htl"`        // HTL is the number of hops the request is still allowed to travel.
 }
 
 // PositiveMessage represents a message indicating that the requested file was found at a specific node.
 type PositiveMessage struct {
-	RequestID string `json:"request_id"` // RequestID is the unique identifier of the original request.
-	NodeID    string `json:"node_id"`    // NodeID is the identifier of the node that contains the requested file.
+	RequestID   string `json:"request_id"`   // RequestID is the unique identifier of the original request.
+	NodeID      string `json:"node_id"`      // NodeID is the identifier of the node that contains the requested file.
+	NodeAddress string `json:"node_address"` // NodeAddress is the address that node listens on.
+	Hops        int    `json:"hops"`         // Hops is the number of hops travelled back from the node that answered.
 }
 
 // NegativeMessage represents a message indicating that the requested file was not found.
 type NegativeMessage struct {
 	RequestID string `json:"request_id"` // RequestID is the unique identifier of the original request.
 }
+
+// RouteNotFoundMessage represents a message indicating that the request ran out of hops-to-live before finding the file.
+type RouteNotFoundMessage struct {
+	RequestID string `json:"request_id"` // RequestID is the unique identifier of the original request.
+}
+
+// DataRequestMessage represents a message asking the node holding a file for its content.
+type DataRequestMessage struct {
+	RequestID string `json:"request_id"` // RequestID is the unique identifier of this data request.
+	Key       string `json:"key"`        // Key is the unique identifier of the file whose content is requested.
+}
+
+// DataReplyMessage represents a message carrying the content of a file back to the node that asked for it.
+type DataReplyMessage struct {
+	RequestID string `json:"request_id"`     // RequestID is the unique identifier of the data request.
+	Key       string `json:"key"`            // Key is the unique identifier of the file.
+	Found     bool   `json:"found"`          // Found tells whether the node actually holds the content.
+	Data      []byte `json:"data,omitempty"` // Data is the content of the file.
+}
+
+// InsertMessage represents a message publishing the content of a file into the network.
+type InsertMessage struct {
+	RequestID string `json:"request_id"` // RequestID is the unique identifier for this insert.
+	Key       string `json:"key"`        // Key is the unique identifier of the file being inserted.
+	Data      []byte `json:"data"`       // Data is the content of the file.
+	HTL       int    `json:"htl"`        // HTL is the number of hops the insert is still allowed to travel.
+}
+
+// InsertAckMessage represents a message acknowledging that an insert has been stored along its path.
+type InsertAckMessage struct {
+	RequestID   string `json:"request_id"`   // RequestID is the unique identifier of the original insert.
+	NodeID      string `json:"node_id"`      // NodeID is the identifier of the last node that stored the file.
+	NodeAddress string `json:"node_address"` // NodeAddress is the address that node listens on.
+	Hops        int    `json:"hops"`         // Hops is the number of hops travelled back from that node.
+}
+
+// InsertCollisionMessage represents a message telling that an insert reached a node already holding different content
+// under its key.
+type InsertCollisionMessage struct {
+	RequestID string `json:"request_id"` // RequestID is the unique identifier of the original insert.
+	NodeID    string `json:"node_id"`    // NodeID is the identifier of the node holding the other content.
+}
+
+// ErrorMessage represents the standard reply to a message the receiving node could not handle.
+type ErrorMessage struct {
+	MessageType string `json:"message_type"`         // MessageType is the type of the message that could not be handled.
+	RequestID   string `json:"request_id,omitempty"` // RequestID is the identifier of the request that message belongs to, if any.
+	Code        string `json:"code"`                 // Code tells why the message was not handled, such as "unknown_message_type".
+	Reason      string `json:"reason"`               // Reason describes the error.
+}
@@ -0,0 +1,311 @@
+package models
+
+import (
+	"freenet/internal/logger"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// lastSeenSaveInterval : Intervalle minimal entre deux sauvegardes dues uniquement à la date de dernière activité
+const lastSeenSaveInterval = time.Minute
+
+// PeerState : État de la connexion avec un pair
+type PeerState string
+
+const (
+	PeerUnknown      PeerState = "unknown"      // Aucune connexion n'a encore été tentée
+	PeerConnected    PeerState = "connected"    // Une connexion est ouverte avec le pair
+	PeerDisconnected PeerState = "disconnected" // La connexion est fermée ou a échoué
+)
+
+// Peer : Voisin connu avec sa position dans l'espace des clés
+type Peer struct {
+	ID       string    `yaml:"id,omitempty"` // Identifiant du pair, vide tant qu'aucune connexion ne l'a prouvé
+	Address  string    `yaml:"address"`      // Adresse d'écoute actuelle du pair
+	Location uint64    `yaml:"location"`     // Position annoncée par le pair dans l'espace des clés
+	State    PeerState `yaml:"state"`        // État de la connexion
+	LastSeen time.Time `yaml:"last_seen"`    // Date du dernier message reçu du pair
+	Penalty  int       `yaml:"penalty"`      // Nombre de fautes commises par le pair, comme du contenu invalide
+
+	Fingerprint string `yaml:"fingerprint,omitempty"` // Empreinte du certificat TLS épinglé pour ce pair
+}
+
+// Structure pour représenter la table des pairs dans YAML
+type PeersData struct {
+	Peers map[string]Peer `yaml:"peers"` // clé : identifiant du pair, ou son adresse tant que l'identifiant est inconnu
+}
+
+// PeerTable : Table de routage des pairs, enregistrée à côté du fichier warehouse.yaml
+type PeerTable struct {
+	mu        sync.RWMutex
+	storage   PeersData
+	file      string    // chemin vers le fichier de la table des pairs
+	lastSaved time.Time // date de la dernière sauvegarde
+}
+
+// NewPeerTable initialise la table des pairs en chargeant les données depuis le fichier
+func NewPeerTable(file string) (*PeerTable, error) {
+	table := &PeerTable{
+		storage: PeersData{Peers: make(map[string]Peer)},
+		file:    file,
+	}
+
+	// Vérifie si le fichier existe déjà, sinon crée un nouveau fichier
+	if _, err := os.Stat(file); err == nil {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(data, &table.storage); err != nil {
+			return nil, err
+		}
+		if table.storage.Peers == nil {
+			table.storage.Peers = make(map[string]Peer)
+		}
+		// Aucune connexion n'est ouverte au démarrage
+		for key, peer := range table.storage.Peers {
+			peer.State = PeerUnknown
+			table.storage.Peers[key] = peer
+		}
+		logger.GlobalLogger.Debug("Table des pairs chargée depuis le fichier: " + file)
+	} else {
+		table.mu.Lock()
+		err := table.saveToFile()
+		table.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return table, nil
+}
+
+// saveToFile enregistre la table des pairs dans le fichier, l'appelant doit détenir le verrou
+func (t *PeerTable) saveToFile() error {
+	data, err := yaml.Marshal(&t.storage)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(t.file, data, 0644); err != nil {
+		return err
+	}
+	t.lastSaved = time.Now()
+	logger.GlobalLogger.Debug("Table des pairs sauvegardée dans le fichier : " + t.file)
+	return nil
+}
+
+// Save enregistre la table des pairs, y compris les dates de dernière activité pas encore sauvegardées
+func (t *PeerTable) Save() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.saveToFile()
+}
+
+// Key retourne la clé du pair dans la table : son identifiant, ou son adresse tant que l'identifiant est inconnu
+func (p Peer) Key() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.Address
+}
+
+// AddPeer ajoute un pair inconnu à la table avec une position par défaut
+// L'identifiant peut être vide si seule l'adresse du pair est connue
+// Un pair existant n'est pas modifié, sauf pour lui donner une adresse s'il n'en avait pas
+func (t *PeerTable) AddPeer(id, address string, location uint64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := Peer{ID: id, Address: address}.Key()
+	if peer, exists := t.storage.Peers[key]; exists {
+		if peer.Address != "" || address == "" {
+			return nil
+		}
+		peer.Address = address
+		t.storage.Peers[key] = peer
+		return t.saveToFile()
+	}
+	if id != "" {
+		if _, exists := t.storage.Peers[address]; exists {
+			// Le pair est déjà connu par son adresse, son identifiant sera prouvé à la connexion
+			return nil
+		}
+	}
+	t.storage.Peers[key] = Peer{
+		ID:       id,
+		Address:  address,
+		Location: location,
+		State:    PeerUnknown,
+	}
+	logger.GlobalLogger.Debug("Pair ajouté à la table : " + key)
+	return t.saveToFile()
+}
+
+// Identify associe l'identifiant prouvé par un pair à son adresse actuelle
+// Une adresse vérifiée, celle à laquelle le pair a été joint, déplace sous son identifiant le pair connu jusque-là
+// par cette seule adresse. Une adresse seulement annoncée par le pair ne modifie jamais l'entrée d'un autre pair :
+// elle est ignorée si un autre pair l'utilise déjà.
+func (t *PeerTable) Identify(id, address string, verified bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	peer, exists := t.storage.Peers[id]
+	if !verified {
+		if address == "" || t.addressTakenLocked(id, address) {
+			address = peer.Address
+		}
+		if exists && peer.ID == id && peer.Address == address {
+			return nil
+		}
+		if exists && peer.Address != address {
+			logger.GlobalLogger.Debug("Le pair " + id + " annonce une nouvelle adresse : " + peer.Address + " -> " + address)
+		}
+		peer.ID = id
+		peer.Address = address
+		t.storage.Peers[id] = peer
+		return t.saveToFile()
+	}
+
+	merged := false
+	if unidentified, found := t.storage.Peers[address]; found && unidentified.ID == "" {
+		delete(t.storage.Peers, address)
+		merged = true
+		if !exists {
+			peer, exists = unidentified, true
+		}
+	}
+	if !merged && exists && peer.ID == id && peer.Address == address {
+		return nil
+	}
+
+	if exists && peer.Address != address {
+		logger.GlobalLogger.Debug("Le pair " + id + " a changé d'adresse : " + peer.Address + " -> " + address)
+	}
+	peer.ID = id
+	peer.Address = address
+	t.storage.Peers[id] = peer
+	return t.saveToFile()
+}
+
+// addressTakenLocked indique si un autre pair que id utilise déjà l'adresse
+func (t *PeerTable) addressTakenLocked(id, address string) bool {
+	for key, peer := range t.storage.Peers {
+		if key != id && (key == address || peer.Address == address) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindByAddress récupère le pair dont l'adresse actuelle est donnée
+func (t *PeerTable) FindByAddress(address string) (Peer, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if peer, exists := t.storage.Peers[address]; exists {
+		return peer, true
+	}
+	for _, peer := range t.storage.Peers {
+		if peer.Address == address {
+			return peer, true
+		}
+	}
+	return Peer{}, false
+}
+
+// Seen enregistre un message reçu d'un pair avec la position qu'il annonce
+func (t *PeerTable) Seen(id string, location uint64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	peer, exists := t.storage.Peers[id]
+	changed := !exists || peer.LastSeen.IsZero() || peer.Location != location || peer.State != PeerConnected
+
+	peer.ID = id
+	peer.Location = location
+	peer.State = PeerConnected
+	peer.LastSeen = time.Now()
+	t.storage.Peers[id] = peer
+
+	// La date de dernière activité seule ne justifie pas une écriture à chaque message
+	if !changed && time.Since(t.lastSaved) < lastSeenSaveInterval {
+		return nil
+	}
+	return t.saveToFile()
+}
+
+// SetState met à jour l'état de la connexion avec un pair connu et indique si l'état a changé
+func (t *PeerTable) SetState(key string, state PeerState) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	peer, exists := t.storage.Peers[key]
+	if !exists || peer.State == state {
+		return false, nil
+	}
+	peer.State = state
+	t.storage.Peers[key] = peer
+	logger.GlobalLogger.Debug("Pair " + key + " maintenant " + string(state))
+	return true, t.saveToFile()
+}
+
+// Penalize pénalise un pair pour une faute et retourne sa nouvelle pénalité
+func (t *PeerTable) Penalize(key string) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	peer, exists := t.storage.Peers[key]
+	if !exists {
+		peer = Peer{ID: key, State: PeerUnknown}
+	}
+	peer.Penalty++
+	t.storage.Peers[key] = peer
+	logger.GlobalLogger.Debug("Pair " + key + " pénalisé : " + strconv.Itoa(peer.Penalty))
+	return peer.Penalty, t.saveToFile()
+}
+
+// GetPeer récupère un pair de la table par son identifiant, ou son adresse tant que l'identifiant est inconnu
+func (t *PeerTable) GetPeer(key string) (Peer, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	peer, exists := t.storage.Peers[key]
+	return peer, exists
+}
+
+// ListPeers retourne une copie de tous les pairs, triés par adresse
+func (t *PeerTable) ListPeers() []Peer {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	peers := make([]Peer, 0, len(t.storage.Peers))
+	for _, peer := range t.storage.Peers {
+		peers = append(peers, peer)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Address < peers[j].Address })
+	return peers
+}
+
+// PinFingerprint épingle l'empreinte du certificat d'un pair qui n'en a pas encore
+// Retourne l'empreinte épinglée pour le pair, qui peut différer de celle proposée
+func (t *PeerTable) PinFingerprint(id, fingerprint string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	peer, exists := t.storage.Peers[id]
+	if exists && peer.Fingerprint != "" {
+		return peer.Fingerprint, nil
+	}
+	if !exists {
+		peer = Peer{ID: id, State: PeerUnknown}
+	}
+	peer.Fingerprint = fingerprint
+	t.storage.Peers[id] = peer
+	logger.GlobalLogger.Debug("Empreinte " + fingerprint + " épinglée pour le pair " + id)
+	return fingerprint, t.saveToFile()
+}
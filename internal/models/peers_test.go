@@ -0,0 +1,87 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"freenet/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	logger.GlobalLogger = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+// newTestPeerTable creates an empty peer table in a temporary directory.
+func newTestPeerTable(t *testing.T) *PeerTable {
+	t.Helper()
+	table, err := NewPeerTable(filepath.Join(t.TempDir(), "peers.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return table
+}
+
+func TestIdentifyVerifiedMergesAddress(t *testing.T) {
+	table := newTestPeerTable(t)
+	table.AddPeer("", "127.0.0.1:4000", 1)
+
+	if err := table.Identify("honest", "127.0.0.1:4000", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := table.GetPeer("127.0.0.1:4000"); exists {
+		t.Fatal("the peer known by its address was not moved under its node ID")
+	}
+	if peer, _ := table.GetPeer("honest"); peer.Address != "127.0.0.1:4000" {
+		t.Fatalf("honest peer has address %q", peer.Address)
+	}
+}
+
+func TestIdentifyAnnouncedAddressCannotTakeOverPeers(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(table *PeerTable)
+	}{
+		{"peer known by its address", func(table *PeerTable) {
+			table.AddPeer("", "127.0.0.1:4000", 1)
+		}},
+		{"identified peer", func(table *PeerTable) {
+			table.AddPeer("", "127.0.0.1:4000", 1)
+			table.Identify("honest", "127.0.0.1:4000", true)
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			table := newTestPeerTable(t)
+			test.setup(table)
+			before, _ := table.FindByAddress("127.0.0.1:4000")
+
+			if err := table.Identify("attacker", "127.0.0.1:4000", false); err != nil {
+				t.Fatal(err)
+			}
+
+			after, exists := table.FindByAddress("127.0.0.1:4000")
+			if !exists || after != before {
+				t.Fatalf("peer at the address changed from %+v to %+v", before, after)
+			}
+			if attacker, _ := table.GetPeer("attacker"); attacker.Address != "" {
+				t.Fatalf("attacker was given the address %q", attacker.Address)
+			}
+		})
+	}
+}
+
+func TestIdentifyAnnouncedFreeAddress(t *testing.T) {
+	table := newTestPeerTable(t)
+
+	if err := table.Identify("newcomer", "127.0.0.1:4001", false); err != nil {
+		t.Fatal(err)
+	}
+	if peer, _ := table.GetPeer("newcomer"); peer.Address != "127.0.0.1:4001" {
+		t.Fatalf("newcomer has address %q", peer.Address)
+	}
+}
@@ -2,14 +2,33 @@ package models
 
 import (
 	"freenet/internal/logger"
+	"slices"
+	"strconv"
 	"sync"
 )
 
+// RequestStatus : État d'avancement d'une requête
+type RequestStatus string
+
+const (
+	RequestPending   RequestStatus = "pending"   // La requête attend encore une réponse
+	RequestFulfilled RequestStatus = "fulfilled" // Le fichier a été trouvé
+	RequestFailed    RequestStatus = "failed"    // Plus aucun voisin à contacter
+	RequestTimedOut  RequestStatus = "timed_out" // Le délai global de la requête est dépassé
+)
+
 // Structure pour une requête
 type Request struct {
 	Key              string
 	NodeID           string
 	VisitedNeighbors []string
+	HTL              int           // Hops-to-live restant pour transférer la requête
+	HTLExhausted     bool          // Un voisin a répondu que la requête avait épuisé son HTL
+	PendingNeighbor  string        // Voisin dont on attend actuellement la réponse
+	Status           RequestStatus // État d'avancement de la requête
+	Insert           bool          // La requête est une insertion et non une recherche
+	Data             []byte        // Contenu transporté par une insertion, oublié une fois l'insertion transférée ou terminée
+	Size             int           // Taille du contenu transporté par une insertion
 }
 
 // RequestsStore : Dictionnaire pour stocker les requêtes déjà traitées
@@ -26,7 +45,7 @@ func NewRequestsStore() *RequestsStore {
 }
 
 // AddRequest ajoute une nouvelle requête au store
-func (store *RequestsStore) AddRequest(requestID, key, nodeID string, visitedNeighbors []string) {
+func (store *RequestsStore) AddRequest(requestID, key, nodeID string, visitedNeighbors []string, htl int) {
 	store.mu.Lock()
 	defer store.mu.Unlock()
 
@@ -35,11 +54,31 @@ func (store *RequestsStore) AddRequest(requestID, key, nodeID string, visitedNei
 		Key:              key,
 		NodeID:           nodeID,
 		VisitedNeighbors: visitedNeighbors,
+		HTL:              htl,
+		Status:           RequestPending,
 	}
 
 	// Ajoute la requête dans le dictionnaire
 	store.Requests[requestID] = request
-	logger.GlobalLogger.Debug("Requête ajoutée dans le RequestsStore: ID = " + requestID + ", NodeID = " + nodeID + ", Key = " + key)
+	logger.GlobalLogger.Debug("Requête ajoutée dans le RequestsStore: ID = " + requestID + ", NodeID = " + nodeID + ", Key = " + key + ", HTL = " + strconv.Itoa(htl))
+}
+
+// AddInsertRequest ajoute une nouvelle insertion au store, avec le contenu à transférer
+func (store *RequestsStore) AddInsertRequest(requestID, key, nodeID string, visitedNeighbors []string, htl int, data []byte) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.Requests[requestID] = Request{
+		Key:              key,
+		NodeID:           nodeID,
+		VisitedNeighbors: visitedNeighbors,
+		HTL:              htl,
+		Status:           RequestPending,
+		Insert:           true,
+		Data:             data,
+		Size:             len(data),
+	}
+	logger.GlobalLogger.Debug("Insertion ajoutée dans le RequestsStore: ID = " + requestID + ", NodeID = " + nodeID + ", Key = " + key + ", HTL = " + strconv.Itoa(htl))
 }
 
 // GetRequest récupère une requête du store
@@ -60,15 +99,48 @@ func (store *RequestsStore) RemoveRequest(requestID string) {
 	logger.GlobalLogger.Debug("Requête supprimée : ID = " + requestID)
 }
 
-// UpdateRequest met à jour une requête existante dans le store
-func (store *RequestsStore) UpdateRequest(requestID string, updatedRequest Request) {
+// UpdateIf modifie une requête existante sous le verrou du store
+// update reçoit la requête et indique si la modification doit être enregistrée : la vérification de l'état de la
+// requête et sa transition sont ainsi atomiques. Retourne la requête et si elle a été modifiée.
+func (store *RequestsStore) UpdateIf(requestID string, update func(request *Request) bool) (Request, bool) {
 	store.mu.Lock()
 	defer store.mu.Unlock()
 
-	if _, exists := store.Requests[requestID]; exists {
-		store.Requests[requestID] = updatedRequest
-		logger.GlobalLogger.Debug("Requête mise à jour dans le RequestsStore: ID = " + requestID + ", Key = " + updatedRequest.Key + ", NodeID = " + updatedRequest.NodeID)
-	} else {
-		logger.GlobalLogger.Error("Requête non trouvée dans le RequestsStore: ID = " + requestID)
+	request, exists := store.Requests[requestID]
+	if !exists {
+		return Request{}, false
+	}
+	// Les copies déjà retournées ne doivent pas voir la modification
+	request.VisitedNeighbors = slices.Clone(request.VisitedNeighbors)
+	if !update(&request) {
+		return store.Requests[requestID], false
+	}
+	store.Requests[requestID] = request
+	logger.GlobalLogger.Debug("Requête mise à jour dans le RequestsStore: ID = " + requestID + ", Key = " + request.Key + ", Status = " + string(request.Status))
+	return request, true
+}
+
+// Complete termine une requête encore en attente avec le statut donné
+func (store *RequestsStore) Complete(requestID string, status RequestStatus) (Request, bool) {
+	return store.UpdateIf(requestID, func(request *Request) bool {
+		if request.Status != RequestPending {
+			return false
+		}
+		request.Status = status
+		request.PendingNeighbor = ""
+		request.Data = nil
+		return true
+	})
+}
+
+// ListRequests retourne une copie de toutes les requêtes du store
+func (store *RequestsStore) ListRequests() map[string]Request {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	requests := make(map[string]Request, len(store.Requests))
+	for requestID, request := range store.Requests {
+		requests[requestID] = request
 	}
+	return requests
 }
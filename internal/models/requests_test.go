@@ -0,0 +1,85 @@
+package models
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCompleteOnce(t *testing.T) {
+	store := NewRequestsStore()
+	store.AddRequest("request", "50", "local", nil, 10)
+
+	// Replies, hop timeouts and the deadline race to complete the request, a single one of them wins
+	statuses := []RequestStatus{RequestFulfilled, RequestFailed, RequestTimedOut}
+	winners := make(chan RequestStatus, 30)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(winners); i++ {
+		wg.Add(1)
+		go func(status RequestStatus) {
+			defer wg.Done()
+			if _, completed := store.Complete("request", status); completed {
+				winners <- status
+			}
+		}(statuses[i%len(statuses)])
+	}
+	wg.Wait()
+	close(winners)
+
+	if len(winners) != 1 {
+		t.Fatalf("request completed %d times, expected once", len(winners))
+	}
+	if request, _ := store.GetRequest("request"); request.Status != <-winners {
+		t.Fatalf("request is %s, not the status it was completed with", request.Status)
+	}
+}
+
+func TestCompleteClearsInFlightState(t *testing.T) {
+	store := NewRequestsStore()
+	store.AddInsertRequest("insert", "50", "local", nil, 10, []byte("content"))
+	store.UpdateIf("insert", func(request *Request) bool {
+		request.PendingNeighbor = "neighbor"
+		return true
+	})
+
+	request, completed := store.Complete("insert", RequestFulfilled)
+	if !completed || request.PendingNeighbor != "" || request.Data != nil {
+		t.Fatalf("Complete returned %+v, %v, expected a completed request with no pending neighbor nor content", request, completed)
+	}
+	if request.Size != len("content") {
+		t.Fatalf("insert of %d bytes after completion, expected %d", request.Size, len("content"))
+	}
+	if _, completed := store.Complete("insert", RequestFailed); completed {
+		t.Fatal("a completed request was completed again")
+	}
+	if _, completed := store.Complete("unknown", RequestFailed); completed {
+		t.Fatal("an unknown request was completed")
+	}
+}
+
+func TestUpdateIf(t *testing.T) {
+	store := NewRequestsStore()
+	store.AddRequest("request", "50", "neighbor", []string{"neighbor"}, 10)
+	before, _ := store.GetRequest("request")
+
+	// A refused update is not recorded, even if it modified the request
+	request, updated := store.UpdateIf("request", func(request *Request) bool {
+		request.VisitedNeighbors = append(request.VisitedNeighbors, "refused")
+		request.HTL = 0
+		return false
+	})
+	if updated || request.HTL != 10 || len(request.VisitedNeighbors) != 1 {
+		t.Fatalf("refused update returned %+v, %v", request, updated)
+	}
+
+	request, updated = store.UpdateIf("request", func(request *Request) bool {
+		request.VisitedNeighbors = append(request.VisitedNeighbors, "next")
+		return true
+	})
+	if !updated || len(request.VisitedNeighbors) != 2 {
+		t.Fatalf("update returned %+v, %v", request, updated)
+	}
+	// Copies returned earlier do not see the update
+	if len(before.VisitedNeighbors) != 1 {
+		t.Fatalf("earlier copy sees the visited neighbors %v", before.VisitedNeighbors)
+	}
+}
@@ -1,10 +1,8 @@
 package models
 
 import (
-	"fmt"
 	"freenet/internal/logger"
 	"io/ioutil"
-	"math"
 	"os"
 	"strconv"
 	"sync"
@@ -14,7 +12,8 @@ import (
 
 // Structure pour représenter l'entrepôt dans YAML
 type WarehouseData struct {
-	Files map[string]string `yaml:"files"` // clé : ID du fichier, valeur : emplacement
+	Files    map[string]string `yaml:"files"`              // clé : ID du fichier, valeur : emplacement
+	Editions map[string]int64  `yaml:"editions,omitempty"` // clé : USK sans édition, valeur : plus haute édition connue
 }
 
 // Warehouse structure pour stocker les fichiers et leurs emplacements
@@ -66,8 +65,7 @@ func (w *Warehouse) loadFromFile() error {
 	return nil
 }
 
-// saveToFile enregistre les données dans warehouse.yaml
-// NEED TO LOCK BEFORE
+// saveToFile enregistre les données dans warehouse.yaml, l'appelant doit détenir le verrou
 func (w *Warehouse) saveToFile() error {
 	data, err := yaml.Marshal(&w.storage)
 	if err != nil {
@@ -120,71 +118,45 @@ func (w *Warehouse) RemoveFile(fileID string) error {
 	return nil
 }
 
-// ListFiles affiche tous les fichiers dans l'entrepôt
+// ListFiles retourne une copie de tous les fichiers de l'entrepôt
 func (w *Warehouse) ListFiles() map[string]string {
 	w.mu.RLock()
 	defer w.mu.RUnlock()
-	return w.storage.Files
-}
 
-// asciiSum calculates the sum of ASCII values of each character in a string.
-func asciiSum(s string) int {
-	sum := 0
-	for _, char := range s {
-		sum += int(char)
+	files := make(map[string]string, len(w.storage.Files))
+	for fileID, location := range w.storage.Files {
+		files[fileID] = location
 	}
-	return sum
+	return files
 }
 
-// NearestNeighborByFileID returns the neighbor (node) corresponding to the file ID
-// whose ASCII value sum is nearest to the given target key, excluding visited neighbors and local files.
-func (w *Warehouse) NearestNeighborByFileID(targetKey string, visitedNeighbors []string) (string, error) {
+// GetEdition récupère la plus haute édition connue d'une clé USK (sans son numéro d'édition)
+func (w *Warehouse) GetEdition(uskBase string) (int64, bool) {
 	w.mu.RLock()
 	defer w.mu.RUnlock()
+	edition, exists := w.storage.Editions[uskBase]
+	return edition, exists
+}
 
-	if len(w.storage.Files) == 0 {
-		return "", fmt.Errorf("warehouse is empty")
-	}
-
-	// Calculate the ASCII sum of the target key
-	targetKeySum := asciiSum(targetKey)
+// StoreEdition enregistre une édition d'une clé USK si elle est plus récente que la plus haute édition connue.
+// Retourne vrai si l'édition est nouvelle.
+func (w *Warehouse) StoreEdition(uskBase string, edition int64) (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
-	// Prepare a set for fast lookup of visited neighbors (nodes)
-	visitedSet := make(map[string]struct{}, len(visitedNeighbors))
-	for _, node := range visitedNeighbors {
-		visitedSet[node] = struct{}{}
+	if known, exists := w.storage.Editions[uskBase]; exists && known >= edition {
+		return false, nil
 	}
-
-	var nearestNeighbor string
-	var nearestDistance = math.MaxInt64
-
-	// Iterate over all files in the warehouse, excluding visited nodes and local files
-	for fileID, node := range w.storage.Files {
-		// Skip if the node is "local" or has been visited
-		if node == "local" {
-			continue
-		}
-		if _, visited := visitedSet[node]; visited {
-			continue // Skip visited nodes
-		}
-
-		// Calculate the ASCII sum of the file ID
-		fileIDSum := asciiSum(fileID)
-
-		// Calculate the absolute difference between the target key sum and the file ID sum
-		distance := int(math.Abs(float64(targetKeySum - fileIDSum)))
-
-		// If this distance is smaller, update the nearest node
-		if distance < nearestDistance {
-			nearestDistance = distance
-			nearestNeighbor = node
-			logger.GlobalLogger.Debug("Nearest neighbor updated to: " + nearestNeighbor + " with distance : " + strconv.Itoa(nearestDistance))
-		}
+	if w.storage.Editions == nil {
+		w.storage.Editions = make(map[string]int64)
 	}
+	w.storage.Editions[uskBase] = edition
 
-	if nearestNeighbor == "" {
-		return "", fmt.Errorf("no more neighbors to contact")
+	// Sauvegarder les modifications dans le fichier
+	err := w.saveToFile()
+	if err != nil {
+		return true, err
 	}
-
-	return nearestNeighbor, nil
+	logger.GlobalLogger.Debug("Édition " + strconv.FormatInt(edition, 10) + " enregistrée pour " + uskBase)
+	return true, nil
 }
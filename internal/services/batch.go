@@ -0,0 +1,151 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"freenet/internal/logger"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// batchRetryBackoff is the time waited before the first retry of a search, doubled before every following retry.
+const batchRetryBackoff = 500 * time.Millisecond
+
+// BatchResult is the outcome of the search of one key of a batch.
+type BatchResult struct {
+	Key      string // Key searched
+	Result   Result // Result of the last attempt
+	Err      error  // Error of the last attempt, nil when the key was found
+	Attempts int    // Number of searches made for the key
+}
+
+// BatchProgress reports how far a batch search has gone.
+type BatchProgress struct {
+	Total   int           // Number of keys of the batch
+	Done    int           // Number of keys whose search has completed, found or not
+	Found   int           // Number of keys found
+	Failed  int           // Number of keys not found after all their attempts
+	Retries int           // Number of searches retried so far
+	Elapsed time.Duration // Time since the batch started
+}
+
+// Throughput returns the number of keys completed per second.
+func (p BatchProgress) Throughput() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Done) / p.Elapsed.Seconds()
+}
+
+// SearchBatch searches for many keys, running at most the configured number of searches at once and retrying
+// each failed search the configured number of times. onProgress, when set, is called once before the first search
+// and after each key completes, never concurrently. Cancelling the context stops the batch: the keys not searched
+// yet are reported with the error of the context. The results are in the order of the keys.
+func (client *ServiceClient) SearchBatch(ctx context.Context, keys []string, onProgress func(BatchProgress)) []BatchResult {
+	results := make([]BatchResult, len(keys))
+	started := time.Now()
+
+	var mu sync.Mutex
+	progress := BatchProgress{Total: len(keys)}
+	report := func(update func(*BatchProgress)) {
+		mu.Lock()
+		defer mu.Unlock()
+		update(&progress)
+		progress.Elapsed = time.Since(started)
+		if onProgress != nil {
+			onProgress(progress)
+		}
+	}
+	report(func(*BatchProgress) {})
+	logger.GlobalLogger.Info("Batch search of " + strconv.Itoa(len(keys)) + " keys started with " + strconv.Itoa(client.batchConcurrency) + " concurrent searches")
+
+	// Workers take the indexes of the keys to search from the queue
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(client.batchConcurrency, len(keys)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				results[i] = client.searchWithRetries(ctx, keys[i], func() {
+					report(func(p *BatchProgress) { p.Retries++ })
+				})
+				report(func(p *BatchProgress) {
+					p.Done++
+					if results[i].Err == nil {
+						p.Found++
+					} else {
+						p.Failed++
+					}
+				})
+			}
+		}()
+	}
+
+	next := 0
+dispatch:
+	for ; next < len(keys); next++ {
+		select {
+		case queue <- next:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	// Keys never handed to a worker were cancelled
+	for i := next; i < len(keys); i++ {
+		results[i] = BatchResult{Key: keys[i], Err: ctx.Err()}
+	}
+
+	logger.GlobalLogger.Info("Batch search of " + strconv.Itoa(len(keys)) + " keys completed in " + time.Since(started).String() + ": " + strconv.Itoa(progress.Found) + " found, " + strconv.Itoa(progress.Failed) + " failed")
+	return results
+}
+
+// searchWithRetries searches for a key until it is found, it fails for good, its attempts are exhausted
+// or the context is cancelled. Retries wait longer and longer, so that a busy network has time to recover.
+func (client *ServiceClient) searchWithRetries(ctx context.Context, key string, onRetry func()) BatchResult {
+	batchResult := BatchResult{Key: key}
+	backoff := client.batchBackoff
+	for {
+		batchResult.Attempts++
+		batchResult.Result, batchResult.Err = client.Search(ctx, key)
+		if batchResult.Err == nil || !retryable(batchResult.Err) || ctx.Err() != nil || batchResult.Attempts > client.batchRetries {
+			return batchResult
+		}
+
+		logger.GlobalLogger.Warn("Search for " + key + " failed, retrying in " + backoff.String() + " (" + strconv.Itoa(batchResult.Attempts) + "/" + strconv.Itoa(client.batchRetries) + "): " + batchResult.Err.Error())
+		select {
+		case <-ctx.Done():
+			return batchResult
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		onRetry()
+	}
+}
+
+// retryable tells whether a failed search may succeed if made again. A search that timed out or ran out of hops
+// may find another route, while a file no reachable neighbor has stays missing.
+func retryable(err error) bool {
+	return errors.Is(err, ErrTimedOut) || errors.Is(err, ErrRouteNotFound)
+}
+
+// ReadKeyList reads a list of keys, one per line. Blank lines and lines starting with # are ignored.
+func ReadKeyList(r io.Reader) ([]string, error) {
+	var keys []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	return keys, scanner.Err()
+}
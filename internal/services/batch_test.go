@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchBatchRetries(t *testing.T) {
+	// The neighbor of the origin is the last hop, the keys it does not hold are answered with route not found.
+	// The keys are searched one at a time, in order.
+	config := testConfig(t)
+	config.DefaultHTL = 1
+	config.Retries = 2
+	config.Concurrency = 1
+	origin, holder := startTestNode(t, config), startTestNode(t, testConfig(t))
+	origin.batchBackoff = 20 * time.Millisecond
+	link(origin, holder)
+	if err := holder.warehouse.StoreFile("found", "local"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The neighbor receives the key "late" once the first search for it has failed
+	var last BatchProgress
+	onProgress := func(progress BatchProgress) {
+		if progress.Retries > last.Retries {
+			holder.warehouse.StoreFile("late", "local")
+		}
+		last = progress
+	}
+
+	started := time.Now()
+	results := origin.SearchBatch(context.Background(), []string{"late", "found", "missing"}, onProgress)
+	tests := []struct {
+		key      string
+		err      error
+		attempts int
+	}{
+		{"late", nil, 2},
+		{"found", nil, 1},
+		{"missing", ErrRouteNotFound, 3},
+	}
+	for i, test := range tests {
+		if results[i].Key != test.key || !errors.Is(results[i].Err, test.err) || results[i].Attempts != test.attempts {
+			t.Errorf("result %d is %s after %d attempts: %v, expected %s after %d attempts: %v",
+				i, results[i].Key, results[i].Attempts, results[i].Err, test.key, test.attempts, test.err)
+		}
+	}
+
+	if last.Done != 3 || last.Found != 2 || last.Failed != 1 || last.Retries != 3 {
+		t.Fatalf("last progress %+v, expected 3 keys done, 2 found, 1 failed and 3 retries", last)
+	}
+	// The key retried twice waited for the backoff, then twice as long
+	if elapsed := time.Since(started); elapsed < 3*origin.batchBackoff {
+		t.Fatalf("batch completed in %s, expected the retries to wait at least %s", elapsed, 3*origin.batchBackoff)
+	}
+}
+
+func TestSearchBatchDoesNotRetryMissingFiles(t *testing.T) {
+	// Without any neighbor, the file cannot be found by searching again
+	origin := startTestNode(t, testConfig(t))
+	origin.batchBackoff = time.Hour
+
+	results := origin.SearchBatch(context.Background(), []string{"missing"}, nil)
+	if !errors.Is(results[0].Err, ErrNotFound) || results[0].Attempts != 1 {
+		t.Fatalf("search failed after %d attempts: %v, expected a single attempt failing with ErrNotFound", results[0].Attempts, results[0].Err)
+	}
+}
+
+func TestSearchBatchCancelledDuringBackoff(t *testing.T) {
+	// A single search at a time, the second key waits for the first one to be done retrying
+	config := testConfig(t)
+	config.DefaultHTL = 1
+	config.Concurrency = 1
+	origin, neighbor := startTestNode(t, config), startTestNode(t, testConfig(t))
+	origin.batchBackoff = time.Hour
+	link(origin, neighbor)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	results := origin.SearchBatch(ctx, []string{"missing", "never searched"}, nil)
+
+	if results[0].Attempts != 1 || !errors.Is(results[0].Err, ErrRouteNotFound) {
+		t.Fatalf("first key searched %d times: %v, expected a single attempt", results[0].Attempts, results[0].Err)
+	}
+	if results[1].Attempts != 0 || !errors.Is(results[1].Err, context.DeadlineExceeded) {
+		t.Fatalf("second key searched %d times: %v, expected it to be cancelled", results[1].Attempts, results[1].Err)
+	}
+}
+
+func TestReadKeyList(t *testing.T) {
+	keys, err := ReadKeyList(strings.NewReader("55\n\n# comment\n  CHK@abc  \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(keys, ",") != "55,CHK@abc" {
+		t.Fatalf("ReadKeyList returned %q", keys)
+	}
+}
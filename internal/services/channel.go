@@ -0,0 +1,307 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// linkHandshakeMagic starts the first frame sent on every connection, followed by the ephemeral key of the node.
+const linkHandshakeMagic = "FREENET-LINK-1\n"
+
+// linkHandshakeTimeout bounds the time spent exchanging keys on a new connection.
+const linkHandshakeTimeout = 5 * time.Second
+
+// linkOverhead is the number of bytes added to every frame by the encryption.
+const linkOverhead = 16
+
+// compressionThreshold is the size in bytes from which messages are compressed on channels with the deflate feature.
+const compressionThreshold = 1024
+
+// compressionOverhead is the number of bytes added to every message by the compression flag.
+const compressionOverhead = 1
+
+// Flags starting every message on channels with the deflate feature.
+const (
+	payloadRaw     byte = 0
+	payloadDeflate byte = 1
+)
+
+// ErrLinkHandshake is returned when the keys of a connection cannot be exchanged.
+var ErrLinkHandshake = errors.New("link handshake failed")
+
+// ErrLinkAuthentication is returned when a frame was not sent by the other end of the channel,
+// or was replayed, reordered or modified on the way.
+var ErrLinkAuthentication = errors.New("link frame authentication failed")
+
+// secureChannel is an encrypted and authenticated channel over a connection to a neighbor.
+// Both ends exchange ephemeral X25519 keys and derive one AES-256-GCM key per direction from the shared secret.
+// Frames are numbered, so that a frame replayed, reordered or dropped makes the channel fail.
+// Over TLS, the encryption is left to TLS and frames are written as they are.
+type secureChannel struct {
+	conn         net.Conn
+	reader       *bufio.Reader
+	maxFrameSize int    // Maximum size in bytes of a message, before encryption
+	fingerprint  string // Fingerprint of the certificate of the other end, over TLS only
+	binding      []byte // Secret shared by both ends of this connection only, signed to prove the node IDs
+	peerID       string // Node ID proven by the other end
+	peerAddress  string // Address the other end listens on, as it announced it
+
+	// Negotiated by the handshake
+	version          int             // Protocol version spoken on the channel
+	features         []string        // Optional features enabled on the channel
+	compress         bool            // Whether large messages are compressed
+	peerMessageTypes map[string]bool // Message types the other end handles
+
+	sendMu   sync.Mutex
+	sendAEAD cipher.AEAD
+	sendSeq  uint64
+
+	recvAEAD cipher.AEAD // Only used by the goroutine reading the channel
+	recvSeq  uint64
+}
+
+// newSecureChannel exchanges keys over a new connection. The initiator is the node that dialed the connection.
+func newSecureChannel(conn net.Conn, initiator bool, maxFrameSize int) (*secureChannel, error) {
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLinkHandshake, err)
+	}
+
+	conn.SetDeadline(time.Now().Add(linkHandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	// Both ends send their key first, then read the key of the other end
+	hello := append([]byte(linkHandshakeMagic), privateKey.PublicKey().Bytes()...)
+	if err := writeFrame(conn, hello, len(hello)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLinkHandshake, err)
+	}
+	reader := bufio.NewReader(conn)
+	peerHello, err := readFrame(reader, len(hello))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLinkHandshake, err)
+	}
+	if len(peerHello) != len(hello) || !bytes.HasPrefix(peerHello, []byte(linkHandshakeMagic)) {
+		return nil, fmt.Errorf("%w: unexpected handshake from %s", ErrLinkHandshake, conn.RemoteAddr())
+	}
+	peerKey, err := ecdh.X25519().NewPublicKey(peerHello[len(linkHandshakeMagic):])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLinkHandshake, err)
+	}
+	secret, err := privateKey.ECDH(peerKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLinkHandshake, err)
+	}
+
+	// The keys of both ends salt the derivation, so that every connection gets its own keys
+	initiatorKey, responderKey := privateKey.PublicKey().Bytes(), peerKey.Bytes()
+	if !initiator {
+		initiatorKey, responderKey = responderKey, initiatorKey
+	}
+	prk := hkdfExtract(append(initiatorKey, responderKey...), secret)
+	initiatorAEAD, err := newLinkAEAD(hkdfExpand(prk, "initiator to responder"))
+	if err != nil {
+		return nil, err
+	}
+	responderAEAD, err := newLinkAEAD(hkdfExpand(prk, "responder to initiator"))
+	if err != nil {
+		return nil, err
+	}
+
+	channel := &secureChannel{
+		conn:         conn,
+		reader:       reader,
+		maxFrameSize: maxFrameSize,
+		binding:      hkdfExpand(prk, "channel binding"),
+		sendAEAD:     initiatorAEAD,
+		recvAEAD:     responderAEAD,
+	}
+	if !initiator {
+		channel.sendAEAD, channel.recvAEAD = responderAEAD, initiatorAEAD
+	}
+	return channel, nil
+}
+
+// newTLSChannel creates a channel over an established TLS connection.
+func newTLSChannel(conn *tls.Conn, fingerprint string, maxFrameSize int) (*secureChannel, error) {
+	state := conn.ConnectionState()
+	binding, err := state.ExportKeyingMaterial("EXPORTER-freenet-channel-binding", nil, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLinkHandshake, err)
+	}
+	return &secureChannel{
+		conn:         conn,
+		reader:       bufio.NewReader(conn),
+		maxFrameSize: maxFrameSize,
+		fingerprint:  fingerprint,
+		binding:      binding,
+	}, nil
+}
+
+// negotiated records the parameters agreed on by the handshake.
+func (c *secureChannel) negotiated(version int, features, peerMessageTypes []string) {
+	c.version = version
+	c.features = features
+	c.compress = slices.Contains(features, featureDeflate)
+	c.peerMessageTypes = make(map[string]bool, len(peerMessageTypes))
+	for _, messageType := range peerMessageTypes {
+		c.peerMessageTypes[messageType] = true
+	}
+}
+
+// supports tells whether the other end handles a message type.
+func (c *secureChannel) supports(messageType string) bool {
+	return c.peerMessageTypes[messageType]
+}
+
+// writeMessage encrypts a message and writes it as a single frame.
+func (c *secureChannel) writeMessage(payload []byte) error {
+	if len(payload) > c.maxFrameSize {
+		return fmt.Errorf("%w: %d bytes exceeds the maximum of %d bytes", ErrFrameTooLarge, len(payload), c.maxFrameSize)
+	}
+	limit := c.maxFrameSize
+	if c.compress {
+		payload = compressPayload(payload)
+		limit += compressionOverhead
+	}
+
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if c.sendAEAD == nil {
+		return writeFrame(c.conn, payload, limit)
+	}
+	sealed := c.sendAEAD.Seal(nil, linkNonce(c.sendSeq), payload, nil)
+	c.sendSeq++
+	return writeFrame(c.conn, sealed, limit+linkOverhead)
+}
+
+// readMessage reads the next frame and decrypts it.
+// It returns io.EOF when the connection is closed cleanly between two frames.
+func (c *secureChannel) readMessage() ([]byte, error) {
+	limit := c.maxFrameSize
+	if c.compress {
+		limit += compressionOverhead
+	}
+
+	var payload []byte
+	if c.recvAEAD == nil {
+		frame, err := readFrame(c.reader, limit)
+		if err != nil {
+			return nil, err
+		}
+		payload = frame
+	} else {
+		sealed, err := readFrame(c.reader, limit+linkOverhead)
+		if err != nil {
+			return nil, err
+		}
+		payload, err = c.recvAEAD.Open(nil, linkNonce(c.recvSeq), sealed, nil)
+		if err != nil {
+			return nil, ErrLinkAuthentication
+		}
+		c.recvSeq++
+	}
+
+	if c.compress {
+		return decompressPayload(payload, c.maxFrameSize)
+	}
+	return payload, nil
+}
+
+// close closes the underlying connection.
+func (c *secureChannel) close() error {
+	return c.conn.Close()
+}
+
+// remoteAddr returns the address of the other end of the connection.
+func (c *secureChannel) remoteAddr() string {
+	return c.conn.RemoteAddr().String()
+}
+
+// compressPayload compresses a message if it is large enough and compression makes it smaller,
+// and prefixes it with the flag telling how it is encoded.
+func compressPayload(payload []byte) []byte {
+	if len(payload) >= compressionThreshold {
+		var buffer bytes.Buffer
+		buffer.WriteByte(payloadDeflate)
+		writer, _ := flate.NewWriter(&buffer, flate.BestSpeed)
+		writer.Write(payload)
+		writer.Close()
+		if buffer.Len() < len(payload)+compressionOverhead {
+			return buffer.Bytes()
+		}
+	}
+	return append([]byte{payloadRaw}, payload...)
+}
+
+// decompressPayload decodes a message written by compressPayload, refusing messages that inflate beyond the maximum size.
+func decompressPayload(payload []byte, maxSize int) ([]byte, error) {
+	if len(payload) == 0 {
+		return nil, fmt.Errorf("empty message")
+	}
+
+	switch payload[0] {
+	case payloadRaw:
+		return payload[1:], nil
+	case payloadDeflate:
+		reader := flate.NewReader(bytes.NewReader(payload[1:]))
+		defer reader.Close()
+		data, err := io.ReadAll(io.LimitReader(reader, int64(maxSize)+1))
+		if err != nil {
+			return nil, fmt.Errorf("invalid compressed message: %v", err)
+		}
+		if len(data) > maxSize {
+			return nil, fmt.Errorf("%w: compressed message inflates beyond %d bytes", ErrFrameTooLarge, maxSize)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unknown message encoding flag %d", payload[0])
+	}
+}
+
+// newLinkAEAD creates the AES-256-GCM cipher of one direction of a channel.
+func newLinkAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLinkHandshake, err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// linkNonce returns the nonce of a frame from its sequence number.
+func linkNonce(seq uint64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], seq)
+	return nonce
+}
+
+// hkdfExtract is the extract step of HKDF-SHA256 (RFC 5869).
+func hkdfExtract(salt, secret []byte) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(secret)
+	return mac.Sum(nil)
+}
+
+// hkdfExpand is the expand step of HKDF-SHA256 (RFC 5869), limited to a single block of 32 bytes.
+func hkdfExpand(prk []byte, info string) []byte {
+	mac := hmac.New(sha256.New, prk)
+	mac.Write([]byte(info))
+	mac.Write([]byte{1})
+	return mac.Sum(nil)
+}
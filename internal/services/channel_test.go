@@ -0,0 +1,140 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+)
+
+// channelPair opens a loopback connection and exchanges keys over it, returning the channel of the node that dialed
+// and the channel of the node that accepted.
+func channelPair(t *testing.T, maxFrameSize int) (*secureChannel, *secureChannel) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	type result struct {
+		channel *secureChannel
+		err     error
+	}
+	accepted := make(chan result, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			accepted <- result{err: err}
+			return
+		}
+		channel, err := newSecureChannel(conn, false, maxFrameSize)
+		accepted <- result{channel, err}
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	initiator, err := newSecureChannel(conn, true, maxFrameSize)
+	if err != nil {
+		t.Fatalf("newSecureChannel (initiator): %v", err)
+	}
+	responder := <-accepted
+	if responder.err != nil {
+		t.Fatalf("newSecureChannel (responder): %v", responder.err)
+	}
+
+	t.Cleanup(func() {
+		initiator.close()
+		responder.channel.close()
+	})
+	return initiator, responder.channel
+}
+
+func TestSecureChannelRoundTrip(t *testing.T) {
+	initiator, responder := channelPair(t, testMaxFrameSize)
+
+	for i, message := range [][]byte{[]byte("hello"), {}, bytes.Repeat([]byte{7}, testMaxFrameSize)} {
+		if err := initiator.writeMessage(message); err != nil {
+			t.Fatalf("message %d: writeMessage: %v", i, err)
+		}
+		received, err := responder.readMessage()
+		if err != nil {
+			t.Fatalf("message %d: readMessage: %v", i, err)
+		}
+		if !bytes.Equal(received, message) {
+			t.Fatalf("message %d: received %q, expected %q", i, received, message)
+		}
+	}
+
+	// Both directions have their own keys
+	if err := responder.writeMessage([]byte("reply")); err != nil {
+		t.Fatal(err)
+	}
+	if received, err := initiator.readMessage(); err != nil || string(received) != "reply" {
+		t.Fatalf("initiator received %q, %v", received, err)
+	}
+
+	if err := initiator.writeMessage(make([]byte, testMaxFrameSize+1)); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("writeMessage of an oversize message returned %v, expected ErrFrameTooLarge", err)
+	}
+}
+
+func TestSecureChannelRejectsTamperedFrames(t *testing.T) {
+	// seal encrypts a message as the frame number seq of the channel
+	seal := func(channel *secureChannel, seq uint64, message string) []byte {
+		return channel.sendAEAD.Seal(nil, linkNonce(seq), []byte(message), nil)
+	}
+	flip := func(frame []byte, index int) []byte {
+		frame[(index+len(frame))%len(frame)] ^= 1
+		return frame
+	}
+
+	tests := []struct {
+		name   string
+		frames func(channel *secureChannel) [][]byte // Frames written as they are, only the last one must be refused
+	}{
+		{"tampered ciphertext", func(channel *secureChannel) [][]byte {
+			return [][]byte{flip(seal(channel, 0, "hello"), 0)}
+		}},
+		{"tampered tag", func(channel *secureChannel) [][]byte {
+			return [][]byte{flip(seal(channel, 0, "hello"), -1)}
+		}},
+		{"truncated frame", func(channel *secureChannel) [][]byte {
+			frame := seal(channel, 0, "hello")
+			return [][]byte{frame[:len(frame)-1]}
+		}},
+		{"replayed frame", func(channel *secureChannel) [][]byte {
+			frame := seal(channel, 0, "hello")
+			return [][]byte{frame, frame}
+		}},
+		{"frame out of order", func(channel *secureChannel) [][]byte {
+			return [][]byte{seal(channel, 0, "first"), seal(channel, 2, "third")}
+		}},
+		{"frame of the other direction", func(channel *secureChannel) [][]byte {
+			return [][]byte{channel.recvAEAD.Seal(nil, linkNonce(0), []byte("hello"), nil)}
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			initiator, responder := channelPair(t, testMaxFrameSize)
+			frames := test.frames(initiator)
+			for _, frame := range frames {
+				if err := writeFrame(initiator.conn, frame, testMaxFrameSize+linkOverhead); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for i := range frames {
+				_, err := responder.readMessage()
+				if last := i == len(frames)-1; last && !errors.Is(err, ErrLinkAuthentication) {
+					t.Fatalf("readMessage returned %v, expected ErrLinkAuthentication", err)
+				} else if !last && err != nil {
+					t.Fatalf("frame %d: readMessage: %v", i, err)
+				}
+			}
+		})
+	}
+}
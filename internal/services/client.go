@@ -2,44 +2,250 @@ package services
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"freenet/internal/configs"
+	"freenet/internal/events"
+	"freenet/internal/keys"
+	"freenet/internal/logger"
 	"freenet/internal/models"
+	"freenet/internal/splitfile"
+	"strconv"
+	"time"
 )
 
 var Client ServiceClient
 
 type ServiceClient struct {
-	warehouse           *models.Warehouse
-	requestsStore       *models.RequestsStore
-	listeningAddress    string                  // Address of this node for listening to requests
-	warehouseUpdateHook func(*models.Warehouse) // Callback for notifying UI of warehouse changes
+	warehouse         *models.Warehouse
+	datastore         *models.Datastore
+	requestsStore     *models.RequestsStore
+	listeningAddress  string             // Address of this node for listening to requests
+	identity          *keys.KeyPair      // Key pair proving the node ID of this node to its neighbors
+	nodeID            string             // Identifier of this node, the hash of its identity public key
+	maxFrameSize      int                // Maximum size in bytes of a single message frame
+	connections       *ConnectionManager // Persistent connections to the neighbors
+	features          []string           // Optional protocol features offered to the neighbors
+	handlers          *HandlerRegistry   // Handlers of the message types received from the neighbors
+	metrics           *messageMetrics    // Statistics of the messages received from the neighbors
+	tlsConfig         *tls.Config        // TLS configuration of the neighbor connections, nil when TLS is disabled
+	darknet           bool               // Whether only neighbors with a pinned certificate are accepted
+	defaultHTL        int                // Hops-to-live of the requests created by this node
+	maxHTL            int                // Upper bound of the hops-to-live of any request
+	probabilisticHTL  bool               // Whether the HTL decrement is randomised at max and min HTL
+	hopTimeout        time.Duration      // Time given to a neighbor to answer a forwarded request
+	searchTimeout     time.Duration      // Time given to a local request to complete
+	subscribeInterval time.Duration      // Time between two polls for new editions of a subscribed key
+	timers            *requestTimers     // Running timers of the requests
+	searches          *searchFutures     // Futures of the local searches in progress
+	batchConcurrency  int                // Maximum number of searches of a batch running at once
+	batchRetries      int                // Number of times a failed search of a batch is retried
+	batchBackoff      time.Duration      // Time waited before the first retry of a failed search of a batch
+	dataReplies       *dataReplies       // Fetches waiting for the content of a file
+	blockSize         int                // Size in bytes of the blocks large files are split into
+	redundancy        float64            // Number of check blocks inserted per data block of a splitfile
+	router            Router             // Strategy choosing the neighbor a request is forwarded to
+	peers             *models.PeerTable  // Known neighbors with their location and connection state
+	location          uint64             // Location of this node in the keyspace, advertised to neighbors
+	events            *events.Bus        // Activity of the node published to the interface and the admin API
 }
 
 // InitServiceClient initializes the ServiceClient with necessary configurations and connections.
-func InitServiceClient(ctx context.Context, updateHook func(*models.Warehouse)) error {
+func InitServiceClient(ctx context.Context) error {
 	Client = *new(ServiceClient) // Initializes Client as a new instance of ServiceClient.
+	return Client.init(configs.GlobalConfig)
+}
 
-	// Set the warehouse update hook
-	Client.warehouseUpdateHook = updateHook
+// init sets the client up from the configuration, loading the files of the node.
+func (client *ServiceClient) init(config configs.Config) error {
+	// Subscribers follow the activity of the node from now on
+	client.events = events.NewBus()
 
 	// Créer un entrepôt en chargeant les données depuis le fichier
-	warehouse, err := models.NewWarehouse(configs.GlobalConfig.WarehouseConfig.Path)
+	warehouse, err := models.NewWarehouse(config.WarehouseConfig.Path)
 	if err != nil {
 		return fmt.Errorf("failed to create warehouse: %v", err)
 	}
-	Client.warehouse = warehouse
+	client.warehouse = warehouse
+
+	// Ouvrir le datastore contenant le contenu des fichiers locaux
+	datastore, err := models.NewDatastore(config.WarehouseConfig.DatastorePath())
+	if err != nil {
+		return fmt.Errorf("failed to create datastore: %v", err)
+	}
+	client.datastore = datastore
+	client.dataReplies = newDataReplies()
+
+	client.requestsStore = models.NewRequestsStore()
+
+	client.listeningAddress = fmt.Sprintf("%s:%d", config.NetworkConfig.Address, config.NetworkConfig.Port)
+
+	// The node ID does not depend on the address, neighbors find us again when it changes
+	identity, err := LoadOrCreateIdentity(config.WarehouseConfig.IdentityPath())
+	if err != nil {
+		return fmt.Errorf("failed to load node identity: %v", err)
+	}
+	client.identity = identity
+	client.nodeID = identity.ID()
+	logger.GlobalLogger.Info("Node ID " + client.nodeID)
+
+	if config.NetworkConfig.MaxFrameSize <= 0 {
+		return fmt.Errorf("invalid maximum frame size: %d", config.NetworkConfig.MaxFrameSize)
+	}
+	client.maxFrameSize = config.NetworkConfig.MaxFrameSize
+
+	// A block travels base64 encoded in an insert message, which must fit in a single frame
+	if config.SplitfileConfig.BlockSize <= 0 {
+		return fmt.Errorf("invalid block size: %d", config.SplitfileConfig.BlockSize)
+	}
+	if encodedBlockSize(config.SplitfileConfig.BlockSize) > client.maxFrameSize {
+		return fmt.Errorf("block size %d does not fit in the maximum frame size %d", config.SplitfileConfig.BlockSize, client.maxFrameSize)
+	}
+	client.blockSize = config.SplitfileConfig.BlockSize
+
+	if config.SplitfileConfig.Redundancy < 0 || config.SplitfileConfig.Redundancy > splitfile.MaxRedundancy {
+		return fmt.Errorf("invalid redundancy: %g, expected a ratio between 0 and %g", config.SplitfileConfig.Redundancy, splitfile.MaxRedundancy)
+	}
+	client.redundancy = config.SplitfileConfig.Redundancy
+
+	if config.NetworkConfig.MaxConnections <= 0 {
+		return fmt.Errorf("invalid maximum number of connections: %d", config.NetworkConfig.MaxConnections)
+	}
+	if config.NetworkConfig.IdleTimeout <= 0 {
+		return fmt.Errorf("invalid idle timeout: %s", config.NetworkConfig.IdleTimeout)
+	}
+	if config.NetworkConfig.QueueSize <= 0 {
+		return fmt.Errorf("invalid outbound queue size: %d", config.NetworkConfig.QueueSize)
+	}
+	client.connections = NewConnectionManager(
+		client,
+		config.NetworkConfig.MaxConnections,
+		config.NetworkConfig.IdleTimeout,
+		config.NetworkConfig.QueueSize,
+	)
+
+	if config.NetworkConfig.RateLimit < 0 {
+		return fmt.Errorf("invalid rate limit: %d", config.NetworkConfig.RateLimit)
+	}
+	client.metrics = newMessageMetrics()
+	client.handlers = NewHandlerRegistry()
+	client.registerMessageHandlers(client.handlers, config.NetworkConfig.RateLimit)
+
+	if config.NetworkConfig.Compression {
+		client.features = append(client.features, featureDeflate)
+	}
+
+	// The certificates of the neighbors are pinned in the peer table
+	if config.NetworkConfig.Darknet && !config.NetworkConfig.TLS {
+		return fmt.Errorf("darknet mode requires TLS")
+	}
+	if config.NetworkConfig.TLS {
+		cert, err := LoadOrCreateCertificate(config.WarehouseConfig.CertificatePath())
+		if err != nil {
+			return fmt.Errorf("failed to load TLS certificate: %v", err)
+		}
+		client.tlsConfig = newTLSConfig(cert)
+		client.darknet = config.NetworkConfig.Darknet
+		logger.GlobalLogger.Info("TLS enabled, certificate fingerprint " + Fingerprint(cert))
+	}
+
+	if config.RoutingConfig.MaxHTL <= 0 {
+		return fmt.Errorf("invalid maximum HTL: %d", config.RoutingConfig.MaxHTL)
+	}
+	if config.RoutingConfig.DefaultHTL <= 0 {
+		return fmt.Errorf("invalid default HTL: %d", config.RoutingConfig.DefaultHTL)
+	}
+	client.defaultHTL = config.RoutingConfig.DefaultHTL
+	client.maxHTL = config.RoutingConfig.MaxHTL
+	client.probabilisticHTL = config.RoutingConfig.ProbabilisticHTL
+
+	if config.RoutingConfig.HopTimeout <= 0 {
+		return fmt.Errorf("invalid hop timeout: %s", config.RoutingConfig.HopTimeout)
+	}
+	if config.RoutingConfig.SearchTimeout <= 0 {
+		return fmt.Errorf("invalid search timeout: %s", config.RoutingConfig.SearchTimeout)
+	}
+	client.hopTimeout = config.RoutingConfig.HopTimeout
+	client.searchTimeout = config.RoutingConfig.SearchTimeout
+	if config.RoutingConfig.SubscribeInterval <= 0 {
+		return fmt.Errorf("invalid subscribe interval: %s", config.RoutingConfig.SubscribeInterval)
+	}
+	client.subscribeInterval = config.RoutingConfig.SubscribeInterval
+	if config.BatchConfig.Concurrency <= 0 {
+		return fmt.Errorf("invalid batch concurrency: %d", config.BatchConfig.Concurrency)
+	}
+	if config.BatchConfig.Retries < 0 {
+		return fmt.Errorf("invalid number of batch retries: %d", config.BatchConfig.Retries)
+	}
+	client.batchConcurrency = config.BatchConfig.Concurrency
+	client.batchRetries = config.BatchConfig.Retries
+	client.batchBackoff = batchRetryBackoff
+	client.timers = newRequestTimers()
+	client.searches = newSearchFutures()
 
-	Client.requestsStore = models.NewRequestsStore()
+	router, err := NewRouter(config.RoutingConfig.Router)
+	if err != nil {
+		return fmt.Errorf("failed to create router: %v", err)
+	}
+	client.router = router
+	client.location = router.Location(client.nodeID)
+	logger.GlobalLogger.Info("Routing requests with the " + router.Name() + " router, node location " + strconv.FormatUint(client.location, 10))
 
-	Client.listeningAddress = fmt.Sprintf("%s:%d", configs.GlobalConfig.NetworkConfig.Address, configs.GlobalConfig.NetworkConfig.Port)
+	// Charger la table des pairs enregistrée à côté de l'entrepôt
+	peers, err := models.NewPeerTable(config.WarehouseConfig.PeersPath())
+	if err != nil {
+		return fmt.Errorf("failed to create peer table: %v", err)
+	}
+	client.peers = peers
 
-	// Trigger an update to UI to load initial warehouse data
-	Client.warehouseUpdateHook(Client.warehouse)
+	// The nodes the warehouse points to by address are our first neighbors, the others are already in the peer table
+	for _, location := range client.warehouse.ListFiles() {
+		if !isNodeID(location) {
+			client.addPeer("", location)
+		}
+	}
 
 	return nil
 }
 
+// NodeID returns the identifier of this node.
+func (client *ServiceClient) NodeID() string {
+	return client.nodeID
+}
+
+// Address returns the address this node listens on for its neighbors.
+func (client *ServiceClient) Address() string {
+	return client.listeningAddress
+}
+
+// Location returns the location of this node in the keyspace.
+func (client *ServiceClient) Location() uint64 {
+	return client.location
+}
+
+// Requests returns a copy of the requests this node created or forwarded, keyed by request ID.
+func (client *ServiceClient) Requests() map[string]models.Request {
+	return client.requestsStore.ListRequests()
+}
+
+// Peers returns the neighbors of the peer table.
+func (client *ServiceClient) Peers() []models.Peer {
+	return client.peers.ListPeers()
+}
+
+// Start starts listening for neighbors and managing the outbound connections.
 func (client *ServiceClient) Start(ctx context.Context) error {
-	return Client.startListening(ctx)
+	if err := client.startListening(ctx); err != nil {
+		return err
+	}
+	client.connections.Start(ctx)
+	return nil
+}
+
+// Stop closes the connections to the neighbors and saves the peer table, once the context given to Start is cancelled.
+func (client *ServiceClient) Stop() {
+	client.connections.closeAll()
+	if err := client.peers.Save(); err != nil {
+		logger.GlobalLogger.Error("Failed to save the peer table: " + err.Error())
+	}
 }
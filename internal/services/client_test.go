@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"freenet/internal/configs"
+	"freenet/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	logger.GlobalLogger = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+// testConfig returns the default configuration of a node keeping its files in a new directory and listening on a
+// port chosen by the system.
+func testConfig(t *testing.T) configs.Config {
+	t.Helper()
+	// The handlers may still be saving the warehouse when the test ends, the directory is removed on a best effort basis
+	dir, err := os.MkdirTemp("", "freenet-node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return configs.Config{
+		WarehouseConfig: configs.WarehouseConfig{Path: filepath.Join(dir, "warehouse.yaml")},
+		NetworkConfig: configs.NetworkConfig{
+			Address:        "127.0.0.1",
+			MaxFrameSize:   1 << 20,
+			MaxConnections: 32,
+			IdleTimeout:    2 * time.Minute,
+			QueueSize:      64,
+		},
+		RoutingConfig: configs.RoutingConfig{
+			Router:            "circular",
+			DefaultHTL:        10,
+			MaxHTL:            18,
+			HopTimeout:        5 * time.Second,
+			SearchTimeout:     30 * time.Second,
+			SubscribeInterval: time.Minute,
+		},
+		SplitfileConfig: configs.SplitfileConfig{BlockSize: 32 << 10, Redundancy: 0.5},
+		BatchConfig:     configs.BatchConfig{Concurrency: 4, Retries: 2},
+	}
+}
+
+// newTestNode creates a node from the configuration without starting it.
+func newTestNode(t *testing.T, config configs.Config) *ServiceClient {
+	t.Helper()
+	client := new(ServiceClient)
+	if err := client.init(config); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	return client
+}
+
+// startTestNode creates a node from the configuration and starts it until the end of the test.
+func startTestNode(t *testing.T, config configs.Config) *ServiceClient {
+	t.Helper()
+	client := newTestNode(t, config)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := client.Start(ctx); err != nil {
+		cancel()
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		client.Stop()
+	})
+	return client
+}
+
+// link makes each node a neighbor of the next one, the first node of the chain being the one searching.
+func link(nodes ...*ServiceClient) {
+	for i := 0; i+1 < len(nodes); i++ {
+		nodes[i].addPeer("", nodes[i+1].Address())
+	}
+}
@@ -0,0 +1,322 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"freenet/internal/logger"
+	"freenet/internal/models"
+	"net"
+	"sync"
+	"time"
+)
+
+// dialTimeout bounds the time spent establishing a new connection to a neighbor.
+const dialTimeout = 5 * time.Second
+
+// errConnectionClosed is returned to senders whose message was still queued when the connection went down.
+var errConnectionClosed = errors.New("connection closed")
+
+// errQueueFull is returned to senders when too many messages are already waiting to be written to the neighbor.
+var errQueueFull = errors.New("outbound queue full")
+
+// outboundMessage is a frame waiting in the queue of a neighbor connection.
+type outboundMessage struct {
+	data []byte
+	done chan error // Receives the result of the write
+}
+
+// peerConnection is a long-lived connection to a neighbor with its own outbound queue.
+type peerConnection struct {
+	neighborID string
+	channel    *secureChannel
+	queue      chan outboundMessage
+	closed     chan struct{}
+	closeOnce  sync.Once
+	manager    *ConnectionManager
+
+	mu       sync.Mutex
+	lastUsed time.Time
+}
+
+// ConnectionManager keeps persistent connections to neighbors instead of dialing for every message.
+// Every connection, whether dialed or accepted, is read by the same message loop, so traffic flows both ways.
+type ConnectionManager struct {
+	mu          sync.Mutex
+	conns       map[string]*peerConnection
+	client      *ServiceClient
+	maxConns    int           // Maximum number of pooled connections
+	idleTimeout time.Duration // Connections unused for this long are closed
+	queueSize   int           // Size of the outbound queue of each connection
+}
+
+// NewConnectionManager creates a connection manager for the given client.
+func NewConnectionManager(client *ServiceClient, maxConns int, idleTimeout time.Duration, queueSize int) *ConnectionManager {
+	return &ConnectionManager{
+		conns:       make(map[string]*peerConnection),
+		client:      client,
+		maxConns:    maxConns,
+		idleTimeout: idleTimeout,
+		queueSize:   queueSize,
+	}
+}
+
+// Start closes idle connections periodically and closes every connection when the context is cancelled.
+func (m *ConnectionManager) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(m.idleTimeout / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				logger.GlobalLogger.Debug("Closing all neighbor connections...")
+				m.closeAll()
+				return
+			case <-ticker.C:
+				m.closeIdle()
+			}
+		}
+	}()
+}
+
+// Send queues the frame of a message on the connection to the neighbor and waits until it is written.
+// The neighbor is designated by its node ID, or by its address as long as its node ID is not known.
+// If the connection is broken, it is dropped and the frame is retried once on a fresh connection.
+func (m *ConnectionManager) Send(neighbor, messageType string, data []byte) error {
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		pc, err := m.get(neighbor)
+		if err != nil {
+			return err
+		}
+		if !pc.channel.supports(messageType) {
+			// The neighbor announced in the handshake that it does not handle this message type
+			return fmt.Errorf("%w: %s", ErrUnsupportedMessage, messageType)
+		}
+
+		lastErr = pc.send(data)
+		if lastErr == nil {
+			return nil
+		}
+		if errors.Is(lastErr, ErrFrameTooLarge) || errors.Is(lastErr, errQueueFull) {
+			// Retrying would not help, the frame itself is invalid or the neighbor is not keeping up
+			return lastErr
+		}
+		// Make sure the broken connection is out of the pool before dialing a fresh one
+		pc.close()
+		logger.GlobalLogger.Debug("Connection to neighbor " + neighbor + " failed, reconnecting: " + lastErr.Error())
+	}
+	return lastErr
+}
+
+// adopt registers an accepted connection so that replies to the neighbor reuse it.
+// It returns nil if a connection to this neighbor already exists or the pool is full.
+func (m *ConnectionManager) adopt(neighborID string, channel *secureChannel) *peerConnection {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.conns[neighborID]; exists {
+		return nil
+	}
+	if len(m.conns) >= m.maxConns && !m.evictLocked() {
+		return nil
+	}
+
+	pc := m.newPeerConnection(neighborID, channel)
+	m.conns[neighborID] = pc
+	logger.GlobalLogger.Debug("Reusing incoming connection from " + neighborID + " for outbound traffic")
+	m.client.setPeerState(neighborID, models.PeerConnected)
+	return pc
+}
+
+// get returns the pooled connection to the neighbor, dialing a new one if needed.
+// The neighbor is designated by its node ID, or by its address as long as its node ID is not known.
+// Connections are pooled under the node ID proven by the neighbor during the handshake.
+func (m *ConnectionManager) get(neighbor string) (*peerConnection, error) {
+	nodeID, address, err := m.client.resolveNeighbor(neighbor)
+	if err != nil {
+		return nil, err
+	}
+
+	if nodeID != "" {
+		m.mu.Lock()
+		if pc, exists := m.conns[nodeID]; exists {
+			m.mu.Unlock()
+			return pc, nil
+		}
+		m.mu.Unlock()
+	}
+
+	// Dial and run the handshake without holding the lock so that other neighbors are not blocked
+	conn, err := net.DialTimeout("tcp", address, dialTimeout)
+	if err != nil {
+		m.client.setPeerState(neighbor, models.PeerDisconnected)
+		return nil, fmt.Errorf("failed to connect to neighbor %s: %v", neighbor, err)
+	}
+	channel, err := m.client.secureConnection(conn, address, nodeID)
+	if err != nil {
+		conn.Close()
+		m.client.setPeerState(neighbor, models.PeerDisconnected)
+		return nil, fmt.Errorf("failed to secure connection to neighbor %s: %v", neighbor, err)
+	}
+	nodeID = channel.peerID
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Another goroutine may have connected in the meantime
+	if pc, exists := m.conns[nodeID]; exists {
+		channel.close()
+		return pc, nil
+	}
+	if len(m.conns) >= m.maxConns && !m.evictLocked() {
+		channel.close()
+		return nil, fmt.Errorf("connection limit of %d reached", m.maxConns)
+	}
+
+	pc := m.newPeerConnection(nodeID, channel)
+	m.conns[nodeID] = pc
+	logger.GlobalLogger.Debug("New connection established to neighbor " + nodeID + " at " + address)
+	m.client.setPeerState(nodeID, models.PeerConnected)
+
+	// Read the messages coming back on this connection
+	go m.client.readMessages(channel, pc)
+
+	return pc, nil
+}
+
+// newPeerConnection creates a connection wrapper and starts its writer.
+func (m *ConnectionManager) newPeerConnection(neighborID string, channel *secureChannel) *peerConnection {
+	pc := &peerConnection{
+		neighborID: neighborID,
+		channel:    channel,
+		queue:      make(chan outboundMessage, m.queueSize),
+		closed:     make(chan struct{}),
+		manager:    m,
+		lastUsed:   time.Now(),
+	}
+	go pc.writeLoop()
+	return pc
+}
+
+// evictLocked closes the least recently used connection to make room for a new one. The caller must hold m.mu.
+func (m *ConnectionManager) evictLocked() bool {
+	var oldest *peerConnection
+	for _, pc := range m.conns {
+		if oldest == nil || pc.idleSince().Before(oldest.idleSince()) {
+			oldest = pc
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+
+	delete(m.conns, oldest.neighborID)
+	logger.GlobalLogger.Debug("Connection limit reached, closing connection to " + oldest.neighborID)
+	go oldest.close()
+	return true
+}
+
+// closeIdle closes the connections that have not been used for longer than the idle timeout.
+func (m *ConnectionManager) closeIdle() {
+	m.mu.Lock()
+	var idle []*peerConnection
+	for _, pc := range m.conns {
+		if time.Since(pc.idleSince()) > m.idleTimeout {
+			idle = append(idle, pc)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, pc := range idle {
+		logger.GlobalLogger.Debug("Closing idle connection to neighbor " + pc.neighborID)
+		pc.close()
+	}
+}
+
+// closeAll closes every pooled connection.
+func (m *ConnectionManager) closeAll() {
+	m.mu.Lock()
+	conns := make([]*peerConnection, 0, len(m.conns))
+	for _, pc := range m.conns {
+		conns = append(conns, pc)
+	}
+	m.mu.Unlock()
+
+	for _, pc := range conns {
+		pc.close()
+	}
+}
+
+// remove drops the connection from the pool if it is still the registered one.
+func (m *ConnectionManager) remove(pc *peerConnection) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if current, exists := m.conns[pc.neighborID]; exists && current == pc {
+		delete(m.conns, pc.neighborID)
+	}
+}
+
+// send queues a frame and waits for the writer to report the result.
+func (pc *peerConnection) send(data []byte) error {
+	out := outboundMessage{data: data, done: make(chan error, 1)}
+
+	select {
+	case pc.queue <- out:
+	case <-pc.closed:
+		return errConnectionClosed
+	default:
+		return fmt.Errorf("%w: %s", errQueueFull, pc.neighborID)
+	}
+
+	select {
+	case err := <-out.done:
+		return err
+	case <-pc.closed:
+		return errConnectionClosed
+	}
+}
+
+// writeLoop writes the queued frames one at a time until the connection is closed.
+func (pc *peerConnection) writeLoop() {
+	for {
+		select {
+		case <-pc.closed:
+			return
+		case out := <-pc.queue:
+			err := pc.channel.writeMessage(out.data)
+			out.done <- err
+			if err != nil && !errors.Is(err, ErrFrameTooLarge) {
+				pc.close()
+				return
+			}
+			pc.touch()
+		}
+	}
+}
+
+// touch records that the connection has just been used.
+func (pc *peerConnection) touch() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.lastUsed = time.Now()
+}
+
+// idleSince returns the last time the connection was used.
+func (pc *peerConnection) idleSince() time.Time {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.lastUsed
+}
+
+// close shuts the connection down and removes it from the pool.
+func (pc *peerConnection) close() {
+	pc.closeOnce.Do(func() {
+		close(pc.closed)
+		pc.channel.close()
+		pc.manager.remove(pc)
+		pc.manager.client.setPeerState(pc.neighborID, models.PeerDisconnected)
+	})
+}
@@ -0,0 +1,27 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSendToFullQueue(t *testing.T) {
+	// Without a writer, the queue of the connection fills up after one frame
+	pc := &peerConnection{
+		neighborID: "slow",
+		queue:      make(chan outboundMessage, 1),
+		closed:     make(chan struct{}),
+	}
+	pc.queue <- outboundMessage{done: make(chan error, 1)}
+
+	if err := pc.send([]byte("frame")); !errors.Is(err, errQueueFull) {
+		t.Fatalf("send to a full queue returned %v, expected errQueueFull", err)
+	}
+
+	// Once the connection is down, senders are told so rather than left waiting
+	close(pc.closed)
+	<-pc.queue
+	if err := pc.send([]byte("frame")); !errors.Is(err, errConnectionClosed) {
+		t.Fatalf("send to a closed connection returned %v, expected errConnectionClosed", err)
+	}
+}
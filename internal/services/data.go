@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"freenet/internal/keys"
+	"freenet/internal/logger"
+	"freenet/internal/models"
+	"freenet/internal/splitfile"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrContentUnavailable is returned when the node pointed to by the warehouse does not hold the content of the file.
+var ErrContentUnavailable = errors.New("content unavailable")
+
+// dataReplies holds the channels waiting for the content of a file, keyed by data request ID.
+type dataReplies struct {
+	mu      sync.Mutex
+	pending map[string]chan models.DataReplyMessage
+}
+
+// newDataReplies creates an empty set of pending data requests.
+func newDataReplies() *dataReplies {
+	return &dataReplies{
+		pending: make(map[string]chan models.DataReplyMessage),
+	}
+}
+
+// add registers a data request and returns the channel its reply will be delivered to.
+func (d *dataReplies) add(requestID string) chan models.DataReplyMessage {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	replyCh := make(chan models.DataReplyMessage, 1)
+	d.pending[requestID] = replyCh
+	return replyCh
+}
+
+// take removes and returns the channel of a data request.
+func (d *dataReplies) take(requestID string) (chan models.DataReplyMessage, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	replyCh, exists := d.pending[requestID]
+	delete(d.pending, requestID)
+	return replyCh, exists
+}
+
+// Download fetches the content of a file from the network and writes it to the output path.
+func (client *ServiceClient) Download(ctx context.Context, key, outputPath string) (Result, error) {
+	data, result, err := client.Fetch(ctx, key)
+	if err != nil {
+		return result, err
+	}
+
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return result, fmt.Errorf("failed to write %s: %v", outputPath, err)
+	}
+	logger.GlobalLogger.Info("File " + key + " written to " + outputPath + " (" + strconv.Itoa(len(data)) + " bytes)")
+	return result, nil
+}
+
+// Fetch searches for a file and retrieves its content directly from the node holding it.
+// The content is cached in the local datastore. For an updatable subspace key, the latest edition is fetched,
+// and the blocks of a splitfile are fetched and reassembled.
+func (client *ServiceClient) Fetch(ctx context.Context, key string) ([]byte, Result, error) {
+	var data []byte
+	var result Result
+	var err error
+	if keys.IsUSK(key) {
+		data, result, err = client.fetchUSK(ctx, key)
+	} else {
+		data, result, err = client.fetchContent(ctx, key)
+	}
+	if err != nil {
+		return nil, result, err
+	}
+
+	if splitfile.IsManifest(data) {
+		data, err = client.fetchSplitfile(ctx, data, &result)
+		if err != nil {
+			return nil, result, err
+		}
+	}
+	return data, result, nil
+}
+
+// fetchContent fetches the data stored under the routing key of a URI and decrypts the document it designates.
+func (client *ServiceClient) fetchContent(ctx context.Context, key string) ([]byte, Result, error) {
+	routingKey, err := keys.RoutingKey(key)
+	if err != nil {
+		return nil, Result{Key: key, Status: models.RequestFailed}, err
+	}
+
+	data, result, err := client.fetchStored(ctx, routingKey)
+	result.Key = key
+	if err != nil {
+		return nil, result, err
+	}
+
+	// Only the holder of the URI can decrypt the content, the nodes storing it cannot
+	content, err := keys.Decode(key, data)
+	if err != nil {
+		return nil, result, err
+	}
+	return content, result, nil
+}
+
+// fetchStored retrieves the data stored under a routing key, as held in the datastores, after verifying it.
+func (client *ServiceClient) fetchStored(ctx context.Context, key string) ([]byte, Result, error) {
+	// The content may already be in our datastore
+	if data, err := client.datastore.Get(key); err == nil {
+		logger.GlobalLogger.Info("Content of file " + key + " found in our datastore")
+		return data, Result{Key: key, Location: "local", Status: models.RequestFulfilled}, nil
+	}
+
+	result, err := client.Search(ctx, key)
+	if err != nil {
+		return nil, result, err
+	}
+	started := time.Now()
+
+	if result.Location == "local" || result.Location == client.nodeID {
+		return nil, result, fmt.Errorf("%w: file %s is marked local but is missing from the datastore", ErrContentUnavailable, key)
+	}
+
+	data, err := client.requestData(ctx, result.Location, key)
+	result.Elapsed += time.Since(started)
+	if err != nil {
+		return nil, result, err
+	}
+
+	// Never trust content that does not match its key
+	if err := keys.Verify(key, data); err != nil {
+		logger.GlobalLogger.Error("Rejecting content of file " + key + " sent by " + result.Location + ": " + err.Error())
+		client.penalizePeer(result.Location, err.Error())
+		return nil, result, err
+	}
+
+	// Keep a copy so that we can serve the file ourselves
+	if err := client.datastore.Put(key, data); err != nil {
+		logger.GlobalLogger.Error("Failed to cache file " + key + " in the datastore: " + err.Error())
+	}
+	return data, result, nil
+}
+
+// requestData asks a node for the content of a file and waits for its reply.
+func (client *ServiceClient) requestData(ctx context.Context, nodeID, key string) ([]byte, error) {
+	requestID := uuid.New().String()
+	replyCh := client.dataReplies.add(requestID)
+	defer client.dataReplies.take(requestID)
+
+	dataRequest := models.DataRequestMessage{
+		RequestID: requestID,
+		Key:       key,
+	}
+
+	success, err := client.sendMessageToNeighbor(nodeID, "data_request", dataRequest)
+	if !success {
+		return nil, err
+	}
+	logger.GlobalLogger.Info("Data request " + requestID + " for file " + key + " sent to node " + nodeID)
+
+	timer := time.NewTimer(client.searchTimeout)
+	defer timer.Stop()
+
+	select {
+	case reply := <-replyCh:
+		if !reply.Found {
+			return nil, fmt.Errorf("%w: node %s does not hold file %s", ErrContentUnavailable, nodeID, key)
+		}
+		return reply.Data, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("%w: node %s did not send file %s", ErrTimedOut, nodeID, key)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// handleDataRequestMessage processes a DataRequestMessage by sending back the content of the file if we hold it.
+func (client *ServiceClient) handleDataRequestMessage(msg models.DataRequestMessage, senderID string) {
+	reply := models.DataReplyMessage{
+		RequestID: msg.RequestID,
+		Key:       msg.Key,
+	}
+
+	data, err := client.datastore.Get(msg.Key)
+	if err == nil {
+		reply.Found = true
+		reply.Data = data
+	} else if !os.IsNotExist(err) {
+		logger.GlobalLogger.Error("Failed to read file " + msg.Key + " from the datastore: " + err.Error())
+	}
+
+	success, err := client.sendMessageToNeighbor(senderID, "data_reply", reply)
+	if success {
+		logger.GlobalLogger.Info("Data reply for file " + msg.Key + " sent to " + senderID + " (found: " + strconv.FormatBool(reply.Found) + ")")
+	} else {
+		logger.GlobalLogger.Error("Failed to send data reply for file " + msg.Key + " to " + senderID + ": " + err.Error())
+	}
+}
+
+// handleDataReplyMessage processes a DataReplyMessage by handing the content to the waiting fetch.
+func (client *ServiceClient) handleDataReplyMessage(msg models.DataReplyMessage, senderID string) {
+	replyCh, exists := client.dataReplies.take(msg.RequestID)
+	if !exists {
+		logger.GlobalLogger.Warn("Ignoring unexpected data reply " + msg.RequestID + " from " + senderID)
+		return
+	}
+	replyCh <- msg
+}
+
+// AddLocalFile encrypts content, stores it in the local datastore under its content hash key and returns the URI
+// of the content.
+func (client *ServiceClient) AddLocalFile(data []byte) (string, error) {
+	uri, block := keys.EncryptCHK(data)
+	routingKey, _ := keys.RoutingKey(uri)
+	if err := client.storeLocally(routingKey, block); err != nil {
+		return "", err
+	}
+	return uri, nil
+}
+
+// storeLocally stores content in the datastore and marks the file as local in the warehouse.
+func (client *ServiceClient) storeLocally(key string, data []byte) error {
+	if err := client.datastore.Put(key, data); err != nil {
+		return fmt.Errorf("failed to store file %s in the datastore: %v", key, err)
+	}
+	if err := client.warehouse.StoreFile(key, "local"); err != nil {
+		return fmt.Errorf("failed to store file %s in the warehouse: %v", key, err)
+	}
+	logger.GlobalLogger.Info("File " + key + " stored in our warehouse (" + strconv.Itoa(len(data)) + " bytes)")
+
+	client.warehouseChanged(key, "local")
+	return nil
+}
@@ -0,0 +1,19 @@
+package services
+
+import (
+	"freenet/internal/logger"
+	"freenet/internal/models"
+)
+
+// handleErrorMessage processes an ErrorMessage, the reply of a neighbor that could not handle one of our messages.
+func (client *ServiceClient) handleErrorMessage(msg models.ErrorMessage, senderID string) {
+	logger.GlobalLogger.Warn("Neighbor " + senderID + " could not handle our " + msg.MessageType + " message (" + msg.Code + "): " + msg.Reason)
+
+	// A request the neighbor could not handle moves on to the next neighbor without waiting for it to time out
+	if msg.RequestID == "" {
+		return
+	}
+	if client.acceptReply(msg.RequestID, senderID) {
+		client.handleRequest(msg.RequestID)
+	}
+}
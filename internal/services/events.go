@@ -0,0 +1,38 @@
+package services
+
+import (
+	"context"
+	"freenet/internal/events"
+	"freenet/internal/models"
+)
+
+// eventBuffer is the number of events that can wait for a subscriber to read them.
+const eventBuffer = 256
+
+// Events returns a channel receiving the events of the given types, or of every type when none is given,
+// until the context is cancelled. Events the subscriber is too slow to read are dropped.
+func (client *ServiceClient) Events(ctx context.Context, types ...events.Type) <-chan events.Event {
+	return client.events.Subscribe(ctx, eventBuffer, types...)
+}
+
+// publish publishes an event to the subscribers.
+func (client *ServiceClient) publish(event events.Event) {
+	client.events.Publish(event)
+}
+
+// publishRequest publishes an event about a request of the RequestsStore.
+func (client *ServiceClient) publishRequest(eventType events.Type, requestID string, request models.Request, peer string) {
+	client.publish(events.Event{
+		Type:      eventType,
+		RequestID: requestID,
+		Key:       request.Key,
+		Insert:    request.Insert,
+		Peer:      peer,
+		HTL:       request.HTL,
+	})
+}
+
+// warehouseChanged publishes the new location of a file, empty when the file was removed from the warehouse.
+func (client *ServiceClient) warehouseChanged(key, location string) {
+	client.publish(events.Event{Type: events.WarehouseChanged, Key: key, Location: location})
+}
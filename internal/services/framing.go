@@ -0,0 +1,61 @@
+package services
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// frameHeaderSize is the size in bytes of the length prefix written before every frame.
+const frameHeaderSize = 4
+
+var (
+	// ErrFrameTooLarge is returned when a frame exceeds the configured maximum frame size.
+	ErrFrameTooLarge = errors.New("frame too large")
+	// ErrFrameTruncated is returned when the connection ends in the middle of a frame.
+	ErrFrameTruncated = errors.New("frame truncated")
+)
+
+// writeFrame writes the payload to w, prefixed by its length encoded as a big-endian uint32.
+// The prefix and the payload are sent in a single write so that concurrent frames never interleave.
+func writeFrame(w io.Writer, payload []byte, maxFrameSize int) error {
+	if len(payload) > maxFrameSize {
+		return fmt.Errorf("%w: %d bytes exceeds the maximum of %d bytes", ErrFrameTooLarge, len(payload), maxFrameSize)
+	}
+
+	frame := make([]byte, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	copy(frame[frameHeaderSize:], payload)
+
+	if _, err := w.Write(frame); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readFrame reads a single length-prefixed frame from r and returns its payload.
+// It returns io.EOF when the connection is closed cleanly between two frames.
+func readFrame(r io.Reader, maxFrameSize int) ([]byte, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("%w: incomplete length prefix", ErrFrameTruncated)
+		}
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if uint64(size) > uint64(maxFrameSize) {
+		return nil, fmt.Errorf("%w: %d bytes announced, the maximum is %d bytes", ErrFrameTooLarge, size, maxFrameSize)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("%w: expected %d bytes", ErrFrameTruncated, size)
+		}
+		return nil, err
+	}
+	return payload, nil
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+const testMaxFrameSize = 64
+
+func TestFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{"empty", []byte{}},
+		{"small", []byte("hello")},
+		{"maximum size", bytes.Repeat([]byte{0xAB}, testMaxFrameSize)},
+	}
+
+	var wire bytes.Buffer
+	for _, test := range tests {
+		if err := writeFrame(&wire, test.payload, testMaxFrameSize); err != nil {
+			t.Fatalf("%s: writeFrame: %v", test.name, err)
+		}
+	}
+
+	// Frames written back to back are read one at a time
+	for _, test := range tests {
+		payload, err := readFrame(&wire, testMaxFrameSize)
+		if err != nil {
+			t.Fatalf("%s: readFrame: %v", test.name, err)
+		}
+		if !bytes.Equal(payload, test.payload) {
+			t.Fatalf("%s: read %q, expected %q", test.name, payload, test.payload)
+		}
+	}
+	if _, err := readFrame(&wire, testMaxFrameSize); err != io.EOF {
+		t.Fatalf("readFrame after the last frame returned %v, expected io.EOF", err)
+	}
+}
+
+func TestFrameErrors(t *testing.T) {
+	header := func(size uint32) []byte {
+		return binary.BigEndian.AppendUint32(nil, size)
+	}
+
+	tests := []struct {
+		name string
+		wire []byte
+		err  error
+	}{
+		{"oversize frame announced", header(testMaxFrameSize + 1), ErrFrameTooLarge},
+		{"huge frame announced", header(1<<32 - 1), ErrFrameTooLarge},
+		{"truncated length prefix", []byte{0, 0}, ErrFrameTruncated},
+		{"truncated payload", append(header(10), "short"...), ErrFrameTruncated},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := readFrame(bytes.NewReader(test.wire), testMaxFrameSize); !errors.Is(err, test.err) {
+				t.Fatalf("readFrame returned %v, expected %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestWriteFrameRejectsOversizePayload(t *testing.T) {
+	var wire bytes.Buffer
+	err := writeFrame(&wire, make([]byte, testMaxFrameSize+1), testMaxFrameSize)
+	if !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("writeFrame returned %v, expected ErrFrameTooLarge", err)
+	}
+	if wire.Len() != 0 {
+		t.Fatalf("writeFrame wrote %d bytes of an oversize frame", wire.Len())
+	}
+}
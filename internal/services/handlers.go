@@ -0,0 +1,178 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"freenet/internal/logger"
+	"freenet/internal/models"
+	"slices"
+	"sync"
+)
+
+// errorMessageType is the type of the standard reply to a message that could not be handled.
+const errorMessageType = "error"
+
+// Codes of the error replies, telling why a message was not handled.
+const (
+	errorCodeUnknownType = "unknown_message_type"
+	errorCodeMalformed   = "malformed_message"
+)
+
+var (
+	// ErrUnknownMessageType is returned when no handler is registered for the type of a message.
+	ErrUnknownMessageType = errors.New("unknown message type")
+	// ErrMalformedMessage is returned when the payload of a message cannot be decoded.
+	ErrMalformedMessage = errors.New("malformed message")
+	// ErrUnauthorized is returned when a message is sent on behalf of another node than the one on the connection.
+	ErrUnauthorized = errors.New("message sender not authorized")
+	// ErrRateLimited is returned when a neighbor sends more messages than it is allowed to.
+	ErrRateLimited = errors.New("message rate limit exceeded")
+)
+
+// MessageHandler processes a message received from a neighbor.
+// peerID is the node ID the neighbor proved on the connection the message arrived on.
+type MessageHandler func(peerID string, msg models.Message) error
+
+// Middleware wraps the handling of every message, whatever its type, to run code before or after it.
+type Middleware func(next MessageHandler) MessageHandler
+
+// HandlerRegistry maps the message types to their handler and runs the middlewares around them.
+type HandlerRegistry struct {
+	mu          sync.RWMutex
+	handlers    map[string]MessageHandler
+	middlewares []Middleware
+}
+
+// NewHandlerRegistry creates a registry with no message type.
+func NewHandlerRegistry() *HandlerRegistry {
+	return &HandlerRegistry{handlers: make(map[string]MessageHandler)}
+}
+
+// Register sets the handler of a message type, replacing any previous one.
+func (registry *HandlerRegistry) Register(messageType string, handler MessageHandler) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.handlers[messageType] = handler
+}
+
+// Handle registers the handler of a message type whose payload is decoded into T.
+// A payload that cannot be decoded is reported as ErrMalformedMessage without reaching the handler.
+func Handle[T any](registry *HandlerRegistry, messageType string, handler func(payload T, senderID string)) {
+	registry.Register(messageType, func(peerID string, msg models.Message) error {
+		var payload T
+		if err := json.Unmarshal(msg.Data, &payload); err != nil {
+			return fmt.Errorf("%w: %s message: %v", ErrMalformedMessage, messageType, err)
+		}
+		handler(payload, msg.SenderID)
+		return nil
+	})
+}
+
+// Use adds a middleware. Middlewares run in the order they are added, the first one being the outermost.
+func (registry *HandlerRegistry) Use(middleware Middleware) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.middlewares = append(registry.middlewares, middleware)
+}
+
+// Types returns the registered message types, sorted.
+func (registry *HandlerRegistry) Types() []string {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	types := make([]string, 0, len(registry.handlers))
+	for messageType := range registry.handlers {
+		types = append(types, messageType)
+	}
+	slices.Sort(types)
+	return types
+}
+
+// Dispatch runs the handler of a message through the middlewares.
+// A message of an unregistered type goes through the middlewares as well and fails with ErrUnknownMessageType.
+func (registry *HandlerRegistry) Dispatch(peerID string, msg models.Message) error {
+	registry.mu.RLock()
+	handler, exists := registry.handlers[msg.Type]
+	middlewares := registry.middlewares
+	registry.mu.RUnlock()
+
+	if !exists {
+		handler = func(string, models.Message) error {
+			return fmt.Errorf("%w: %q", ErrUnknownMessageType, msg.Type)
+		}
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler(peerID, msg)
+}
+
+// errorCode returns the code of the error reply to a message that failed with err, empty when no reply is due.
+// Messages dropped by the rate limit get no reply, so that flooding a node does not make it send as much.
+func errorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrUnknownMessageType):
+		return errorCodeUnknownType
+	case errors.Is(err, ErrMalformedMessage):
+		return errorCodeMalformed
+	default:
+		return ""
+	}
+}
+
+// requestIDOf returns the request ID carried by the payload of a message, if any.
+func requestIDOf(msg models.Message) string {
+	var payload struct {
+		RequestID string `json:"request_id"`
+	}
+	json.Unmarshal(msg.Data, &payload)
+	return payload.RequestID
+}
+
+// registerMessageHandlers registers the message types of the protocol and the middlewares run around them.
+// rateLimit is the number of messages per second accepted from a single neighbor, 0 for no limit.
+func (client *ServiceClient) registerMessageHandlers(registry *HandlerRegistry, rateLimit int) {
+	registry.Use(loggingMiddleware)
+	registry.Use(client.metrics.middleware)
+	registry.Use(authMiddleware)
+	if rateLimit > 0 {
+		registry.Use(newRateLimiter(rateLimit).middleware)
+	}
+	registry.Use(client.peerTrackingMiddleware)
+
+	Handle(registry, "request", client.handleRequestMessage)
+	Handle(registry, "positive", client.handlePositiveMessage)
+	Handle(registry, "negative", client.handleNegativeMessage)
+	Handle(registry, "route_not_found", client.handleRouteNotFoundMessage)
+	Handle(registry, "data_request", client.handleDataRequestMessage)
+	Handle(registry, "data_reply", client.handleDataReplyMessage)
+	Handle(registry, "insert", client.handleInsertMessage)
+	Handle(registry, "insert_ack", client.handleInsertAckMessage)
+	Handle(registry, "insert_collision", client.handleInsertCollisionMessage)
+	Handle(registry, errorMessageType, client.handleErrorMessage)
+}
+
+// Handlers returns the registry of the message types this node handles, to register new ones.
+// Types registered after the node has started are only announced on the connections opened afterwards.
+func (client *ServiceClient) Handlers() *HandlerRegistry {
+	return client.handlers
+}
+
+// replyError tells a neighbor that one of its messages could not be handled.
+// Errors are never answered with an error, so that two nodes cannot keep replying to each other.
+func (client *ServiceClient) replyError(peerID string, msg models.Message, err error) {
+	code := errorCode(err)
+	if code == "" || msg.Type == errorMessageType {
+		return
+	}
+
+	reply := models.ErrorMessage{
+		MessageType: msg.Type,
+		RequestID:   requestIDOf(msg),
+		Code:        code,
+		Reason:      err.Error(),
+	}
+	if _, err := client.sendMessageToNeighbor(peerID, errorMessageType, reply); err != nil {
+		logger.GlobalLogger.Debug("Failed to send error reply to " + peerID + ": " + err.Error())
+	}
+}
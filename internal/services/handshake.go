@@ -0,0 +1,223 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"freenet/internal/keys"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProtocolVersion is the newest version of the protocol this node speaks.
+const ProtocolVersion = 1
+
+// MinProtocolVersion is the oldest version of the protocol this node still speaks.
+const MinProtocolVersion = 1
+
+// Optional features, only used on a connection when both ends support them.
+const (
+	featureDeflate = "deflate" // Large frames are compressed with DEFLATE
+)
+
+// messageEncodingJSON is the only encoding of the messages this node speaks.
+const messageEncodingJSON = "json"
+
+// Types of the messages of the handshake.
+const (
+	helloType       = "hello"        // Sent by the node that dialed the connection
+	helloAckType    = "hello_ack"    // Accepts the connection with the negotiated parameters
+	helloRejectType = "hello_reject" // Refuses the connection, with the reason
+)
+
+// identityDomain separates the signatures of the handshake from any other signature made with a node key.
+const identityDomain = "freenet node identity\x00"
+
+var (
+	// ErrIdentity is returned when a node fails to prove the node ID it claims.
+	ErrIdentity = errors.New("node identity handshake failed")
+	// ErrIncompatiblePeer is returned when both ends of a connection cannot agree on a protocol version or encoding.
+	ErrIncompatiblePeer = errors.New("incompatible peer")
+	// ErrUnsupportedMessage is returned when sending a message type the neighbor does not handle.
+	ErrUnsupportedMessage = errors.New("message type not supported by the neighbor")
+)
+
+// helloMessage is exchanged once at the start of every secured connection, before any other message.
+// It announces what the node speaks and proves that it holds the key of its node ID.
+type helloMessage struct {
+	Type         string            `json:"type"`                  // hello, hello_ack or hello_reject
+	Version      int               `json:"version,omitempty"`     // Newest version supported in a hello, version chosen in a hello_ack
+	MinVersion   int               `json:"min_version,omitempty"` // Oldest version supported, in a hello
+	NodeID       string            `json:"node_id,omitempty"`     // Node ID of the sender, the hash of its public key
+	PublicKey    ed25519.PublicKey `json:"public_key,omitempty"`
+	Address      string            `json:"address,omitempty"`       // Address the sender listens on
+	Encodings    []string          `json:"encodings,omitempty"`     // Supported encodings in a hello, encoding chosen in a hello_ack
+	Features     []string          `json:"features,omitempty"`      // Supported features in a hello, features enabled in a hello_ack
+	MessageTypes []string          `json:"message_types,omitempty"` // Message types the sender handles
+	Reason       string            `json:"reason,omitempty"`        // Why the connection is refused, in a hello_reject
+	Signature    []byte            `json:"signature,omitempty"`     // Signature of the channel binding, the role of the sender and its address
+}
+
+// handshake exchanges a hello and a hello_ack over a new channel, negotiating the protocol version and features
+// and proving the node ID of both ends. The node that dialed the connection sends the hello.
+// The responder refuses peers it cannot speak with by a hello_reject, and drops the features the initiator lacks.
+func (client *ServiceClient) handshake(channel *secureChannel, initiator bool) error {
+	channel.conn.SetDeadline(time.Now().Add(linkHandshakeTimeout))
+	defer channel.conn.SetDeadline(time.Time{})
+
+	if initiator {
+		hello := client.newHello(helloType, channel, initiator)
+		hello.Version = ProtocolVersion
+		hello.MinVersion = MinProtocolVersion
+		hello.Encodings = []string{messageEncodingJSON}
+		hello.Features = client.features
+		if err := writeHello(channel, hello); err != nil {
+			return err
+		}
+
+		ack, err := readHello(channel)
+		if err != nil {
+			return err
+		}
+		switch ack.Type {
+		case helloRejectType:
+			return fmt.Errorf("%w: %s refused the connection: %s", ErrIncompatiblePeer, channel.remoteAddr(), ack.Reason)
+		case helloAckType:
+		default:
+			return fmt.Errorf("%w: unexpected %q from %s", ErrIdentity, ack.Type, channel.remoteAddr())
+		}
+		if err := client.verifyHello(channel, ack, false); err != nil {
+			return err
+		}
+		if ack.Version < MinProtocolVersion || ack.Version > ProtocolVersion || len(ack.Encodings) != 1 || ack.Encodings[0] != messageEncodingJSON {
+			return fmt.Errorf("%w: %s chose version %d and encodings %v", ErrIncompatiblePeer, channel.remoteAddr(), ack.Version, ack.Encodings)
+		}
+		channel.negotiated(ack.Version, intersect(ack.Features, client.features), ack.MessageTypes)
+		return nil
+	}
+
+	hello, err := readHello(channel)
+	if err != nil {
+		return err
+	}
+	if hello.Type != helloType {
+		return fmt.Errorf("%w: unexpected %q from %s", ErrIdentity, hello.Type, channel.remoteAddr())
+	}
+	if err := client.verifyHello(channel, hello, true); err != nil {
+		return err
+	}
+
+	version := min(hello.Version, ProtocolVersion)
+	if version < max(hello.MinVersion, MinProtocolVersion) {
+		reason := "no common protocol version, this node speaks versions " + strconv.Itoa(MinProtocolVersion) + " to " + strconv.Itoa(ProtocolVersion)
+		return client.rejectHello(channel, reason)
+	}
+	if !slices.Contains(hello.Encodings, messageEncodingJSON) {
+		return client.rejectHello(channel, "no common encoding, this node speaks "+messageEncodingJSON)
+	}
+
+	ack := client.newHello(helloAckType, channel, initiator)
+	ack.Version = version
+	ack.Encodings = []string{messageEncodingJSON}
+	ack.Features = intersect(hello.Features, client.features)
+	if err := writeHello(channel, ack); err != nil {
+		return err
+	}
+	channel.negotiated(version, ack.Features, hello.MessageTypes)
+	return nil
+}
+
+// newHello creates a handshake message carrying the identity of this node, signed for the channel.
+func (client *ServiceClient) newHello(messageType string, channel *secureChannel, initiator bool) helloMessage {
+	return helloMessage{
+		Type:         messageType,
+		NodeID:       client.nodeID,
+		PublicKey:    client.identity.PublicKey,
+		Address:      client.listeningAddress,
+		MessageTypes: client.handlers.Types(),
+		Signature:    ed25519.Sign(client.identity.PrivateKey, identityPayload(channel.binding, initiator, client.listeningAddress)),
+	}
+}
+
+// rejectHello refuses a connection, telling the initiator why, and returns the matching error.
+func (client *ServiceClient) rejectHello(channel *secureChannel, reason string) error {
+	writeHello(channel, helloMessage{Type: helloRejectType, Reason: reason})
+	return fmt.Errorf("%w: refused %s: %s", ErrIncompatiblePeer, channel.remoteAddr(), reason)
+}
+
+// verifyHello checks the identity proven by the other end of the channel and records it.
+func (client *ServiceClient) verifyHello(channel *secureChannel, hello helloMessage, fromInitiator bool) error {
+	if len(hello.PublicKey) != ed25519.PublicKeySize ||
+		!ed25519.Verify(hello.PublicKey, identityPayload(channel.binding, fromInitiator, hello.Address), hello.Signature) {
+		return fmt.Errorf("%w: invalid signature from %s", ErrIdentity, channel.remoteAddr())
+	}
+	peerID := keys.PublicKeyID(hello.PublicKey)
+	if hello.NodeID != peerID {
+		return fmt.Errorf("%w: %s claims node ID %s but proved %s", ErrIdentity, channel.remoteAddr(), hello.NodeID, peerID)
+	}
+	if peerID == client.nodeID {
+		return fmt.Errorf("%w: %s is this node", ErrIdentity, channel.remoteAddr())
+	}
+
+	// The address is only claimed by the peer, secureConnection decides whether to trust it
+	channel.peerID = peerID
+	channel.peerAddress = hello.Address
+	return nil
+}
+
+// writeHello sends a handshake message.
+func writeHello(channel *secureChannel, hello helloMessage) error {
+	data, err := json.Marshal(hello)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrIdentity, err)
+	}
+	if err := channel.writeMessage(data); err != nil {
+		return fmt.Errorf("%w: %v", ErrIdentity, err)
+	}
+	return nil
+}
+
+// readHello receives a handshake message.
+func readHello(channel *secureChannel) (helloMessage, error) {
+	var hello helloMessage
+	data, err := channel.readMessage()
+	if err != nil {
+		return hello, fmt.Errorf("%w: %v", ErrIdentity, err)
+	}
+	if err := json.Unmarshal(data, &hello); err != nil {
+		return hello, fmt.Errorf("%w: %v", ErrIdentity, err)
+	}
+	return hello, nil
+}
+
+// identityPayload builds the data signed by a node to prove its identity on a channel.
+func identityPayload(binding []byte, initiator bool, address string) []byte {
+	role := "responder"
+	if initiator {
+		role = "initiator"
+	}
+	payload := append([]byte(identityDomain+role+"\x00"), binding...)
+	return append(payload, address...)
+}
+
+// intersect returns the values of a that are also in b, in the order of a.
+func intersect(a, b []string) []string {
+	common := make([]string, 0, len(a))
+	for _, value := range a {
+		if slices.Contains(b, value) && !slices.Contains(common, value) {
+			common = append(common, value)
+		}
+	}
+	return common
+}
+
+// describeFeatures formats negotiated features for the logs.
+func describeFeatures(features []string) string {
+	if len(features) == 0 {
+		return "none"
+	}
+	return strings.Join(features, ", ")
+}
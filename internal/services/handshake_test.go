@@ -0,0 +1,159 @@
+package services
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+)
+
+// newHandshakeNode creates a node offering compression if asked, enough to run handshakes.
+func newHandshakeNode(t *testing.T, compression bool) *ServiceClient {
+	t.Helper()
+	config := testConfig(t)
+	config.Compression = compression
+	return newTestNode(t, config)
+}
+
+// handshakePair runs the handshake between two clients over a new channel, returning the channels and the error of
+// the initiator and of the responder.
+func handshakePair(t *testing.T, initiator, responder *ServiceClient) (*secureChannel, *secureChannel, error, error) {
+	t.Helper()
+	initiatorChannel, responderChannel := channelPair(t, 1<<16)
+
+	responded := make(chan error, 1)
+	go func() {
+		responded <- responder.handshake(responderChannel, false)
+	}()
+	initiatorErr := initiator.handshake(initiatorChannel, true)
+	return initiatorChannel, responderChannel, initiatorErr, <-responded
+}
+
+func TestHandshakeNegotiatesDeflate(t *testing.T) {
+	tests := []struct {
+		name                 string
+		initiatorCompression bool
+		responderCompression bool
+		compress             bool
+	}{
+		{"both ends", true, true, true},
+		{"initiator only", true, false, false},
+		{"responder only", false, true, false},
+		{"neither end", false, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			initiator, responder := newHandshakeNode(t, test.initiatorCompression), newHandshakeNode(t, test.responderCompression)
+			initiatorChannel, responderChannel, initiatorErr, responderErr := handshakePair(t, initiator, responder)
+			if initiatorErr != nil || responderErr != nil {
+				t.Fatalf("handshake failed: initiator %v, responder %v", initiatorErr, responderErr)
+			}
+			if initiatorChannel.compress != test.compress || responderChannel.compress != test.compress {
+				t.Fatalf("compression is %v for the initiator and %v for the responder, expected %v",
+					initiatorChannel.compress, responderChannel.compress, test.compress)
+			}
+			if initiatorChannel.peerID != responder.nodeID || responderChannel.peerID != initiator.nodeID {
+				t.Fatal("the node IDs were not proven to the other end")
+			}
+
+			// Messages large enough to be compressed go through in both directions
+			message := bytes.Repeat([]byte("compressible "), 500)
+			for _, ends := range [][2]*secureChannel{{initiatorChannel, responderChannel}, {responderChannel, initiatorChannel}} {
+				if err := ends[0].writeMessage(message); err != nil {
+					t.Fatalf("writeMessage: %v", err)
+				}
+				received, err := ends[1].readMessage()
+				if err != nil {
+					t.Fatalf("readMessage: %v", err)
+				}
+				if !bytes.Equal(received, message) {
+					t.Fatal("message differs after going through the channel")
+				}
+			}
+		})
+	}
+}
+
+func TestCompressPayload(t *testing.T) {
+	compressible := bytes.Repeat([]byte("a"), 4*compressionThreshold)
+	if compressed := compressPayload(compressible); compressed[0] != payloadDeflate || len(compressed) >= len(compressible) {
+		t.Fatalf("compressible message encoded with flag %d in %d bytes", compressed[0], len(compressed))
+	}
+	if small := compressPayload([]byte("small")); small[0] != payloadRaw {
+		t.Fatalf("message below the threshold encoded with flag %d", small[0])
+	}
+
+	// A message inflating beyond the maximum size is refused
+	if _, err := decompressPayload(compressPayload(compressible), len(compressible)-1); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("decompressPayload of an oversize message returned %v, expected ErrFrameTooLarge", err)
+	}
+}
+
+func TestHandshakeRejectsMismatchedHello(t *testing.T) {
+	other := newHandshakeNode(t, false)
+
+	tests := []struct {
+		name   string
+		modify func(hello *helloMessage, channel *secureChannel, key ed25519.PrivateKey) // Modifies the hello of the node with the key
+		err    error
+		reject bool // Whether the responder answers with a hello_reject
+	}{
+		{"protocol version too new", func(hello *helloMessage, _ *secureChannel, _ ed25519.PrivateKey) {
+			hello.Version, hello.MinVersion = ProtocolVersion+1, ProtocolVersion+1
+		}, ErrIncompatiblePeer, true},
+		{"protocol version too old", func(hello *helloMessage, _ *secureChannel, _ ed25519.PrivateKey) {
+			hello.Version, hello.MinVersion = MinProtocolVersion-1, MinProtocolVersion-1
+		}, ErrIncompatiblePeer, true},
+		{"unknown encoding", func(hello *helloMessage, _ *secureChannel, _ ed25519.PrivateKey) {
+			hello.Encodings = []string{"cbor"}
+		}, ErrIncompatiblePeer, true},
+		{"not a hello", func(hello *helloMessage, _ *secureChannel, _ ed25519.PrivateKey) {
+			hello.Type = helloAckType
+		}, ErrIdentity, false},
+		{"node ID of another key", func(hello *helloMessage, _ *secureChannel, _ ed25519.PrivateKey) {
+			hello.NodeID = other.nodeID
+		}, ErrIdentity, false},
+		{"address changed after signing", func(hello *helloMessage, _ *secureChannel, _ ed25519.PrivateKey) {
+			hello.Address = "127.0.0.1:1"
+		}, ErrIdentity, false},
+		{"signature made for another channel", func(hello *helloMessage, channel *secureChannel, key ed25519.PrivateKey) {
+			hello.Signature = ed25519.Sign(key, identityPayload(make([]byte, len(channel.binding)), true, hello.Address))
+		}, ErrIdentity, false},
+		{"signature made as the responder", func(hello *helloMessage, channel *secureChannel, key ed25519.PrivateKey) {
+			hello.Signature = ed25519.Sign(key, identityPayload(channel.binding, false, hello.Address))
+		}, ErrIdentity, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			initiator, responder := newHandshakeNode(t, false), newHandshakeNode(t, false)
+			initiatorChannel, responderChannel := channelPair(t, 1<<16)
+
+			responded := make(chan error, 1)
+			go func() {
+				responded <- responder.handshake(responderChannel, false)
+			}()
+
+			// The hello is signed by the key of its node ID, then modified
+			hello := initiator.newHello(helloType, initiatorChannel, true)
+			hello.Version = ProtocolVersion
+			hello.MinVersion = MinProtocolVersion
+			hello.Encodings = []string{messageEncodingJSON}
+			test.modify(&hello, initiatorChannel, initiator.identity.PrivateKey)
+			if err := writeHello(initiatorChannel, hello); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := <-responded; !errors.Is(err, test.err) {
+				t.Fatalf("responder returned %v, expected %v", err, test.err)
+			}
+			if test.reject {
+				reply, err := readHello(initiatorChannel)
+				if err != nil || reply.Type != helloRejectType || reply.Reason == "" {
+					t.Fatalf("initiator received %+v, %v, expected a hello_reject with a reason", reply, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"math/rand"
+)
+
+const (
+	// decrementAtMaxProbability is the probability of decrementing a request received at the maximum HTL.
+	decrementAtMaxProbability = 0.5
+	// decrementAtMinProbability is the probability of decrementing a request received with a single hop left.
+	decrementAtMinProbability = 0.25
+)
+
+// capHTL bounds an HTL received from the network to the configured maximum.
+func (client *ServiceClient) capHTL(htl int) int {
+	if htl > client.maxHTL {
+		return client.maxHTL
+	}
+	if htl < 0 {
+		return 0
+	}
+	return htl
+}
+
+// decrementHTL returns the HTL left after the current hop.
+// With probabilistic HTL, requests at the maximum or with one hop left are sometimes not decremented,
+// so that a neighbor cannot tell whether the previous node created the request or only forwarded it.
+func (client *ServiceClient) decrementHTL(htl int) int {
+	htl = client.capHTL(htl)
+	if htl == 0 {
+		return 0
+	}
+
+	if client.probabilisticHTL {
+		if htl == client.maxHTL && rand.Float64() >= decrementAtMaxProbability {
+			return htl
+		}
+		if htl == 1 && rand.Float64() >= decrementAtMinProbability {
+			return htl
+		}
+	}
+	return htl - 1
+}
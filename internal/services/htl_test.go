@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"freenet/internal/models"
+)
+
+func TestDecrementHTL(t *testing.T) {
+	client := &ServiceClient{maxHTL: 18}
+	tests := []struct {
+		htl      int
+		expected int
+	}{
+		{18, 17},
+		{5, 4},
+		{1, 0},
+		{0, 0},
+		{-3, 0},
+		{100, 17}, // Capped to the maximum before the decrement
+	}
+	for _, test := range tests {
+		if htl := client.decrementHTL(test.htl); htl != test.expected {
+			t.Errorf("decrementHTL(%d) = %d, expected %d", test.htl, htl, test.expected)
+		}
+	}
+}
+
+func TestDecrementHTLProbabilistic(t *testing.T) {
+	client := &ServiceClient{maxHTL: 18, probabilisticHTL: true}
+	tests := []struct {
+		htl     int
+		results []int // Every HTL that may be returned, each of them expected at least once
+	}{
+		{18, []int{18, 17}},
+		{5, []int{4}},
+		{1, []int{1, 0}},
+		{0, []int{0}},
+	}
+
+	for _, test := range tests {
+		seen := make(map[int]bool)
+		for i := 0; i < 1000; i++ {
+			htl := client.decrementHTL(test.htl)
+			if !slices.Contains(test.results, htl) {
+				t.Fatalf("decrementHTL(%d) = %d, expected one of %v", test.htl, htl, test.results)
+			}
+			seen[htl] = true
+		}
+		if len(seen) != len(test.results) {
+			t.Errorf("decrementHTL(%d) returned %v over 1000 draws, expected each of %v", test.htl, seen, test.results)
+		}
+	}
+}
+
+func TestSearchStopsWhenHTLRunsOut(t *testing.T) {
+	tests := []struct {
+		name string
+		htl  int
+		err  error
+	}{
+		// The middle node receives the request with a single hop left, uses it and has none to forward it with
+		{"one hop", 1, ErrRouteNotFound},
+		// The last node answers even with no hop left, as it holds the file
+		{"two hops", 2, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := testConfig(t)
+			config.DefaultHTL = test.htl
+			origin, middle, holder := startTestNode(t, config), startTestNode(t, testConfig(t)), startTestNode(t, testConfig(t))
+			link(origin, middle, holder)
+			if err := holder.warehouse.StoreFile("50", "local"); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := origin.Search(context.Background(), "50")
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Search returned %v, expected %v", err, test.err)
+			}
+			if err == nil && (result.Location != holder.NodeID() || result.Hops != 2) {
+				t.Fatalf("Search found the file at %s after %d hops, expected %s after 2 hops", result.Location, result.Hops, holder.NodeID())
+			}
+
+			// The middle node recorded the request with the HTL left after its own hop
+			requests := middle.Requests()
+			if len(requests) != 1 {
+				t.Fatalf("middle node holds %d requests, expected 1", len(requests))
+			}
+			for _, request := range requests {
+				if request.HTL != test.htl-1 {
+					t.Fatalf("middle node recorded HTL %d, expected %d", request.HTL, test.htl-1)
+				}
+				if err != nil && request.Status != models.RequestFailed {
+					t.Fatalf("middle node left the request %s", request.Status)
+				}
+			}
+		})
+	}
+}
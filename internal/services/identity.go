@@ -0,0 +1,33 @@
+package services
+
+import (
+	"freenet/internal/keys"
+	"freenet/internal/logger"
+	"os"
+	"strings"
+)
+
+// LoadOrCreateIdentity loads the identity key pair of the node, generating one on first use.
+// The node ID is the hash of its public key, so it stays the same when the node changes address.
+func LoadOrCreateIdentity(path string) (*keys.KeyPair, error) {
+	if _, err := os.Stat(path); err == nil {
+		return keys.LoadKeyPair(path)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	keyPair, err := keys.GenerateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	if err := keyPair.Save(path); err != nil {
+		return nil, err
+	}
+	logger.GlobalLogger.Info("Generated a new node identity in " + path)
+	return keyPair, nil
+}
+
+// isNodeID tells whether a neighbor is designated by its node ID rather than by its address.
+func isNodeID(neighbor string) bool {
+	return neighbor != "" && neighbor != "local" && !strings.Contains(neighbor, ":")
+}
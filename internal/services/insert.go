@@ -0,0 +1,262 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"freenet/internal/events"
+	"freenet/internal/keys"
+	"freenet/internal/logger"
+	"freenet/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Insert publishes content into the network and blocks until the insert is acknowledged, rejected or times out.
+// The content is stored on every node of the path, which is routed like a search. When no key is given,
+// the content is encrypted and inserted under its content hash key. The key the file was inserted under
+// is returned in the result. Content larger than a block is inserted as a splitfile, the key then designating
+// its manifest.
+func (client *ServiceClient) Insert(ctx context.Context, key string, data []byte) (Result, error) {
+	data, err := client.splitContent(ctx, data)
+	if err != nil {
+		return Result{Key: key, Status: models.RequestFailed}, err
+	}
+	if key != "" {
+		return client.insert(ctx, key, data)
+	}
+
+	uri, block := keys.EncryptCHK(data)
+	routingKey, _ := keys.RoutingKey(uri)
+	result, err := client.insert(ctx, routingKey, block)
+	result.Key = uri
+	return result, err
+}
+
+// insert publishes a single block of content into the network under its routing key.
+func (client *ServiceClient) insert(ctx context.Context, key string, data []byte) (Result, error) {
+	if err := keys.Verify(key, data); err != nil {
+		return Result{Key: key, Status: models.RequestFailed}, err
+	}
+	if client.collides(key, data) {
+		return Result{Key: key, Location: client.nodeID, Status: models.RequestFailed}, ErrKeyCollision
+	}
+
+	// The inserter is the first node of the path
+	if err := client.storeLocally(key, data); err != nil {
+		return Result{Key: key, Status: models.RequestFailed}, err
+	}
+
+	// Step 1: Generate a new UUID for the RequestID
+	requestID := uuid.New().String()
+
+	// Step 2: Store the insert in the RequestsStore
+	future := newSearchFuture()
+	client.searches.add(requestID, future)
+	client.requestsStore.AddInsertRequest(requestID, key, "local", []string{}, client.capHTL(client.defaultHTL), data)
+
+	// Step 3: Log the new insert
+	logger.GlobalLogger.Info("New insert request created for file " + key + ": " + requestID)
+	client.publish(events.Event{Type: events.RequestCreated, RequestID: requestID, Key: key, Insert: true, Peer: "local", HTL: client.capHTL(client.defaultHTL)})
+
+	// Step 4: Give up on the insert if it is not acknowledged in time
+	client.startDeadline(requestID)
+
+	client.handleRequest(requestID)
+
+	return future.Wait(ctx)
+}
+
+// InsertSigned encrypts and signs a document with the key pair and inserts it under the signed subspace key of the
+// document name. The signed subspace key is returned in the result.
+func (client *ServiceClient) InsertSigned(ctx context.Context, keyPair *keys.KeyPair, docName string, data []byte) (Result, error) {
+	data, err := client.splitContent(ctx, data)
+	if err != nil {
+		return Result{Status: models.RequestFailed}, err
+	}
+	key, routingKey, block, err := keyPair.Sign(docName, data)
+	if err != nil {
+		return Result{Status: models.RequestFailed}, err
+	}
+	result, err := client.insert(ctx, routingKey, block)
+	result.Key = key
+	return result, err
+}
+
+// handleInsertMessage processes an InsertMessage
+func (client *ServiceClient) handleInsertMessage(msg models.InsertMessage, senderID string) {
+	// Check if the insert has already been processed
+	if client.refuseProcessedRequest(msg.RequestID, senderID) {
+		return
+	}
+
+	// Never store or forward content that does not match its key
+	if err := keys.Verify(msg.Key, msg.Data); err != nil {
+		logger.GlobalLogger.Error("Rejecting insert " + msg.RequestID + " from " + senderID + ": " + err.Error())
+		client.penalizePeer(senderID, err.Error())
+
+		refusalMessage := models.NegativeMessage{
+			RequestID: msg.RequestID,
+		}
+		success, err := client.sendMessageToNeighbor(senderID, "negative", refusalMessage)
+		if !success {
+			logger.GlobalLogger.Error("Failed to send negative message to parent node " + senderID + " for rejected insert " + msg.RequestID + ": " + err.Error())
+		}
+		return
+	}
+
+	// Never replace different content already stored under the key, the insert fails instead
+	if client.collides(msg.Key, msg.Data) {
+		logger.GlobalLogger.Warn("Insert " + msg.RequestID + " from " + senderID + " collides with the content of " + msg.Key + " stored here")
+		client.publish(events.Event{Type: events.RequestNegative, RequestID: msg.RequestID, Key: msg.Key, Insert: true, Peer: senderID, Location: client.nodeID, Reason: "key collision"})
+		client.replyCollision(senderID, models.InsertCollisionMessage{RequestID: msg.RequestID, NodeID: client.nodeID})
+		return
+	}
+
+	// Store the file on this node of the path
+	if err := client.storeLocally(msg.Key, msg.Data); err != nil {
+		logger.GlobalLogger.Error("Failed to store inserted file " + msg.Key + ": " + err.Error())
+	}
+
+	// Add the insert to the RequestsStore with the HTL left after this hop
+	htl := client.decrementHTL(msg.HTL)
+	client.requestsStore.AddInsertRequest(msg.RequestID, msg.Key, senderID, []string{senderID}, htl, msg.Data) // visited neighbors: [senderID]
+	client.publish(events.Event{Type: events.RequestCreated, RequestID: msg.RequestID, Key: msg.Key, Insert: true, Peer: senderID, HTL: htl})
+
+	// The insert ends here once it is not allowed to travel any further
+	if htl == 0 {
+		client.finishInsert(msg.RequestID)
+		return
+	}
+
+	client.handleRequest(msg.RequestID)
+}
+
+// finishInsert completes an insert whose path ends on this node and acknowledges it toward the inserter.
+func (client *ServiceClient) finishInsert(requestID string) {
+	request, completed := client.requestsStore.Complete(requestID, models.RequestFulfilled)
+	if !completed {
+		return
+	}
+	client.stopTimers(requestID)
+	client.forgetRequest(requestID)
+	client.publish(events.Event{Type: events.RequestPositive, RequestID: requestID, Key: request.Key, Insert: true, Location: client.nodeID})
+
+	if request.NodeID == "local" {
+		logger.GlobalLogger.Info("Your insert " + requestID + " of file " + request.Key + " completed without reaching any neighbor")
+		client.completeSearch(requestID, Result{Key: request.Key, Location: client.nodeID, Hops: 0, Status: models.RequestFulfilled}, nil)
+		return
+	}
+
+	ackMessage := models.InsertAckMessage{
+		RequestID:   requestID,
+		NodeID:      client.nodeID,
+		NodeAddress: client.listeningAddress,
+		Hops:        1, // The parent node is one hop away
+	}
+
+	success, err := client.sendMessageToNeighbor(request.NodeID, "insert_ack", ackMessage)
+	if success {
+		logger.GlobalLogger.Info("Insert " + requestID + " of file " + request.Key + " ends here, acknowledgement sent to parent node " + request.NodeID)
+	} else {
+		logger.GlobalLogger.Error("Failed to send insert acknowledgement to parent node " + request.NodeID + " for request " + requestID + ": " + err.Error())
+	}
+}
+
+// handleInsertAckMessage processes an InsertAckMessage
+func (client *ServiceClient) handleInsertAckMessage(msg models.InsertAckMessage, senderID string) {
+	if !client.acceptReply(msg.RequestID, senderID) {
+		return
+	}
+	request, completed := client.requestsStore.Complete(msg.RequestID, models.RequestFulfilled)
+	if !completed {
+		return
+	}
+
+	client.stopTimers(msg.RequestID)
+	client.forgetRequest(msg.RequestID)
+	client.publish(events.Event{
+		Type:      events.RequestPositive,
+		RequestID: msg.RequestID,
+		Key:       request.Key,
+		Insert:    true,
+		Peer:      senderID,
+		Location:  msg.NodeID,
+		Hops:      msg.Hops,
+	})
+
+	if request.NodeID == "local" {
+		logger.GlobalLogger.Info("Your insert " + msg.RequestID + " of file " + request.Key + " was acknowledged, last stored by node " + msg.NodeID)
+		client.completeSearch(msg.RequestID, Result{Key: request.Key, Location: msg.NodeID, Hops: msg.Hops, Status: models.RequestFulfilled}, nil)
+		return
+	}
+
+	// Forward the acknowledgement to the parent node, counting the hop back
+	msg.Hops++
+	success, err := client.sendMessageToNeighbor(request.NodeID, "insert_ack", msg)
+	if success {
+		logger.GlobalLogger.Info("Insert acknowledgement for request " + msg.RequestID + " sent to parent node " + request.NodeID)
+	} else {
+		logger.GlobalLogger.Error("Failed to send insert acknowledgement to parent node " + request.NodeID + " for request " + msg.RequestID + ": " + err.Error())
+	}
+}
+
+// insertData returns the content carried by an insert, read back from the datastore once the insert was forwarded.
+func (client *ServiceClient) insertData(request models.Request) ([]byte, error) {
+	if request.Data != nil {
+		return request.Data, nil
+	}
+	data, err := client.datastore.Get(request.Key)
+	if err != nil {
+		return nil, fmt.Errorf("content of %s no longer in the datastore: %v", request.Key, err)
+	}
+	return data, nil
+}
+
+// collides reports whether the datastore already holds different content under the key. Content hash keys cannot
+// collide once verified, but a signed key can be signed again over another content and a plain key carries anything.
+func (client *ServiceClient) collides(key string, data []byte) bool {
+	stored, err := client.datastore.Get(key)
+	return err == nil && !bytes.Equal(stored, data)
+}
+
+// handleInsertCollisionMessage processes an InsertCollisionMessage, ending the insert as failed and telling the inserter.
+func (client *ServiceClient) handleInsertCollisionMessage(msg models.InsertCollisionMessage, senderID string) {
+	if !client.acceptReply(msg.RequestID, senderID) {
+		return
+	}
+	request, failed := client.requestsStore.Complete(msg.RequestID, models.RequestFailed)
+	if !failed {
+		return
+	}
+
+	client.stopTimers(msg.RequestID)
+	client.forgetRequest(msg.RequestID)
+	client.publish(events.Event{
+		Type:      events.RequestNegative,
+		RequestID: msg.RequestID,
+		Key:       request.Key,
+		Insert:    true,
+		Peer:      senderID,
+		Location:  msg.NodeID,
+		Reason:    "key collision",
+	})
+
+	if request.NodeID == "local" {
+		logger.GlobalLogger.Error("Your insert " + msg.RequestID + " of file " + request.Key + " collided with different content held by node " + msg.NodeID)
+		client.completeSearch(msg.RequestID, Result{Key: request.Key, Location: msg.NodeID, Status: models.RequestFailed}, ErrKeyCollision)
+		return
+	}
+
+	client.replyCollision(request.NodeID, msg)
+}
+
+// replyCollision tells the parent node of an insert that the insert collided with different content.
+func (client *ServiceClient) replyCollision(parentID string, msg models.InsertCollisionMessage) {
+	success, err := client.sendMessageToNeighbor(parentID, "insert_collision", msg)
+	if success {
+		logger.GlobalLogger.Warn("Insert collision for request " + msg.RequestID + " sent to parent node " + parentID)
+	} else {
+		logger.GlobalLogger.Error("Failed to send insert collision to parent node " + parentID + " for request " + msg.RequestID + ": " + err.Error())
+	}
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"freenet/internal/logger"
+	"freenet/internal/models"
+	"sync"
+	"time"
+)
+
+// loggingMiddleware logs every message received and the failure of its handler.
+func loggingMiddleware(next MessageHandler) MessageHandler {
+	return func(peerID string, msg models.Message) error {
+		description := "Receive a " + msg.Type + " message from " + msg.SenderID
+		if requestID := requestIDOf(msg); requestID != "" {
+			description += " for request " + requestID
+		}
+		logger.GlobalLogger.Info(description)
+
+		err := next(peerID, msg)
+		if err != nil {
+			logger.GlobalLogger.Error("Failed to handle " + msg.Type + " message from " + msg.SenderID + ": " + err.Error())
+		}
+		return err
+	}
+}
+
+// authMiddleware rejects the messages sent on behalf of another node than the one that proved its node ID on the connection.
+func authMiddleware(next MessageHandler) MessageHandler {
+	return func(peerID string, msg models.Message) error {
+		if msg.SenderID != peerID {
+			return fmt.Errorf("%w: %s sent a message on behalf of %s", ErrUnauthorized, peerID, msg.SenderID)
+		}
+		return next(peerID, msg)
+	}
+}
+
+// peerTrackingMiddleware keeps track of the neighbor that sent a message and of the location it advertises.
+func (client *ServiceClient) peerTrackingMiddleware(next MessageHandler) MessageHandler {
+	return func(peerID string, msg models.Message) error {
+		client.peerSeen(msg.SenderID, msg.SenderLocation)
+		return next(peerID, msg)
+	}
+}
+
+// MessageStats counts the messages of a type received from the neighbors.
+type MessageStats struct {
+	Received int           `json:"received"`    // Number of messages received
+	Failed   int           `json:"failed"`      // Number of messages that could not be handled
+	Duration time.Duration `json:"duration_ns"` // Total time spent handling the messages
+}
+
+// unknownMessageStats is the key the messages of unregistered types are counted under, so that
+// neighbors cannot grow the metrics without bound.
+const unknownMessageStats = "unknown"
+
+// messageMetrics collects the statistics of the messages received, by type.
+type messageMetrics struct {
+	mu    sync.Mutex
+	stats map[string]MessageStats
+}
+
+// newMessageMetrics creates empty message statistics.
+func newMessageMetrics() *messageMetrics {
+	return &messageMetrics{stats: make(map[string]MessageStats)}
+}
+
+// middleware counts the messages handled and the time spent handling them.
+func (metrics *messageMetrics) middleware(next MessageHandler) MessageHandler {
+	return func(peerID string, msg models.Message) error {
+		start := time.Now()
+		err := next(peerID, msg)
+
+		key := msg.Type
+		if errors.Is(err, ErrUnknownMessageType) {
+			key = unknownMessageStats
+		}
+
+		metrics.mu.Lock()
+		defer metrics.mu.Unlock()
+		stats := metrics.stats[key]
+		stats.Received++
+		if err != nil {
+			stats.Failed++
+		}
+		stats.Duration += time.Since(start)
+		metrics.stats[key] = stats
+		return err
+	}
+}
+
+// snapshot returns a copy of the statistics.
+func (metrics *messageMetrics) snapshot() map[string]MessageStats {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	stats := make(map[string]MessageStats, len(metrics.stats))
+	for messageType, typeStats := range metrics.stats {
+		stats[messageType] = typeStats
+	}
+	return stats
+}
+
+// MessageStats returns the statistics of the messages received since the node started, by message type.
+func (client *ServiceClient) MessageStats() map[string]MessageStats {
+	return client.metrics.snapshot()
+}
+
+// rateLimiter limits the number of messages accepted from each neighbor with a token bucket per neighbor.
+// A neighbor may send a burst of up to a second worth of messages at once.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64 // Messages per second accepted from a single neighbor
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time // Last time the idle buckets were evicted
+}
+
+// bucketRefillTime is the time after which the bucket of an idle neighbor is full again, and can be forgotten
+// since a new bucket would be the same.
+const bucketRefillTime = time.Second
+
+// tokenBucket holds the messages a neighbor is still allowed to send.
+type tokenBucket struct {
+	tokens float64   // Messages that can be sent right away
+	last   time.Time // Last time the bucket was refilled
+}
+
+// newRateLimiter creates a rate limiter accepting rate messages per second from each neighbor.
+func newRateLimiter(rate int) *rateLimiter {
+	return &rateLimiter{rate: float64(rate), buckets: make(map[string]*tokenBucket)}
+}
+
+// allow tells whether a neighbor may send one more message now, and takes it from its bucket.
+func (limiter *rateLimiter) allow(peerID string) bool {
+	return limiter.allowAt(peerID, time.Now())
+}
+
+// allowAt tells whether a neighbor may send one more message at the given time, and takes it from its bucket.
+// The buckets of the neighbors idle for long enough to have refilled are evicted at most once per refill time.
+func (limiter *rateLimiter) allowAt(peerID string, now time.Time) bool {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	if now.Sub(limiter.lastSweep) >= bucketRefillTime {
+		for id, bucket := range limiter.buckets {
+			if now.Sub(bucket.last) >= bucketRefillTime {
+				delete(limiter.buckets, id)
+			}
+		}
+		limiter.lastSweep = now
+	}
+
+	bucket, exists := limiter.buckets[peerID]
+	if !exists {
+		bucket = &tokenBucket{tokens: limiter.rate, last: now}
+		limiter.buckets[peerID] = bucket
+	}
+	bucket.tokens = min(limiter.rate, bucket.tokens+now.Sub(bucket.last).Seconds()*limiter.rate)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// middleware drops the messages of the neighbors exceeding their rate.
+func (limiter *rateLimiter) middleware(next MessageHandler) MessageHandler {
+	return func(peerID string, msg models.Message) error {
+		if !limiter.allow(peerID) {
+			return fmt.Errorf("%w: %s", ErrRateLimited, peerID)
+		}
+		return next(peerID, msg)
+	}
+}
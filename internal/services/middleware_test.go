@@ -0,0 +1,46 @@
+package services
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(2)
+	start := time.Now()
+
+	// A burst of a second worth of messages is accepted, then the neighbor has to wait
+	for i, expected := range []bool{true, true, false} {
+		if allowed := limiter.allowAt("peer", start); allowed != expected {
+			t.Fatalf("message %d allowed: %v, expected %v", i, allowed, expected)
+		}
+	}
+	if !limiter.allowAt("other", start) {
+		t.Fatal("the rate of a neighbor was applied to another one")
+	}
+	if !limiter.allowAt("peer", start.Add(time.Second/2)) {
+		t.Fatal("the bucket was not refilled over time")
+	}
+}
+
+func TestRateLimiterEvictsIdleBuckets(t *testing.T) {
+	limiter := newRateLimiter(10)
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		limiter.allowAt("peer-"+strconv.Itoa(i), start)
+	}
+
+	// Once the idle buckets are full again, the next message sweeps them
+	limiter.allowAt("active", start.Add(bucketRefillTime))
+	if len(limiter.buckets) != 1 {
+		t.Fatalf("%d buckets left after the sweep, expected only the active neighbor", len(limiter.buckets))
+	}
+
+	// An evicted neighbor starts again with a full bucket
+	for i := 0; i < 10; i++ {
+		if !limiter.allowAt("peer-0", start.Add(bucketRefillTime)) {
+			t.Fatalf("message %d of an evicted neighbor refused", i)
+		}
+	}
+}
@@ -1,10 +1,42 @@
 package services
 
 import (
+	"freenet/internal/logger"
 	"freenet/internal/models"
 )
 
 // handleNegativeMessage processes a NegativeMessage
-func (client *ServiceClient) handleNegativeMessage(msg models.NegativeMessage, senderID string) { // unused senderID, maybe remove
+func (client *ServiceClient) handleNegativeMessage(msg models.NegativeMessage, senderID string) {
+	if !client.acceptReply(msg.RequestID, senderID) {
+		return
+	}
 	client.handleRequest(msg.RequestID)
 }
+
+// acceptReply checks that a reply comes from the neighbor the request is waiting for,
+// and stops waiting for it. Replies arriving after the neighbor timed out are ignored.
+// The check and the transition are atomic, so that a reply racing the timeout of the neighbor moves the request on once.
+func (client *ServiceClient) acceptReply(requestID, senderID string) bool {
+	if !client.releasePendingNeighbor(requestID, senderID) {
+		logger.GlobalLogger.Debug("Ignoring late or unexpected reply from " + senderID + " for request " + requestID)
+		return false
+	}
+	client.stopHopTimer(requestID)
+	return true
+}
+
+// releasePendingNeighbor stops waiting for a neighbor, designated by its node ID or by the address it was contacted at,
+// if the request is still waiting for it. Only one reply, or the timeout of the neighbor, can thus move the request on.
+func (client *ServiceClient) releasePendingNeighbor(requestID, neighbor string) bool {
+	_, released := client.requestsStore.UpdateIf(requestID, func(request *models.Request) bool {
+		if request.Status != models.RequestPending || request.PendingNeighbor == "" {
+			return false
+		}
+		if request.PendingNeighbor != neighbor && client.canonicalNeighbor(request.PendingNeighbor) != client.canonicalNeighbor(neighbor) {
+			return false
+		}
+		request.PendingNeighbor = ""
+		return true
+	})
+	return released
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"freenet/internal/logger"
 	"freenet/internal/models"
@@ -10,6 +11,10 @@ import (
 	"net"
 )
 
+// maxConcurrentDispatches bounds the handlers running at once for the messages of a connection.
+// Beyond it, the connection is not read any further until a handler returns.
+const maxConcurrentDispatches = 64
+
 // startListening starts a TCP server to listen for incoming requests from other nodes.
 func (client *ServiceClient) startListening(ctx context.Context) error {
 	// Listen on the configured address and port
@@ -17,9 +22,17 @@ func (client *ServiceClient) startListening(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to start listening on %s: %v", client.listeningAddress, err)
 	}
+	// The port may have been chosen by the system, neighbors are given the one actually listened on
+	client.listeningAddress = listener.Addr().String()
 
 	logger.GlobalLogger.Info("Listening for incoming requests on " + client.listeningAddress + "...")
 
+	// Closing the listener unblocks the pending Accept on shutdown
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
 	go func() {
 		defer listener.Close()
 
@@ -33,6 +46,9 @@ func (client *ServiceClient) startListening(ctx context.Context) error {
 				// Accept incoming connections
 				conn, err := listener.Accept()
 				if err != nil {
+					if ctx.Err() != nil {
+						continue
+					}
 					logger.GlobalLogger.Error("Error accepting connection: " + err.Error())
 					continue
 				}
@@ -47,74 +63,88 @@ func (client *ServiceClient) startListening(ctx context.Context) error {
 	return nil
 }
 
-// handleIncomingConnection processes incoming messages from other nodes.
+// handleIncomingConnection secures the connection of the node that connected, then processes its messages.
 func (client *ServiceClient) handleIncomingConnection(conn net.Conn) {
-	defer conn.Close()
+	channel, err := client.secureConnection(conn, "", "")
+	if err != nil {
+		logger.GlobalLogger.Error("Failed to secure connection from " + conn.RemoteAddr().String() + ": " + err.Error())
+		conn.Close()
+		return
+	}
+	client.readMessages(channel, nil)
+}
 
+// readMessages reads and dispatches the messages of a connection until it is closed.
+// The connection is either accepted from a neighbor or dialed by the connection manager (peer is then set).
+// Accepted connections are adopted by the connection manager so that replies reuse them.
+func (client *ServiceClient) readMessages(channel *secureChannel, peer *peerConnection) {
+	if peer == nil {
+		peer = client.connections.adopt(channel.peerID, channel)
+	}
+	defer func() {
+		if peer != nil {
+			peer.close()
+		} else {
+			channel.close()
+		}
+	}()
+
+	dispatches := make(chan struct{}, maxConcurrentDispatches)
 	for {
-		// Read and process the incoming message
-		data := make([]byte, 4096) // Buffer to hold incoming data
-		n, err := conn.Read(data)
+		// Read and decrypt the next frame from the connection
+		data, err := channel.readMessage()
 		if err != nil {
 			if err == io.EOF {
 				// Connection was closed by the sender; this is expected.
-				logger.GlobalLogger.Debug("Connection closed by " + conn.RemoteAddr().String())
+				logger.GlobalLogger.Debug("Connection closed by " + channel.remoteAddr())
 				return
 			}
-			logger.GlobalLogger.Error("Failed to read data from connection " + conn.RemoteAddr().String() + ": " + err.Error())
+			// The stream cannot be resynchronised after a bad frame, drop the connection
+			logger.GlobalLogger.Error("Failed to read frame from connection " + channel.remoteAddr() + ": " + err.Error())
 			return
 		}
-		// Trim the data to the number of bytes actually read
-		trimmedData := data[:n]
 
 		// Unmarshal the wrapper message
 		var msg models.Message
-		err = json.Unmarshal(trimmedData, &msg)
+		err = json.Unmarshal(data, &msg)
 		if err != nil {
-			logger.GlobalLogger.Error("Failed to unmarshal message from " + conn.RemoteAddr().String() + ": " + err.Error())
-			return
+			// Frame boundaries are intact, skip this message and keep reading
+			logger.GlobalLogger.Error("Failed to unmarshal message from " + channel.remoteAddr() + ": " + err.Error())
+			continue
 		}
 
-		// Switch based on the message type
-		switch msg.Type {
-		case "request":
-			var requestMsg models.RequestMessage
-			err := json.Unmarshal(msg.Data, &requestMsg)
-			if err == nil {
-				logger.GlobalLogger.Info("Receive a request message for file " + requestMsg.Key + " from " + msg.SenderID + " with request ID " + requestMsg.RequestID)
-				client.handleRequestMessage(requestMsg, msg.SenderID)
-			} else {
-				logger.GlobalLogger.Error("Failed to read request message from " + msg.SenderID + ": " + err.Error())
-			}
-		case "positive":
-			var positiveMsg models.PositiveMessage
-			err := json.Unmarshal(msg.Data, &positiveMsg)
-			if err == nil {
-				logger.GlobalLogger.Info("Receive a positive message for request " + positiveMsg.RequestID + " from " + msg.SenderID + " with node ID " + positiveMsg.NodeID)
-				client.handlePositiveMessage(positiveMsg, msg.SenderID)
-			} else {
-				logger.GlobalLogger.Error("Failed to read positive message from " + msg.SenderID + ": " + err.Error())
-			}
-		case "negative":
-			var negativeMsg models.NegativeMessage
-			err := json.Unmarshal(msg.Data, &negativeMsg)
-			if err == nil {
-				logger.GlobalLogger.Warn("Receive a negative message for request " + negativeMsg.RequestID + " from " + msg.SenderID)
-				client.handleNegativeMessage(negativeMsg, msg.SenderID)
-			} else {
-				logger.GlobalLogger.Error("Failed to read negative message from " + msg.SenderID + ": " + err.Error())
-			}
-		default:
-			logger.GlobalLogger.Error("Unknown message type received from " + msg.SenderID + ": " + msg.Type)
-		}
+		// Handlers run apart from the read loop, so that a handler waiting for a message arriving on this very
+		// connection (a reply, a cancellation) does not keep it from being read
+		dispatches <- struct{}{}
+		go func() {
+			defer func() { <-dispatches }()
+			client.dispatch(channel, peer, msg)
+		}()
+	}
+}
 
+// dispatch runs the handler registered for the type of a message read from the connection.
+func (client *ServiceClient) dispatch(channel *secureChannel, peer *peerConnection, msg models.Message) {
+	err := client.handlers.Dispatch(channel.peerID, msg)
+	if errors.Is(err, ErrUnauthorized) {
+		// A node can only speak for the node ID it proved during the handshake, closing the connection ends its
+		// read loop
+		logger.GlobalLogger.Error("Rejecting connection from " + channel.peerID + " at " + channel.remoteAddr() + ": " + err.Error())
+		channel.close()
+		return
+	}
+	if peer != nil {
+		peer.touch()
+	}
+	if err != nil {
+		client.replyError(channel.peerID, msg, err)
 	}
 }
 
 // sendMessageToNeighbor sends any message to a neighbor and returns a boolean indicating success or failure.
 // It wraps the message in a Message struct with the given message type and sender ID.
 func (client *ServiceClient) sendMessageToNeighbor(neighborID string, messageType string, messagePayload interface{}) (bool, error) {
-	// Marshal the actual message (e.g., RequestMessage, PositiveMessage, NegativeMessage)
+	// Marshal the actual message (e.g., RequestMessage, PositiveMessage, NegativeMessage, DataReplyMessage)
 	messageData, err := json.Marshal(messagePayload)
 	if err != nil {
 		return false, fmt.Errorf("Failed to marshal message payload: %v", err)
@@ -122,9 +152,10 @@ func (client *ServiceClient) sendMessageToNeighbor(neighborID string, messageTyp
 
 	// Create the wrapper Message struct
 	wrappedMessage := models.Message{
-		Type:     messageType,
-		Data:     messageData,
-		SenderID: client.listeningAddress,
+		Type:           messageType,
+		Data:           messageData,
+		SenderID:       client.nodeID,
+		SenderLocation: client.location,
 	}
 
 	// Marshal the wrapped message into JSON
@@ -133,18 +164,10 @@ func (client *ServiceClient) sendMessageToNeighbor(neighborID string, messageTyp
 		return false, fmt.Errorf("Failed to marshal wrapped message: %v", err)
 	}
 
-	// Establish a TCP connection to the neighbor
-	conn, err := net.Dial("tcp", neighborID)
-	if err != nil {
-		return false, fmt.Errorf("Failed to connect to neighbor %s: %v", neighborID, err)
-	}
-	defer conn.Close()
-
-	// Send the wrapped message to the neighbor
-	_, err = conn.Write(wrappedMessageData)
+	// Send the wrapped message to the neighbor over its pooled connection
+	err = client.connections.Send(neighborID, messageType, wrappedMessageData)
 	if err != nil {
 		return false, fmt.Errorf("Failed to send message to neighbor %s: %v", neighborID, err)
-
 	}
 
 	// Successfully sent the message
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"freenet/internal/models"
+	"testing"
+	"time"
+)
+
+func TestHandlerWaitingForNextMessage(t *testing.T) {
+	sender, receiver := startTestNode(t, testConfig(t)), startTestNode(t, testConfig(t))
+	link(sender, receiver)
+
+	// The handler of the first message waits for the second one, which arrives on the same connection
+	second, done := make(chan struct{}), make(chan struct{})
+	receiver.Handlers().Register("first", func(string, models.Message) error {
+		select {
+		case <-second:
+			close(done)
+		case <-time.After(5 * time.Second):
+		}
+		return nil
+	})
+	receiver.Handlers().Register("second", func(string, models.Message) error {
+		close(second)
+		return nil
+	})
+
+	if _, err := sender.sendMessageToNeighbor(receiver.Address(), "first", struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sender.sendMessageToNeighbor(receiver.NodeID(), "second", struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	receiver.connections.mu.Lock()
+	connections := len(receiver.connections.conns)
+	receiver.connections.mu.Unlock()
+	if connections != 1 {
+		t.Fatalf("%d connections to the receiver, expected both messages on the same one", connections)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the second message was not read while the handler of the first one was running")
+	}
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"fmt"
+	"freenet/internal/events"
+	"freenet/internal/logger"
+	"freenet/internal/models"
+	"strconv"
+)
+
+// maxPeerPenalty is the penalty from which a neighbor is no longer used for routing.
+const maxPeerPenalty = 3
+
+// addPeer records a neighbor in the peer table, placed at the location its node ID maps to until it advertises its own.
+// The node ID is empty for a neighbor only known by its address, and the address is empty when it is not known.
+func (client *ServiceClient) addPeer(nodeID, address string) {
+	if nodeID == client.nodeID || address == client.listeningAddress || address == "local" {
+		return
+	}
+	key := models.Peer{ID: nodeID, Address: address}.Key()
+	if key == "" {
+		return
+	}
+	if err := client.peers.AddPeer(nodeID, address, client.router.Location(key)); err != nil {
+		logger.GlobalLogger.Error("Failed to add peer " + key + ": " + err.Error())
+	}
+}
+
+// identifyPeer records the node ID a neighbor proved along with the address it currently listens on.
+// The address is verified when the neighbor was reached at it, and only announced by the neighbor otherwise.
+func (client *ServiceClient) identifyPeer(nodeID, address string, verified bool) {
+	if err := client.peers.Identify(nodeID, address, verified); err != nil {
+		logger.GlobalLogger.Error("Failed to update peer " + nodeID + ": " + err.Error())
+	}
+}
+
+// peerSeen records a message received from a neighbor with the location it advertised.
+func (client *ServiceClient) peerSeen(nodeID string, location uint64) {
+	if nodeID == "" || nodeID == client.nodeID {
+		return
+	}
+	if err := client.peers.Seen(nodeID, location); err != nil {
+		logger.GlobalLogger.Error("Failed to update peer " + nodeID + ": " + err.Error())
+	}
+}
+
+// setPeerState records the state of the connection to a neighbor, and publishes it when it changes.
+func (client *ServiceClient) setPeerState(neighbor string, state models.PeerState) {
+	changed, err := client.peers.SetState(neighbor, state)
+	if err != nil {
+		logger.GlobalLogger.Error("Failed to update peer " + neighbor + ": " + err.Error())
+	}
+	if !changed {
+		return
+	}
+
+	eventType := events.PeerDown
+	if state == models.PeerConnected {
+		eventType = events.PeerUp
+	}
+	_, address, _ := client.resolveNeighbor(neighbor)
+	client.publish(events.Event{Type: eventType, Peer: neighbor, Address: address})
+}
+
+// penalizePeer records a misbehaviour of a neighbor, such as sending content that does not match its key.
+func (client *ServiceClient) penalizePeer(neighbor, reason string) {
+	neighbor = client.canonicalNeighbor(neighbor)
+	penalty, err := client.peers.Penalize(neighbor)
+	if err != nil {
+		logger.GlobalLogger.Error("Failed to penalize peer " + neighbor + ": " + err.Error())
+	}
+
+	logger.GlobalLogger.Warn("Peer " + neighbor + " penalized (" + strconv.Itoa(penalty) + "): " + reason)
+	if penalty == maxPeerPenalty {
+		logger.GlobalLogger.Warn("Peer " + neighbor + " is no longer used for routing")
+	}
+}
+
+// resolveNeighbor returns the node ID and the current address of a neighbor designated by either of them.
+// The node ID is empty for a neighbor only known by its address until a connection proves it.
+func (client *ServiceClient) resolveNeighbor(neighbor string) (string, string, error) {
+	if !isNodeID(neighbor) {
+		if peer, exists := client.peers.FindByAddress(neighbor); exists && peer.ID != "" {
+			return peer.ID, neighbor, nil
+		}
+		return "", neighbor, nil
+	}
+
+	peer, exists := client.peers.GetPeer(neighbor)
+	if !exists || peer.Address == "" {
+		return "", "", fmt.Errorf("no known address for node %s", neighbor)
+	}
+	return neighbor, peer.Address, nil
+}
+
+// canonicalNeighbor returns the node ID of a neighbor designated by its address once it is known.
+func (client *ServiceClient) canonicalNeighbor(neighbor string) string {
+	if nodeID, _, err := client.resolveNeighbor(neighbor); err == nil && nodeID != "" {
+		return nodeID
+	}
+	return neighbor
+}
+
+// nodeAddress returns the address a node listens on, for the nodes that contact it directly, or "" if it is not known.
+func (client *ServiceClient) nodeAddress(nodeID string) string {
+	if nodeID == client.nodeID {
+		return client.listeningAddress
+	}
+	_, address, err := client.resolveNeighbor(nodeID)
+	if err != nil {
+		return ""
+	}
+	return address
+}
+
+// routeCandidates returns the neighbors of the peer table, placed at their own location.
+// Neighbors penalized too often are left out.
+func (client *ServiceClient) routeCandidates() []routeCandidate {
+	peers := client.peers.ListPeers()
+
+	candidates := make([]routeCandidate, 0, len(peers))
+	for _, peer := range peers {
+		if peer.Penalty >= maxPeerPenalty {
+			continue
+		}
+		candidates = append(candidates, routeCandidate{NodeID: peer.Key(), Location: peer.Location})
+	}
+	return candidates
+}
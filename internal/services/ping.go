@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// PingResult describes a node that answered a ping.
+type PingResult struct {
+	NodeID   string        // Node ID proven by the node
+	Address  string        // Address the node was reached at
+	Version  int           // Protocol version negotiated with the node
+	Features []string      // Optional features enabled with the node
+	Elapsed  time.Duration // Time taken to connect and complete the handshake
+}
+
+// Ping checks that a node answers by connecting to it and running the handshake, then closes the connection.
+// The node is designated by its address, or by its node ID if the peer table knows its address.
+// Like any neighbor, a node answering is recorded in the peer table.
+func (client *ServiceClient) Ping(ctx context.Context, neighbor string) (PingResult, error) {
+	nodeID, address, err := client.resolveNeighbor(neighbor)
+	if err != nil {
+		return PingResult{}, err
+	}
+
+	start := time.Now()
+	dialer := net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return PingResult{}, fmt.Errorf("failed to connect to %s: %v", address, err)
+	}
+	channel, err := client.secureConnection(conn, address, nodeID)
+	if err != nil {
+		conn.Close()
+		return PingResult{}, fmt.Errorf("failed to secure connection to %s: %v", address, err)
+	}
+	defer channel.close()
+
+	return PingResult{
+		NodeID:   channel.peerID,
+		Address:  address,
+		Version:  channel.version,
+		Features: channel.features,
+		Elapsed:  time.Since(start),
+	}, nil
+}
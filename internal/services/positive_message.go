@@ -1,31 +1,49 @@
 package services
 
 import (
+	"freenet/internal/events"
 	"freenet/internal/logger"
 	"freenet/internal/models"
 )
 
 // handlePositiveMessage processes a PositiveMessage
 func (client *ServiceClient) handlePositiveMessage(msg models.PositiveMessage, senderID string) {
-	// Get the original request from the store using the request ID
-	request, exists := client.requestsStore.GetRequest(msg.RequestID)
-	if !exists {
-		logger.GlobalLogger.Error("Request ID " + msg.RequestID + " not found in the request store.")
+	// Only the neighbor the request is waiting for can fulfill it, late, duplicate and unsolicited replies are ignored
+	if !client.acceptReply(msg.RequestID, senderID) {
 		return
 	}
+	request, fulfilled := client.requestsStore.Complete(msg.RequestID, models.RequestFulfilled)
+	if !fulfilled {
+		return
+	}
+
+	// The request is complete, stop waiting for any neighbor
+	client.stopTimers(msg.RequestID)
+	client.forgetRequest(msg.RequestID)
+	client.publish(events.Event{
+		Type:      events.RequestPositive,
+		RequestID: msg.RequestID,
+		Key:       request.Key,
+		Peer:      senderID,
+		Location:  msg.NodeID,
+		Hops:      msg.Hops,
+	})
 
 	// Forward the PositiveResponse to the node that originally requested the file
 	originalRequesterNodeID := request.NodeID
 	if originalRequesterNodeID != "local" {
+		// Count the hop back to the parent node
+		msg.Hops++
 		success, err := client.sendMessageToNeighbor(request.NodeID, "positive", msg)
 		if success {
 			logger.GlobalLogger.Info("File found for the request  " + msg.RequestID + " of " + request.NodeID + " with key " + request.Key + " by " + msg.NodeID + ", positive message sent to parent node")
 		} else {
-			logger.GlobalLogger.Error("Failed to send positive message to parent node " + senderID + " for request " + msg.RequestID + " with Node ID " + request.NodeID + " and key " + request.Key + ": " + err.Error())
+			logger.GlobalLogger.Error("Failed to send positive message to parent node " + request.NodeID + " for request " + msg.RequestID + " with key " + request.Key + " found by " + msg.NodeID + ": " + err.Error())
 		}
 
 	} else {
 		logger.GlobalLogger.Info("Your request " + msg.RequestID + " for the file with key " + request.Key + " was successfully fulfilled by node " + msg.NodeID)
+		client.completeSearch(msg.RequestID, Result{Key: request.Key, Location: msg.NodeID, Hops: msg.Hops, Status: models.RequestFulfilled}, nil)
 	}
 
 	// Store the new file location in the warehouse
@@ -37,5 +55,12 @@ func (client *ServiceClient) handlePositiveMessage(msg models.PositiveMessage, s
 
 	logger.GlobalLogger.Info("File key " + request.Key + " stored in warehouse with node ID " + msg.NodeID)
 
-	Client.warehouseUpdateHook(Client.warehouse)
+	// The node holding the file becomes a neighbor, reachable at the address it announced
+	if isNodeID(msg.NodeID) {
+		client.addPeer(msg.NodeID, msg.NodeAddress)
+	} else {
+		client.addPeer("", msg.NodeID)
+	}
+
+	client.warehouseChanged(request.Key, msg.NodeID)
 }
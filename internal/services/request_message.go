@@ -1,6 +1,7 @@
 package services
 
 import (
+	"freenet/internal/events"
 	"freenet/internal/logger"
 	"freenet/internal/models"
 )
@@ -8,43 +9,38 @@ import (
 // handleRequestMessage processes a RequestMessage
 func (client *ServiceClient) handleRequestMessage(msg models.RequestMessage, senderID string) {
 	// Check if the request has already been processed
-	_, exists := client.requestsStore.GetRequest(msg.RequestID)
-	if exists {
-		// If the request has already been processed, send a NegativeMessage
-		refusalMessage := models.NegativeMessage{
-			RequestID: msg.RequestID,
-		}
-
-		success, err := client.sendMessageToNeighbor(senderID, "negative", refusalMessage)
-		if success {
-			logger.GlobalLogger.Warn("Request " + msg.RequestID + " has already been processed, negative message sent to parent node " + senderID)
-		} else {
-			logger.GlobalLogger.Error("Failed to send negative message to parent node " + senderID + " for already processed request " + refusalMessage.RequestID + ": " + err.Error())
-		}
+	if client.refuseProcessedRequest(msg.RequestID, senderID) {
 		return
 	}
 
-	// Add the request to the RequestsStore
-	client.requestsStore.AddRequest(msg.RequestID, msg.Key, senderID, []string{senderID}) // visited neighbors: [senderID]
+	// Add the request to the RequestsStore with the HTL left after this hop
+	htl := client.decrementHTL(msg.HTL)
+	client.requestsStore.AddRequest(msg.RequestID, msg.Key, senderID, []string{senderID}, htl) // visited neighbors: [senderID]
+	client.publish(events.Event{Type: events.RequestCreated, RequestID: msg.RequestID, Key: msg.Key, Peer: senderID, HTL: htl})
 
 	// Check if the requested key (file) exists in the Warehouse
 	fileLocation, found := client.warehouse.GetFileLocation(msg.Key)
 	if found {
-		// If the file location is "local", use the client's listening address, otherwise use the fileLocation
-		nodeID := client.listeningAddress
+		// If the file location is "local", use our node ID, otherwise the node ID of the file location
+		nodeID := client.nodeID
 		if fileLocation != "local" {
-			nodeID = fileLocation
+			nodeID = client.canonicalNeighbor(fileLocation)
 		}
 
 		// If the file is found locally, send a PositiveMessage
 		positiveResponse := models.PositiveMessage{
-			RequestID: msg.RequestID,
-			NodeID:    nodeID, // Use the determined node ID (either local address or file location)
+			RequestID:   msg.RequestID,
+			NodeID:      nodeID,                     // Use the determined node ID (either ours or the file location's)
+			NodeAddress: client.nodeAddress(nodeID), // Let the requester contact that node directly
+			Hops:        1,                          // The parent node is one hop away
 		}
 
 		logger.GlobalLogger.Info("File found in our warehouse: Key = " + msg.Key + ", NodeID = " + fileLocation)
+		client.requestsStore.Complete(msg.RequestID, models.RequestFulfilled)
+		client.forgetRequest(msg.RequestID)
+		client.publish(events.Event{Type: events.RequestPositive, RequestID: msg.RequestID, Key: msg.Key, Location: nodeID})
 
-		// Send the refusal message to the parent node (NodeID is the parent node)
+		// Send the positive message to the parent node (senderID is the parent node)
 		success, err := client.sendMessageToNeighbor(senderID, "positive", positiveResponse)
 		if success {
 			logger.GlobalLogger.Info("Positive message sent to parent node " + senderID + " for request " + positiveResponse.RequestID + " with Node ID " + positiveResponse.NodeID)
@@ -55,5 +51,45 @@ func (client *ServiceClient) handleRequestMessage(msg models.RequestMessage, sen
 	}
 	logger.GlobalLogger.Warn("File " + msg.Key + " searched by " + senderID + " not found in our warehouse")
 
+	// Stop here if the request is not allowed to travel any further
+	if htl == 0 {
+		client.requestsStore.Complete(msg.RequestID, models.RequestFailed)
+		client.forgetRequest(msg.RequestID)
+		client.publish(events.Event{Type: events.RequestNegative, RequestID: msg.RequestID, Key: msg.Key, Peer: senderID, Reason: "HTL exhausted"})
+		routeNotFoundMessage := models.RouteNotFoundMessage{
+			RequestID: msg.RequestID,
+		}
+
+		success, err := client.sendMessageToNeighbor(senderID, "route_not_found", routeNotFoundMessage)
+		if success {
+			logger.GlobalLogger.Warn("Request " + msg.RequestID + " has exhausted its HTL, route not found message sent to parent node " + senderID)
+		} else {
+			logger.GlobalLogger.Error("Failed to send route not found message to parent node " + senderID + " for request " + msg.RequestID + ": " + err.Error())
+		}
+		return
+	}
+
 	client.handleRequest(msg.RequestID)
 }
+
+// refuseProcessedRequest sends a NegativeMessage to the sender if the request has already been processed by this node,
+// which means it is looping, and reports whether it did.
+func (client *ServiceClient) refuseProcessedRequest(requestID, senderID string) bool {
+	_, exists := client.requestsStore.GetRequest(requestID)
+	if !exists {
+		return false
+	}
+
+	// If the request has already been processed, send a NegativeMessage
+	refusalMessage := models.NegativeMessage{
+		RequestID: requestID,
+	}
+
+	success, err := client.sendMessageToNeighbor(senderID, "negative", refusalMessage)
+	if success {
+		logger.GlobalLogger.Warn("Request " + requestID + " has already been processed, negative message sent to parent node " + senderID)
+	} else {
+		logger.GlobalLogger.Error("Failed to send negative message to parent node " + senderID + " for already processed request " + refusalMessage.RequestID + ": " + err.Error())
+	}
+	return true
+}
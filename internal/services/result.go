@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"freenet/internal/logger"
+	"freenet/internal/models"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when every reachable neighbor was asked and none had the file.
+	ErrNotFound = errors.New("file not found")
+	// ErrRouteNotFound is returned when the request ran out of hops-to-live before finding the file.
+	ErrRouteNotFound = errors.New("route not found, HTL exhausted")
+	// ErrTimedOut is returned when the search did not complete before its deadline.
+	ErrTimedOut = errors.New("search timed out")
+	// ErrKeyCollision is returned when an insert reaches a node already holding different content under its key.
+	ErrKeyCollision = errors.New("key already holds different content")
+)
+
+// Result is the outcome of a search.
+type Result struct {
+	RequestID string               // Identifier of the request, empty when the file was already in our warehouse
+	Key       string               // Key of the file searched
+	Location  string               // Node holding the file, "local" if this node holds it
+	Hops      int                  // Number of hops between this node and the node that answered
+	Elapsed   time.Duration        // Time taken by the search
+	Status    models.RequestStatus // Final status of the request
+}
+
+// SearchFuture gives access to the result of a search once it has completed.
+type SearchFuture struct {
+	done    chan struct{}
+	started time.Time
+	result  Result
+	err     error
+}
+
+// Done returns a channel closed when the search has completed.
+func (f *SearchFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the search completes or the context is cancelled, and returns its result.
+func (f *SearchFuture) Wait(ctx context.Context) (Result, error) {
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	}
+}
+
+// newSearchFuture creates a future for a search started now.
+func newSearchFuture() *SearchFuture {
+	return &SearchFuture{
+		done:    make(chan struct{}),
+		started: time.Now(),
+	}
+}
+
+// resolve records the result of the search and wakes up the waiters.
+func (f *SearchFuture) resolve(result Result, err error) {
+	result.Elapsed = time.Since(f.started)
+	f.result = result
+	f.err = err
+	close(f.done)
+}
+
+// searchFutures holds the futures of the local searches still in progress, keyed by request ID.
+type searchFutures struct {
+	mu      sync.Mutex
+	futures map[string]*SearchFuture
+}
+
+// newSearchFutures creates an empty set of search futures.
+func newSearchFutures() *searchFutures {
+	return &searchFutures{
+		futures: make(map[string]*SearchFuture),
+	}
+}
+
+// add registers the future of a local request.
+func (s *searchFutures) add(requestID string, future *SearchFuture) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.futures[requestID] = future
+}
+
+// take removes and returns the future of a local request.
+func (s *searchFutures) take(requestID string) (*SearchFuture, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	future, exists := s.futures[requestID]
+	delete(s.futures, requestID)
+	return future, exists
+}
+
+// completeSearch resolves the future of a local request with its outcome.
+func (client *ServiceClient) completeSearch(requestID string, result Result, err error) {
+	future, exists := client.searches.take(requestID)
+	if !exists {
+		return
+	}
+
+	result.RequestID = requestID
+	future.resolve(result, err)
+
+	if err != nil {
+		logger.GlobalLogger.Debug("Search " + requestID + " for file " + result.Key + " completed in " + future.result.Elapsed.String() + ": " + err.Error())
+	} else {
+		logger.GlobalLogger.Debug("Search " + requestID + " for file " + result.Key + " completed in " + future.result.Elapsed.String() + " after " + strconv.Itoa(result.Hops) + " hops")
+	}
+}
@@ -0,0 +1,21 @@
+package services
+
+import (
+	"freenet/internal/models"
+)
+
+// handleRouteNotFoundMessage processes a RouteNotFoundMessage
+func (client *ServiceClient) handleRouteNotFoundMessage(msg models.RouteNotFoundMessage, senderID string) {
+	if !client.acceptReply(msg.RequestID, senderID) {
+		return
+	}
+
+	// Remember that the HTL ran out on this branch so that the failure is reported as such upstream
+	client.requestsStore.UpdateIf(msg.RequestID, func(request *models.Request) bool {
+		request.HTLExhausted = true
+		return true
+	})
+
+	// Try the next neighbor
+	client.handleRequest(msg.RequestID)
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"freenet/internal/logger"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Router defines how the keyspace is laid out and how close two positions of it are.
+// The request path forwards every request to the unvisited neighbor closest to the requested key.
+type Router interface {
+	// Name returns the name used to select the router in the configuration.
+	Name() string
+	// Location maps a key to its position in the keyspace.
+	Location(key string) uint64
+	// Distance returns the distance between two positions in the keyspace.
+	Distance(a, b uint64) uint64
+}
+
+// routers lists the routers that can be selected in the configuration.
+var routers = []Router{asciiSumRouter{}, circularRouter{}, xorRouter{}, randomRouter{}}
+
+// NewRouter returns the router registered under the given name.
+func NewRouter(name string) (Router, error) {
+	names := make([]string, 0, len(routers))
+	for _, router := range routers {
+		if router.Name() == name {
+			return router, nil
+		}
+		names = append(names, router.Name())
+	}
+	return nil, fmt.Errorf("unknown router %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// routeCandidate is a neighbor the request could be forwarded to, with its position in the keyspace.
+type routeCandidate struct {
+	NodeID   string
+	Location uint64
+}
+
+// nextHop returns the candidate closest to the target key, excluding visited neighbors.
+func nextHop(router Router, targetKey string, candidates []routeCandidate, visitedNeighbors []string) (string, error) {
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no neighbors known")
+	}
+
+	// Prepare a set for fast lookup of visited neighbors (nodes)
+	visitedSet := make(map[string]struct{}, len(visitedNeighbors))
+	for _, node := range visitedNeighbors {
+		visitedSet[node] = struct{}{}
+	}
+
+	target := router.Location(targetKey)
+
+	var nearestNeighbor string
+	var nearestDistance uint64
+	for _, candidate := range candidates {
+		if _, visited := visitedSet[candidate.NodeID]; visited {
+			continue // Skip visited nodes
+		}
+
+		distance := router.Distance(target, candidate.Location)
+		if nearestNeighbor == "" || distance < nearestDistance {
+			nearestDistance = distance
+			nearestNeighbor = candidate.NodeID
+			logger.GlobalLogger.Debug("Nearest neighbor updated to: " + nearestNeighbor + " with distance : " + strconv.FormatUint(nearestDistance, 10))
+		}
+	}
+
+	if nearestNeighbor == "" {
+		return "", fmt.Errorf("no more neighbors to contact")
+	}
+
+	return nearestNeighbor, nil
+}
+
+// hashLocation maps a key to a uniformly distributed position using the first 8 bytes of its SHA-256 hash.
+func hashLocation(key string) uint64 {
+	sum := sha256.Sum256([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// asciiSumRouter places keys at the sum of the ASCII values of their characters.
+type asciiSumRouter struct{}
+
+func (asciiSumRouter) Name() string { return "ascii" }
+
+func (asciiSumRouter) Location(key string) uint64 {
+	sum := uint64(0)
+	for _, char := range key {
+		sum += uint64(char)
+	}
+	return sum
+}
+
+func (asciiSumRouter) Distance(a, b uint64) uint64 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// circularRouter places keys on a circle like Freenet, where [0, 1) is scaled to the uint64 range.
+type circularRouter struct{}
+
+func (circularRouter) Name() string { return "circular" }
+
+func (circularRouter) Location(key string) uint64 { return hashLocation(key) }
+
+func (circularRouter) Distance(a, b uint64) uint64 {
+	// Unsigned subtraction wraps around, so the shorter way round the circle is the smaller one
+	return min(a-b, b-a)
+}
+
+// xorRouter uses the Kademlia XOR metric on the hash of the keys.
+type xorRouter struct{}
+
+func (xorRouter) Name() string { return "xor" }
+
+func (xorRouter) Location(key string) uint64 { return hashLocation(key) }
+
+func (xorRouter) Distance(a, b uint64) uint64 { return a ^ b }
+
+// randomRouter ignores the keyspace and picks a random unvisited neighbor.
+type randomRouter struct{}
+
+func (randomRouter) Name() string { return "random" }
+
+func (randomRouter) Location(key string) uint64 { return 0 }
+
+func (randomRouter) Distance(a, b uint64) uint64 { return rand.Uint64() }
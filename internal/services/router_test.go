@@ -0,0 +1,23 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewRouter(t *testing.T) {
+	for _, name := range []string{"ascii", "circular", "xor", "random"} {
+		router, err := NewRouter(name)
+		if err != nil {
+			t.Fatalf("NewRouter(%q): %v", name, err)
+		}
+		if router.Name() != name {
+			t.Fatalf("NewRouter(%q) returned the %q router", name, router.Name())
+		}
+	}
+
+	_, err := NewRouter("nearest")
+	if err == nil || !strings.Contains(err.Error(), "ascii, circular, xor, random") {
+		t.Fatalf("NewRouter of an unknown router returned %v, expected the list of routers", err)
+	}
+}
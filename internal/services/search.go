@@ -2,19 +2,34 @@ package services
 
 import (
 	"context"
+	"freenet/internal/events"
+	"freenet/internal/keys"
 	"freenet/internal/logger"
 	"freenet/internal/models"
 
 	"github.com/google/uuid"
 )
 
-// Search creates a new request message, stores it in the request store, and returns the request ID.
-func (client *ServiceClient) Search(ctx context.Context, key string) {
+// Search looks for a file in the network and blocks until the search is fulfilled, rejected or times out.
+func (client *ServiceClient) Search(ctx context.Context, key string) (Result, error) {
+	return client.SearchAsync(ctx, key).Wait(ctx)
+}
+
+// SearchAsync creates a new request message, stores it in the request store, and returns a future for its result.
+func (client *ServiceClient) SearchAsync(ctx context.Context, key string) *SearchFuture {
+	future := newSearchFuture()
+
+	// The network only knows the routing key of a URI
+	if routingKey, err := keys.RoutingKey(key); err == nil {
+		key = routingKey
+	}
+
 	// Check if the requested key (file) exists in the Warehouse
 	fileLocation, found := client.warehouse.GetFileLocation(key)
 	if found {
 		logger.GlobalLogger.Info("File found in our warehouse: Key = " + key + ", NodeID = " + fileLocation)
-		return
+		future.resolve(Result{Key: key, Location: fileLocation, Hops: 0, Status: models.RequestFulfilled}, nil)
+		return future
 	}
 	logger.GlobalLogger.Warn("File not found in our warehouse: Key = " + key)
 
@@ -22,15 +37,24 @@ func (client *ServiceClient) Search(ctx context.Context, key string) {
 	requestID := uuid.New().String()
 
 	// Step 2: Store the request in the RequestsStore
-	client.requestsStore.AddRequest(requestID, key, "local", []string{})
+	client.searches.add(requestID, future)
+	client.requestsStore.AddRequest(requestID, key, "local", []string{}, client.capHTL(client.defaultHTL))
 
 	// Step 3: Log the new request
 	logger.GlobalLogger.Info("New search request created for file " + key + ": " + requestID)
+	client.publish(events.Event{Type: events.RequestCreated, RequestID: requestID, Key: key, Peer: "local", HTL: client.capHTL(client.defaultHTL)})
+
+	// Step 4: Give up on the request if it does not complete in time
+	client.startDeadline(requestID)
 
 	client.handleRequest(requestID)
+
+	return future
 }
 
 // handleRequest takes a request ID, searches for a neighbor, and forwards the request.
+// It runs when the request is created and whenever the neighbor it waits for answers negatively or times out,
+// the request store making sure only one of them moves the request on.
 func (client *ServiceClient) handleRequest(requestID string) {
 	// Get the request from the RequestsStore
 	request, exists := client.requestsStore.GetRequest(requestID)
@@ -38,16 +62,58 @@ func (client *ServiceClient) handleRequest(requestID string) {
 		logger.GlobalLogger.Error("handleRequest: Request ID " + requestID + " not found in the request store.")
 		return
 	}
+	if request.Status != models.RequestPending || request.PendingNeighbor != "" {
+		logger.GlobalLogger.Debug("handleRequest: Request ID " + requestID + " is already " + string(request.Status))
+		return
+	}
 
 	// Keep searching for neighbors until no more are found or the request is successfully sent
 	for {
 		// Step 1: Find the next neighbor to forward the request to, excluding already visited neighbors
-		neighborID, err := client.warehouse.NearestNeighborByFileID(request.Key, request.VisitedNeighbors)
+		neighborID, err := nextHop(client.router, request.Key, client.routeCandidates(), request.VisitedNeighbors)
 		if err != nil {
+			// An insert that cannot travel any further ends on this node, which has already stored the file
+			if request.Insert {
+				client.finishInsert(requestID)
+				return
+			}
+
+			// The request has failed on this node, stop waiting for it
+			request, failed := client.requestsStore.Complete(requestID, models.RequestFailed)
+			if !failed {
+				return
+			}
+			client.stopTimers(requestID)
+			client.forgetRequest(requestID)
+
+			reason := "no more neighbors to contact"
+			if request.HTLExhausted {
+				reason = "HTL exhausted"
+			}
+			client.publish(events.Event{Type: events.RequestNegative, RequestID: requestID, Key: request.Key, Peer: request.NodeID, Reason: reason})
+
 			// If no more neighbors are available, send a refusal to the parent node
 			if request.NodeID == "local" {
 				// If the request originated locally, just print the message
-				logger.GlobalLogger.Error("Your request " + requestID + " has no more neighbors to contact, file " + request.Key + " not found.")
+				if request.HTLExhausted {
+					logger.GlobalLogger.Error("Your request " + requestID + " has exhausted its HTL, file " + request.Key + " not found.")
+					client.completeSearch(requestID, Result{Key: request.Key, Status: models.RequestFailed}, ErrRouteNotFound)
+				} else {
+					logger.GlobalLogger.Error("Your request " + requestID + " has no more neighbors to contact, file " + request.Key + " not found.")
+					client.completeSearch(requestID, Result{Key: request.Key, Status: models.RequestFailed}, ErrNotFound)
+				}
+			} else if request.HTLExhausted {
+				// Tell the parent node that the HTL ran out rather than that the file does not exist
+				routeNotFoundMessage := models.RouteNotFoundMessage{
+					RequestID: requestID,
+				}
+
+				success, err := client.sendMessageToNeighbor(request.NodeID, "route_not_found", routeNotFoundMessage)
+				if success {
+					logger.GlobalLogger.Info("Route not found message sent to parent node " + request.NodeID + " for request " + requestID)
+				} else {
+					logger.GlobalLogger.Error("Failed to send route not found message to parent node " + request.NodeID + " for request " + requestID + ": " + err.Error())
+				}
 			} else {
 				// Send a refusal (negative message) to the parent node
 				refusalMessage := models.NegativeMessage{
@@ -65,23 +131,76 @@ func (client *ServiceClient) handleRequest(requestID string) {
 			return
 		}
 
-		// Step 2: Create a new RequestMessage to send to the neighbor
-		requestMessage := models.RequestMessage{
+		// Step 2: Create a new RequestMessage, or InsertMessage for an insert, to send to the neighbor
+		messageType := "request"
+		var requestMessage interface{} = models.RequestMessage{
 			RequestID: requestID,
 			Key:       request.Key,
+			HTL:       request.HTL,
+		}
+		if request.Insert {
+			data, err := client.insertData(request)
+			if err != nil {
+				// The nodes already on the path hold the file, the insert ends here
+				logger.GlobalLogger.Error("Cannot forward insert " + requestID + " any further: " + err.Error())
+				client.finishInsert(requestID)
+				return
+			}
+			messageType = "insert"
+			requestMessage = models.InsertMessage{
+				RequestID: requestID,
+				Key:       request.Key,
+				Data:      data,
+				HTL:       request.HTL,
+			}
+		}
+
+		// Step 3: Mark the neighbor as visited and start waiting for it before sending, so that its reply cannot arrive first.
+		// The content of an insert is read back from the datastore if the insert has to be forwarded again.
+		request, exists = client.requestsStore.UpdateIf(requestID, func(request *models.Request) bool {
+			if request.Status != models.RequestPending {
+				return false
+			}
+			request.VisitedNeighbors = append(request.VisitedNeighbors, neighborID)
+			request.PendingNeighbor = neighborID
+			request.Data = nil
+			return true
+		})
+		if !exists {
+			logger.GlobalLogger.Debug("handleRequest: Request ID " + requestID + " completed while being forwarded")
+			return
 		}
+		client.startHopTimer(requestID, neighborID, request.HTL)
 
-		// Step 3: Attempt to forward the request to the neighbor
-		success, err := client.sendMessageToNeighbor(neighborID, "request", requestMessage)
-		// Mark the neighbor as visited
-		request.VisitedNeighbors = append(request.VisitedNeighbors, neighborID)
-		client.requestsStore.UpdateRequest(requestID, request)
-		if success {
-			logger.GlobalLogger.Info("Successfully sent request " + requestID + " to neighbor " + neighborID)
-			break // Exit the loop as the request was successfully sent
-		} else {
+		// Step 4: Attempt to forward the request to the neighbor
+		success, err := client.sendMessageToNeighbor(neighborID, messageType, requestMessage)
+		if !success {
 			logger.GlobalLogger.Error("Failed to send request " + requestID + " to neighbor " + neighborID + ": " + err.Error())
-			// continue to the next neighbor
+			// The hop timer may have moved the request on already
+			if !client.releasePendingNeighbor(requestID, neighborID) {
+				return
+			}
+			client.stopHopTimer(requestID)
+			request, _ = client.requestsStore.GetRequest(requestID)
+			continue // continue to the next neighbor
 		}
+
+		// Mark the neighbor as visited under its node ID as well if connecting just proved it
+		if nodeID := client.canonicalNeighbor(neighborID); nodeID != neighborID {
+			address := neighborID
+			neighborID = nodeID
+			client.requestsStore.UpdateIf(requestID, func(request *models.Request) bool {
+				if request.Status != models.RequestPending || request.PendingNeighbor != address {
+					return false
+				}
+				request.VisitedNeighbors = append(request.VisitedNeighbors, nodeID)
+				request.PendingNeighbor = nodeID
+				return true
+			})
+		}
+		client.publishRequest(events.RequestForwarded, requestID, request, neighborID)
+
+		logger.GlobalLogger.Info("Successfully sent request " + requestID + " to neighbor " + neighborID)
+		return
 	}
 }
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"freenet/internal/models"
+)
+
+func TestSearchAsync(t *testing.T) {
+	origin, holder := startTestNode(t, testConfig(t)), startTestNode(t, testConfig(t))
+	link(origin, holder)
+	if err := holder.warehouse.StoreFile("50", "local"); err != nil {
+		t.Fatal(err)
+	}
+
+	future := origin.SearchAsync(context.Background(), "50")
+	<-future.Done()
+	result, err := future.Wait(context.Background())
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if result.RequestID == "" || result.Location != holder.NodeID() || result.Hops != 1 || result.Elapsed <= 0 ||
+		result.Status != models.RequestFulfilled {
+		t.Fatalf("search returned %+v, expected the file at %s one hop away", result, holder.NodeID())
+	}
+
+	// The location found is recorded, the next search completes without reaching the network
+	result, err = origin.Search(context.Background(), "50")
+	if err != nil || result.RequestID != "" || result.Location != holder.NodeID() || result.Hops != 0 {
+		t.Fatalf("second search returned %+v, %v, expected the location recorded in the warehouse", result, err)
+	}
+}
+
+func TestRepliesOnlyAcceptedFromPendingNeighbor(t *testing.T) {
+	const neighbor, intruder = "127.0.0.1:4001", "127.0.0.1:4002"
+	client := newTestNode(t, testConfig(t))
+
+	// A local search waiting for the neighbor
+	future := newSearchFuture()
+	client.searches.add("request", future)
+	client.requestsStore.AddRequest("request", "50", "local", nil, 10)
+	client.requestsStore.UpdateIf("request", func(request *models.Request) bool {
+		request.VisitedNeighbors = append(request.VisitedNeighbors, neighbor)
+		request.PendingNeighbor = neighbor
+		return true
+	})
+
+	replies := []struct {
+		name  string
+		reply func()
+	}{
+		{"positive", func() {
+			client.handlePositiveMessage(models.PositiveMessage{RequestID: "request", NodeID: intruder, Hops: 1}, intruder)
+		}},
+		{"negative", func() {
+			client.handleNegativeMessage(models.NegativeMessage{RequestID: "request"}, intruder)
+		}},
+		{"route not found", func() {
+			client.handleRouteNotFoundMessage(models.RouteNotFoundMessage{RequestID: "request"}, intruder)
+		}},
+	}
+	for _, reply := range replies {
+		reply.reply()
+		request, _ := client.requestsStore.GetRequest("request")
+		if request.Status != models.RequestPending || request.PendingNeighbor != neighbor || request.HTLExhausted {
+			t.Fatalf("%s reply of another node changed the request to %+v", reply.name, request)
+		}
+	}
+	if _, located := client.warehouse.GetFileLocation("50"); located {
+		t.Fatal("the location given by another node was recorded")
+	}
+
+	client.handlePositiveMessage(models.PositiveMessage{RequestID: "request", NodeID: neighbor, Hops: 1}, neighbor)
+	result, err := future.Wait(context.Background())
+	if err != nil || result.Location != neighbor {
+		t.Fatalf("search returned %+v, %v, expected the file at %s", result, err, neighbor)
+	}
+
+	// A duplicate of the reply does not complete the search twice
+	client.handlePositiveMessage(models.PositiveMessage{RequestID: "request", NodeID: intruder, Hops: 1}, neighbor)
+	if location, _ := client.warehouse.GetFileLocation("50"); location != neighbor {
+		t.Fatalf("file located at %s after a duplicate reply, expected %s", location, neighbor)
+	}
+}
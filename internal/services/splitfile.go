@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"freenet/internal/keys"
+	"freenet/internal/logger"
+	"freenet/internal/splitfile"
+	"strconv"
+)
+
+// splitContent inserts the blocks of content larger than a block and returns the manifest to insert in its place.
+// Check blocks are inserted along with the data blocks of every segment according to the redundancy ratio.
+// A manifest that is itself larger than a block is split again, until the top-level manifest fits in one block.
+func (client *ServiceClient) splitContent(ctx context.Context, data []byte) ([]byte, error) {
+	for len(data) > client.blockSize {
+		blocks := splitfile.Split(data, client.blockSize)
+		manifest := splitfile.Manifest{
+			Size:       len(data),
+			BlockSize:  client.blockSize,
+			Blocks:     make([]string, len(blocks)),
+			Redundancy: client.redundancy,
+		}
+		logger.GlobalLogger.Info("Splitting " + strconv.Itoa(len(data)) + " bytes into " + strconv.Itoa(len(blocks)) + " blocks")
+
+		for i, block := range blocks {
+			key, err := client.insertBlock(ctx, block)
+			if err != nil {
+				return nil, fmt.Errorf("failed to insert block %d of %d: %w", i+1, len(blocks), err)
+			}
+			manifest.Blocks[i] = key
+		}
+
+		if client.redundancy > 0 {
+			for segment := 0; segment < splitfile.Segments(len(blocks)); segment++ {
+				start, end := splitfile.SegmentBounds(segment, len(blocks))
+				checkBlocks, err := splitfile.EncodeSegment(blocks[start:end], client.blockSize, client.redundancy)
+				if err != nil {
+					return nil, fmt.Errorf("failed to encode segment %d: %v", segment+1, err)
+				}
+
+				checkKeys := make([]string, len(checkBlocks))
+				for i, block := range checkBlocks {
+					key, err := client.insertBlock(ctx, block)
+					if err != nil {
+						return nil, fmt.Errorf("failed to insert check block %d of segment %d: %w", i+1, segment+1, err)
+					}
+					checkKeys[i] = key
+				}
+				manifest.CheckBlocks = append(manifest.CheckBlocks, checkKeys)
+			}
+		}
+
+		var err error
+		data, err = manifest.Encode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode splitfile manifest: %v", err)
+		}
+	}
+	return data, nil
+}
+
+// insertBlock encrypts a block, inserts it under its content hash key and returns its URI.
+func (client *ServiceClient) insertBlock(ctx context.Context, block []byte) (string, error) {
+	uri, encrypted := keys.EncryptCHK(block)
+	routingKey, _ := keys.RoutingKey(uri)
+	if _, err := client.insert(ctx, routingKey, encrypted); err != nil {
+		return "", err
+	}
+	return uri, nil
+}
+
+// fetchSplitfile fetches the blocks listed in a manifest and reassembles the file, verifying every block.
+// The data blocks of a segment that cannot be fetched are rebuilt from its check blocks.
+// The time spent fetching the blocks is added to the result of the fetch of the manifest.
+func (client *ServiceClient) fetchSplitfile(ctx context.Context, data []byte, result *Result) ([]byte, error) {
+	for splitfile.IsManifest(data) {
+		// The manifest may come from a node splitting files into larger blocks, which is fine as long as they can reach us
+		manifest, err := splitfile.Decode(data, maxBlockSize(client.maxFrameSize))
+		if err != nil {
+			return nil, err
+		}
+		logger.GlobalLogger.Info("Fetching " + strconv.Itoa(len(manifest.Blocks)) + " blocks of a splitfile of " + strconv.Itoa(manifest.Size) + " bytes")
+
+		blocks := make([][]byte, len(manifest.Blocks))
+		for segment := 0; segment < splitfile.Segments(len(blocks)); segment++ {
+			start, end := splitfile.SegmentBounds(segment, len(blocks))
+			if err := client.fetchSegment(ctx, manifest, segment, blocks[start:end], result); err != nil {
+				return nil, err
+			}
+		}
+
+		data, err = manifest.Join(blocks)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// fetchSegment fetches the data blocks of a segment, then as many check blocks as there are missing data blocks
+// and rebuilds them.
+func (client *ServiceClient) fetchSegment(ctx context.Context, manifest *splitfile.Manifest, segment int, blocks [][]byte, result *Result) error {
+	start, _ := splitfile.SegmentBounds(segment, len(manifest.Blocks))
+
+	missing := 0
+	var fetchErr error
+	for i := range blocks {
+		block, err := client.fetchBlock(ctx, manifest.Blocks[start+i], result)
+		if err != nil {
+			if manifest.Redundancy == 0 {
+				return fmt.Errorf("failed to fetch block %d of %d: %w", start+i+1, len(manifest.Blocks), err)
+			}
+			logger.GlobalLogger.Warn("Failed to fetch block " + strconv.Itoa(start+i+1) + " of " + strconv.Itoa(len(manifest.Blocks)) + ", it will be rebuilt: " + err.Error())
+			fetchErr = err
+			missing++
+			continue
+		}
+		blocks[i] = block
+	}
+	if missing == 0 {
+		return nil
+	}
+
+	// Any check block can stand in for any missing data block
+	checkKeys := manifest.CheckBlocks[segment]
+	checkBlocks := make([][]byte, len(checkKeys))
+	found := 0
+	for i := 0; i < len(checkKeys) && found < missing; i++ {
+		block, err := client.fetchBlock(ctx, checkKeys[i], result)
+		if err != nil {
+			logger.GlobalLogger.Warn("Failed to fetch check block " + strconv.Itoa(i+1) + " of segment " + strconv.Itoa(segment+1) + ": " + err.Error())
+			continue
+		}
+		checkBlocks[i] = block
+		found++
+	}
+	if found < missing {
+		return fmt.Errorf("failed to fetch segment %d: %d blocks missing and only %d check blocks available: %w", segment+1, missing, found, fetchErr)
+	}
+
+	if err := manifest.Recover(segment, blocks, checkBlocks); err != nil {
+		return fmt.Errorf("failed to rebuild segment %d: %v", segment+1, err)
+	}
+	logger.GlobalLogger.Info("Rebuilt " + strconv.Itoa(missing) + " blocks of segment " + strconv.Itoa(segment+1) + " from its check blocks")
+	return nil
+}
+
+// fetchBlock fetches and decrypts a block of a splitfile. Blocks are content hash keys, any block that does not
+// match its key is rejected.
+func (client *ServiceClient) fetchBlock(ctx context.Context, key string, result *Result) ([]byte, error) {
+	block, blockResult, err := client.fetchContent(ctx, key)
+	result.Elapsed += blockResult.Elapsed
+	return block, err
+}
+
+// blockFieldsSize bounds the size of the fields around the data of a block in the frame carrying it.
+const blockFieldsSize = 4096
+
+// encodedBlockSize bounds the size of the frame carrying a block: a signed block is base64 encoded twice,
+// once in the signed block and once in the insert message, plus the fields around the data.
+func encodedBlockSize(blockSize int) int {
+	return blockSize*16/9 + blockFieldsSize
+}
+
+// maxBlockSize returns the size of the largest block that fits in a frame once encoded, the largest block a node
+// can receive whatever the block size of the node that split the file.
+func maxBlockSize(maxFrameSize int) int {
+	return (maxFrameSize - blockFieldsSize) * 9 / 16
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"testing"
+)
+
+func TestMaxBlockSize(t *testing.T) {
+	for _, maxFrameSize := range []int{8 << 10, 64 << 10, 1 << 20, 16 << 20} {
+		blockSize := maxBlockSize(maxFrameSize)
+		// Rounding may leave a byte unused
+		if encodedBlockSize(blockSize) > maxFrameSize || encodedBlockSize(blockSize+2) <= maxFrameSize {
+			t.Errorf("maxBlockSize(%d) = %d is not the largest block fitting in the frame", maxFrameSize, blockSize)
+		}
+	}
+}
+
+func TestFetchSplitfileOfLargerBlocks(t *testing.T) {
+	config := testConfig(t)
+	config.BlockSize = 4096
+	config.Redundancy = 0
+	inserter := startTestNode(t, config)
+
+	config = testConfig(t)
+	config.BlockSize = 1024
+	fetcher := startTestNode(t, config)
+	link(fetcher, inserter)
+
+	data := make([]byte, 5*4096+100)
+	rand.New(rand.NewSource(1)).Read(data)
+	result, err := inserter.Insert(context.Background(), "", data)
+	if err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+
+	fetched, _, err := fetcher.Fetch(context.Background(), result.Key)
+	if err != nil {
+		t.Fatalf("Fetch of blocks larger than the block size of the fetching node: %v", err)
+	}
+	if !bytes.Equal(fetched, data) {
+		t.Fatal("fetched file differs from the inserted one")
+	}
+}
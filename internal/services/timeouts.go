@@ -0,0 +1,113 @@
+package services
+
+import (
+	"freenet/internal/events"
+	"freenet/internal/logger"
+	"freenet/internal/models"
+	"sync"
+	"time"
+)
+
+// requestTimers holds the running timers of the requests handled by this node.
+type requestTimers struct {
+	mu        sync.Mutex
+	hops      map[string]*time.Timer // Per-hop timers, keyed by request ID
+	deadlines map[string]*time.Timer // Overall deadlines of local requests, keyed by request ID
+}
+
+// newRequestTimers creates an empty set of request timers.
+func newRequestTimers() *requestTimers {
+	return &requestTimers{
+		hops:      make(map[string]*time.Timer),
+		deadlines: make(map[string]*time.Timer),
+	}
+}
+
+// startHopTimer waits for the neighbor to answer the request forwarded with htl hops left,
+// and moves on to the next neighbor if it does not.
+func (client *ServiceClient) startHopTimer(requestID, neighborID string, htl int) {
+	client.timers.mu.Lock()
+	defer client.timers.mu.Unlock()
+
+	if timer, exists := client.timers.hops[requestID]; exists {
+		timer.Stop()
+	}
+	client.timers.hops[requestID] = time.AfterFunc(client.hopTimeoutFor(htl), func() {
+		client.handleHopTimeout(requestID, neighborID)
+	})
+}
+
+// hopTimeoutFor returns the time given to a neighbor to answer a request forwarded with htl hops left.
+// The neighbor may forward the request in turn and backtrack on its own timeouts, which are shorter as its HTL
+// is lower, so every node waits longer than the nodes downstream. The hop timeout is the time given at the maximum HTL.
+func (client *ServiceClient) hopTimeoutFor(htl int) time.Duration {
+	htl = min(max(htl, 0), client.maxHTL)
+	return client.hopTimeout * time.Duration(htl+1) / time.Duration(client.maxHTL+1)
+}
+
+// forgetRequest removes a completed request from the RequestsStore once the search timeout has passed.
+// Until then, a copy of the request looping back is still refused and late replies are still recognised.
+func (client *ServiceClient) forgetRequest(requestID string) {
+	time.AfterFunc(client.searchTimeout, func() {
+		client.requestsStore.RemoveRequest(requestID)
+	})
+}
+
+// stopHopTimer stops waiting for the current neighbor of the request.
+func (client *ServiceClient) stopHopTimer(requestID string) {
+	client.timers.mu.Lock()
+	defer client.timers.mu.Unlock()
+
+	if timer, exists := client.timers.hops[requestID]; exists {
+		timer.Stop()
+		delete(client.timers.hops, requestID)
+	}
+}
+
+// startDeadline gives a local request a limited amount of time to complete.
+func (client *ServiceClient) startDeadline(requestID string) {
+	client.timers.mu.Lock()
+	defer client.timers.mu.Unlock()
+
+	client.timers.deadlines[requestID] = time.AfterFunc(client.searchTimeout, func() {
+		client.handleDeadline(requestID)
+	})
+}
+
+// stopTimers stops every timer of the request once it has completed.
+func (client *ServiceClient) stopTimers(requestID string) {
+	client.stopHopTimer(requestID)
+
+	client.timers.mu.Lock()
+	defer client.timers.mu.Unlock()
+
+	if timer, exists := client.timers.deadlines[requestID]; exists {
+		timer.Stop()
+		delete(client.timers.deadlines, requestID)
+	}
+}
+
+// handleHopTimeout marks the neighbor as failed for the request and backtracks to the next neighbor.
+func (client *ServiceClient) handleHopTimeout(requestID, neighborID string) {
+	// Ignore the timer if the neighbor answered or the request completed in the meantime
+	if !client.releasePendingNeighbor(requestID, neighborID) {
+		return
+	}
+
+	logger.GlobalLogger.Warn("Neighbor " + neighborID + " did not answer request " + requestID + " in time, trying the next neighbor")
+	client.handleRequest(requestID)
+}
+
+// handleDeadline ends a local request that did not complete in time.
+func (client *ServiceClient) handleDeadline(requestID string) {
+	request, timedOut := client.requestsStore.Complete(requestID, models.RequestTimedOut)
+	if !timedOut {
+		return
+	}
+	client.stopTimers(requestID)
+	client.forgetRequest(requestID)
+
+	logger.GlobalLogger.Error("Your request " + requestID + " for the file with key " + request.Key + " timed out after " + client.searchTimeout.String())
+	client.publishRequest(events.RequestTimedOut, requestID, request, "")
+	client.completeSearch(requestID, Result{Key: request.Key, Status: models.RequestTimedOut}, ErrTimedOut)
+}
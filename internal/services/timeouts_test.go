@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"freenet/internal/models"
+)
+
+// silence makes the node accept requests without ever answering them, and reports the requests it receives.
+func silence(node *ServiceClient) <-chan string {
+	received := make(chan string, 16)
+	node.Handlers().Register("request", func(peerID string, msg models.Message) error {
+		received <- requestIDOf(msg)
+		return nil
+	})
+	return received
+}
+
+// keyRoutedTo returns a key the node forwards to the neighbor before any other one.
+func keyRoutedTo(t *testing.T, node *ServiceClient, neighbor string) string {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		if next, err := nextHop(node.router, key, node.routeCandidates(), nil); err == nil && next == neighbor {
+			return key
+		}
+	}
+	t.Fatalf("no key is routed to %s first", neighbor)
+	return ""
+}
+
+func TestHopTimeoutFor(t *testing.T) {
+	client := &ServiceClient{hopTimeout: 19 * time.Second, maxHTL: 18}
+	tests := []struct {
+		htl      int
+		expected time.Duration
+	}{
+		{18, 19 * time.Second},
+		{9, 10 * time.Second},
+		{0, time.Second},
+		{-1, time.Second},
+		{30, 19 * time.Second},
+	}
+	for _, test := range tests {
+		if timeout := client.hopTimeoutFor(test.htl); timeout != test.expected {
+			t.Errorf("hopTimeoutFor(%d) = %s, expected %s", test.htl, timeout, test.expected)
+		}
+	}
+}
+
+func TestSearchMovesOnFromSilentNeighbor(t *testing.T) {
+	config := testConfig(t)
+	config.HopTimeout = 200 * time.Millisecond
+	origin, silent, holder := startTestNode(t, config), startTestNode(t, testConfig(t)), startTestNode(t, testConfig(t))
+	received := silence(silent)
+	link(origin, silent)
+	link(origin, holder)
+
+	key := keyRoutedTo(t, origin, silent.Address())
+	if err := holder.warehouse.StoreFile(key, "local"); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := origin.Search(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if result.Location != holder.NodeID() {
+		t.Fatalf("Search found the file at %s, expected %s", result.Location, holder.NodeID())
+	}
+	select {
+	case <-received:
+	default:
+		t.Fatal("the request was not forwarded to the silent neighbor first")
+	}
+}
+
+func TestSearchTimesOut(t *testing.T) {
+	config := testConfig(t)
+	config.SearchTimeout = 200 * time.Millisecond
+	origin, silent := startTestNode(t, config), startTestNode(t, testConfig(t))
+	received := silence(silent)
+	link(origin, silent)
+
+	result, err := origin.Search(context.Background(), "50")
+	if !errors.Is(err, ErrTimedOut) || result.Status != models.RequestTimedOut {
+		t.Fatalf("Search returned %+v, %v, expected ErrTimedOut", result, err)
+	}
+	if result.Elapsed < config.SearchTimeout || result.Elapsed > config.HopTimeout {
+		t.Fatalf("Search timed out after %s, expected %s", result.Elapsed, config.SearchTimeout)
+	}
+
+	// The reply of the neighbor arriving after the deadline does not revive the request
+	origin.handleNegativeMessage(models.NegativeMessage{RequestID: <-received}, silent.NodeID())
+	if request, _ := origin.requestsStore.GetRequest(result.RequestID); request.Status != models.RequestTimedOut {
+		t.Fatalf("request is %s after the late reply, expected %s", request.Status, models.RequestTimedOut)
+	}
+}
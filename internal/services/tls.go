@@ -0,0 +1,201 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"freenet/internal/logger"
+	"math/big"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// certificateValidity is the validity period of the self-signed certificate generated for a node.
+const certificateValidity = 10 * 365 * 24 * time.Hour
+
+// ErrUnknownFingerprint is returned in darknet mode for a node whose certificate is not pinned in the peer table.
+var ErrUnknownFingerprint = errors.New("certificate fingerprint is not pinned")
+
+// ErrFingerprintMismatch is returned when the certificate of a neighbor differs from the one pinned for it.
+var ErrFingerprintMismatch = errors.New("certificate fingerprint does not match the pinned one")
+
+// LoadOrCreateCertificate loads the TLS certificate of the node, generating a self-signed one on first use.
+// The certificate and its private key are stored together in a single PEM file.
+func LoadOrCreateCertificate(path string) (tls.Certificate, error) {
+	if data, err := os.ReadFile(path); err == nil {
+		cert, err := tls.X509KeyPair(data, data)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("invalid certificate %s: %v", path, err)
+		}
+		return cert, nil
+	} else if !os.IsNotExist(err) {
+		return tls.Certificate{}, err
+	}
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "freenet node"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(certificateValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, privateKey.Public(), privateKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})...)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return tls.Certificate{}, err
+	}
+	logger.GlobalLogger.Info("Generated a new TLS certificate in " + path)
+	return tls.X509KeyPair(data, data)
+}
+
+// Fingerprint returns the fingerprint of a certificate, the base64url SHA-256 hash of its DER encoding.
+func Fingerprint(cert tls.Certificate) string {
+	return fingerprintOf(cert.Certificate[0])
+}
+
+// fingerprintOf returns the fingerprint of a DER encoded certificate.
+func fingerprintOf(der []byte) string {
+	hash := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// newTLSConfig creates the TLS configuration shared by the dialed and accepted connections.
+// Certificates are self-signed, so they are not verified against authorities but pinned by fingerprint instead.
+func newTLSConfig(cert tls.Certificate) *tls.Config {
+	return &tls.Config{
+		Certificates:       []tls.Certificate{cert},
+		ClientAuth:         tls.RequireAnyClientCert,
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS13,
+	}
+}
+
+// secureConnection runs the handshake of a new connection, TLS when enabled and the link key exchange otherwise,
+// then the hello handshake negotiating the protocol and proving the node ID of both ends.
+// address is the address the connection was dialed to and expectedID the node ID expected there, if known.
+// Both are empty for accepted connections.
+func (client *ServiceClient) secureConnection(conn net.Conn, address, expectedID string) (*secureChannel, error) {
+	initiator := address != ""
+
+	var channel *secureChannel
+	var err error
+	if client.tlsConfig == nil {
+		channel, err = newSecureChannel(conn, initiator, client.maxFrameSize)
+	} else {
+		channel, err = client.tlsHandshake(conn, initiator)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.handshake(channel, initiator); err != nil {
+		return nil, err
+	}
+	if expectedID != "" && channel.peerID != expectedID {
+		return nil, fmt.Errorf("%w: node at %s is %s, expected %s", ErrIdentity, address, channel.peerID, expectedID)
+	}
+	if channel.fingerprint != "" {
+		if err := client.checkFingerprint(channel.peerID, channel.fingerprint); err != nil {
+			return nil, err
+		}
+	}
+
+	// A dialed node is known to listen on the address it was reached at. The address announced by a node
+	// connecting to us is only kept if it is on the host the connection comes from.
+	if initiator {
+		channel.peerAddress = address
+	} else if !sameHost(channel.peerAddress, channel.remoteAddr()) {
+		logger.GlobalLogger.Warn("Node " + channel.peerID + " connecting from " + channel.remoteAddr() + " announced the address " + channel.peerAddress + " of another host, ignoring it")
+		channel.peerAddress = ""
+	}
+	client.identifyPeer(channel.peerID, channel.peerAddress, initiator)
+	logger.GlobalLogger.Debug("Connected to " + channel.peerID + " at " + channel.remoteAddr() + " with protocol version " + strconv.Itoa(channel.version) + ", features: " + describeFeatures(channel.features))
+	return channel, nil
+}
+
+// sameHost tells whether two addresses are on the same host, whatever their ports.
+func sameHost(address, other string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	otherHost, _, err := net.SplitHostPort(other)
+	if err != nil {
+		return false
+	}
+	hostIP, otherIP := net.ParseIP(host), net.ParseIP(otherHost)
+	if hostIP != nil && otherIP != nil {
+		return hostIP.Equal(otherIP)
+	}
+	return host == otherHost
+}
+
+// tlsHandshake runs the TLS handshake of a new connection.
+func (client *ServiceClient) tlsHandshake(conn net.Conn, initiator bool) (*secureChannel, error) {
+	var tlsConn *tls.Conn
+	if initiator {
+		tlsConn = tls.Client(conn, client.tlsConfig)
+	} else {
+		tlsConn = tls.Server(conn, client.tlsConfig)
+	}
+	conn.SetDeadline(time.Now().Add(linkHandshakeTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLinkHandshake, err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	fingerprint := fingerprintOf(tlsConn.ConnectionState().PeerCertificates[0].Raw)
+	return newTLSChannel(tlsConn, fingerprint, client.maxFrameSize)
+}
+
+// checkFingerprint checks the certificate presented by a neighbor against the one pinned for its node ID.
+// The first certificate seen for a neighbor is pinned, unless in darknet mode where it must have been pinned beforehand.
+func (client *ServiceClient) checkFingerprint(neighborID, fingerprint string) error {
+	if peer, exists := client.peers.GetPeer(neighborID); exists && peer.Fingerprint != "" {
+		if peer.Fingerprint != fingerprint {
+			return fmt.Errorf("%w: %s presented %s, expected %s", ErrFingerprintMismatch, neighborID, fingerprint, peer.Fingerprint)
+		}
+		return nil
+	}
+	if client.darknet {
+		return fmt.Errorf("%w: %s presented %s", ErrUnknownFingerprint, neighborID, fingerprint)
+	}
+
+	pinned, err := client.peers.PinFingerprint(neighborID, fingerprint)
+	if err != nil {
+		// A certificate that is not pinned could be replaced unnoticed after a restart, the neighbor is refused
+		return fmt.Errorf("failed to pin the certificate of %s: %v", neighborID, err)
+	}
+	if pinned != fingerprint {
+		return fmt.Errorf("%w: %s presented %s, expected %s", ErrFingerprintMismatch, neighborID, fingerprint, pinned)
+	}
+	logger.GlobalLogger.Info("Pinned certificate " + fingerprint + " of neighbor " + neighborID)
+	return nil
+}
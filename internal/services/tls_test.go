@@ -0,0 +1,133 @@
+package services
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+)
+
+// securePair connects the dialer to the listener over a loopback connection and returns the errors of both ends
+// securing it.
+func securePair(t *testing.T, dialer, listener *ServiceClient) (error, error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			accepted <- err
+			return
+		}
+		channel, err := listener.secureConnection(conn, "", "")
+		if err != nil {
+			conn.Close()
+		} else {
+			t.Cleanup(func() { channel.close() })
+		}
+		accepted <- err
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	channel, dialErr := dialer.secureConnection(conn, ln.Addr().String(), "")
+	if dialErr != nil {
+		conn.Close()
+	} else {
+		t.Cleanup(func() { channel.close() })
+	}
+	return dialErr, <-accepted
+}
+
+// newTLSNode creates a node connecting to its neighbors over TLS, in darknet mode if asked.
+func newTLSNode(t *testing.T, darknet bool) *ServiceClient {
+	t.Helper()
+	config := testConfig(t)
+	config.TLS = true
+	config.Darknet = darknet
+	return newTestNode(t, config)
+}
+
+// fingerprintOfNode returns the fingerprint of the certificate of a TLS node.
+func fingerprintOfNode(node *ServiceClient) string {
+	return Fingerprint(node.tlsConfig.Certificates[0])
+}
+
+func TestTLSPinsFirstCertificate(t *testing.T) {
+	dialer, listener := newTLSNode(t, false), newTLSNode(t, false)
+	if dialErr, acceptErr := securePair(t, dialer, listener); dialErr != nil || acceptErr != nil {
+		t.Fatalf("connection refused: dialer %v, listener %v", dialErr, acceptErr)
+	}
+
+	// Each end pinned the certificate of the other one under its node ID
+	for _, ends := range [][2]*ServiceClient{{dialer, listener}, {listener, dialer}} {
+		peer, _ := ends[0].peers.GetPeer(ends[1].NodeID())
+		if peer.Fingerprint != fingerprintOfNode(ends[1]) {
+			t.Fatalf("pinned fingerprint %q, expected %q", peer.Fingerprint, fingerprintOfNode(ends[1]))
+		}
+	}
+
+	// The same certificate is accepted again
+	if dialErr, acceptErr := securePair(t, dialer, listener); dialErr != nil || acceptErr != nil {
+		t.Fatalf("second connection refused: dialer %v, listener %v", dialErr, acceptErr)
+	}
+}
+
+func TestTLSRefusesOtherCertificate(t *testing.T) {
+	dialer, listener := newTLSNode(t, false), newTLSNode(t, false)
+	if _, err := dialer.peers.PinFingerprint(listener.NodeID(), fingerprintOfNode(newTLSNode(t, false))); err != nil {
+		t.Fatal(err)
+	}
+
+	if dialErr, _ := securePair(t, dialer, listener); !errors.Is(dialErr, ErrFingerprintMismatch) {
+		t.Fatalf("dialer returned %v, expected ErrFingerprintMismatch", dialErr)
+	}
+}
+
+func TestDarknetRefusesUnpinnedNodes(t *testing.T) {
+	stranger, darknet := newTLSNode(t, false), newTLSNode(t, true)
+
+	if _, acceptErr := securePair(t, stranger, darknet); !errors.Is(acceptErr, ErrUnknownFingerprint) {
+		t.Fatalf("darknet node accepting a connection returned %v, expected ErrUnknownFingerprint", acceptErr)
+	}
+	if dialErr, _ := securePair(t, darknet, stranger); !errors.Is(dialErr, ErrUnknownFingerprint) {
+		t.Fatalf("darknet node dialing returned %v, expected ErrUnknownFingerprint", dialErr)
+	}
+	if _, known := darknet.peers.GetPeer(stranger.NodeID()); known {
+		t.Fatal("the refused node was added to the peer table")
+	}
+
+	// Once pinned beforehand, the node is accepted
+	if _, err := darknet.peers.PinFingerprint(stranger.NodeID(), fingerprintOfNode(stranger)); err != nil {
+		t.Fatal(err)
+	}
+	if dialErr, acceptErr := securePair(t, stranger, darknet); dialErr != nil || acceptErr != nil {
+		t.Fatalf("pinned node refused: dialer %v, listener %v", dialErr, acceptErr)
+	}
+}
+
+func TestTLSRefusesCertificateThatCannotBePinned(t *testing.T) {
+	config := testConfig(t)
+	config.TLS = true
+	dialer, listener := newTestNode(t, config), newTLSNode(t, false)
+
+	// The peer table can no longer be saved
+	path := config.PeersPath()
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if dialErr, _ := securePair(t, dialer, listener); dialErr == nil {
+		t.Fatal("connection accepted although the certificate could not be pinned")
+	}
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"freenet/internal/keys"
+	"freenet/internal/logger"
+	"freenet/internal/models"
+	"strconv"
+	"time"
+)
+
+// InsertEdition signs an edition of a document with the key pair and inserts it under its updatable subspace key.
+// The edition is stored under the signed subspace key of the edition, the USK is returned in the result.
+func (client *ServiceClient) InsertEdition(ctx context.Context, keyPair *keys.KeyPair, docName string, edition int64, data []byte) (Result, error) {
+	data, err := client.splitContent(ctx, data)
+	if err != nil {
+		return Result{Status: models.RequestFailed}, err
+	}
+	usk, routingKey, block, err := keyPair.SignEdition(docName, edition, data)
+	if err != nil {
+		return Result{Status: models.RequestFailed}, err
+	}
+
+	result, err := client.insert(ctx, routingKey, block)
+	result.Key = usk
+	if err != nil {
+		return result, err
+	}
+
+	client.editionSeen(usk, edition)
+	return result, nil
+}
+
+// LatestEdition looks for the latest edition of an updatable subspace key, starting from the edition of the key
+// or from the highest edition this node has seen if it is newer, and returns the USK of that edition.
+func (client *ServiceClient) LatestEdition(ctx context.Context, key string) (string, Result, error) {
+	_, _, edition, err := keys.ParseUSK(key)
+	if err != nil {
+		return "", Result{Key: key, Status: models.RequestFailed}, err
+	}
+	base, _ := keys.USKBase(key)
+
+	// Start from the highest edition we know of, and fall back on the requested one if it cannot be found
+	start := edition
+	if known, exists := client.warehouse.GetEdition(base); exists && known > start {
+		start = known
+	}
+	result, err := client.searchEdition(ctx, key, start)
+	if err != nil && start != edition {
+		logger.GlobalLogger.Warn("Edition " + strconv.FormatInt(start, 10) + " of " + base + " not found, trying edition " + strconv.FormatInt(edition, 10))
+		start = edition
+		result, err = client.searchEdition(ctx, key, start)
+	}
+	if err != nil {
+		result.Key = key
+		return "", result, err
+	}
+
+	latest, latestResult := client.probeEditions(ctx, key, start)
+	if latest == start {
+		latestResult = result
+	}
+
+	latestKey, _ := keys.WithEdition(key, latest)
+	client.editionSeen(latestKey, latest)
+	latestResult.Key = latestKey
+	return latestKey, latestResult, nil
+}
+
+// Subscribe polls the network for new editions of an updatable subspace key until the context is cancelled.
+// onEdition is called with the USK of every edition newer than the latest one known when it appears.
+func (client *ServiceClient) Subscribe(ctx context.Context, key string, onEdition func(key string, edition int64)) error {
+	_, _, current, err := keys.ParseUSK(key)
+	if err != nil {
+		return err
+	}
+	base, _ := keys.USKBase(key)
+
+	// Only editions newer than the latest one known when subscribing are notified
+	if known, exists := client.warehouse.GetEdition(base); exists && known > current {
+		current = known
+	}
+
+	go func() {
+		ticker := time.NewTicker(client.subscribeInterval)
+		defer ticker.Stop()
+
+		logger.GlobalLogger.Info("Subscribed to " + base + " from edition " + strconv.FormatInt(current, 10) + ", polling every " + client.subscribeInterval.String())
+		for {
+			latest, _ := client.probeEditions(ctx, key, current)
+			if latest > current {
+				current = latest
+				latestKey, _ := keys.WithEdition(key, latest)
+				client.editionSeen(latestKey, latest)
+				logger.GlobalLogger.Info("New edition " + strconv.FormatInt(latest, 10) + " of " + base + " found")
+				onEdition(latestKey, latest)
+			}
+
+			select {
+			case <-ctx.Done():
+				logger.GlobalLogger.Info("Subscription to " + base + " stopped")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// fetchUSK fetches the latest edition of an updatable subspace key.
+func (client *ServiceClient) fetchUSK(ctx context.Context, key string) ([]byte, Result, error) {
+	latestKey, result, err := client.LatestEdition(ctx, key)
+	if err != nil {
+		return nil, result, err
+	}
+	_, _, edition, _ := keys.ParseUSK(latestKey)
+	ssk, _ := keys.EditionSSK(latestKey, edition)
+
+	content, fetchResult, err := client.fetchContent(ctx, ssk)
+	fetchResult.Key = latestKey
+	return content, fetchResult, err
+}
+
+// probeEditions searches for the editions following an edition known to exist, one after the other,
+// and returns the last one found with the result of its search.
+func (client *ServiceClient) probeEditions(ctx context.Context, key string, edition int64) (int64, Result) {
+	var latestResult Result
+	for {
+		result, err := client.searchEdition(ctx, key, edition+1)
+		if err != nil {
+			logger.GlobalLogger.Debug("Edition " + strconv.FormatInt(edition+1, 10) + " of " + key + " not found: " + err.Error())
+			return edition, latestResult
+		}
+		edition++
+		latestResult = result
+	}
+}
+
+// searchEdition fetches the signed block of an edition of an updatable subspace key and verifies it, so that a node
+// merely answering the search positively cannot make an edition look published.
+func (client *ServiceClient) searchEdition(ctx context.Context, key string, edition int64) (Result, error) {
+	ssk, err := keys.EditionSSK(key, edition)
+	if err != nil {
+		return Result{Key: key, Status: models.RequestFailed}, err
+	}
+	routingKey, err := keys.RoutingKey(ssk)
+	if err != nil {
+		return Result{Key: key, Status: models.RequestFailed}, err
+	}
+	_, result, err := client.fetchStored(ctx, routingKey)
+	return result, err
+}
+
+// editionSeen records an edition of an updatable subspace key if it is the highest edition seen so far.
+// The edition must have been inserted by this node or its block verified by searchEdition.
+func (client *ServiceClient) editionSeen(key string, edition int64) {
+	base, err := keys.USKBase(key)
+	if err != nil {
+		return
+	}
+
+	if _, err := client.warehouse.StoreEdition(base, edition); err != nil {
+		logger.GlobalLogger.Error("Failed to store edition " + strconv.FormatInt(edition, 10) + " of " + base + ": " + err.Error())
+	}
+}
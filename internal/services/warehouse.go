@@ -0,0 +1,60 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"freenet/internal/keys"
+	"freenet/internal/logger"
+)
+
+// ErrNotInWarehouse is returned when removing a file the warehouse does not know.
+var ErrNotInWarehouse = errors.New("file not in the warehouse")
+
+// Warehouse returns a copy of the files of the warehouse, mapping their routing key to their location.
+func (client *ServiceClient) Warehouse() map[string]string {
+	return client.warehouse.ListFiles()
+}
+
+// SetFileLocation records the node holding a file, designated by its node ID or address, or "local".
+// A URI is recorded under its routing key, which is returned. A file can only be local if its content is in the datastore.
+func (client *ServiceClient) SetFileLocation(key, location string) (string, error) {
+	if routingKey, err := keys.RoutingKey(key); err == nil {
+		key = routingKey
+	}
+	if key == "" || location == "" {
+		return key, fmt.Errorf("a file needs a key and a location")
+	}
+	if location == "local" && !client.datastore.Has(key) {
+		return key, fmt.Errorf("the datastore has no content for %s", key)
+	}
+
+	if err := client.warehouse.StoreFile(key, location); err != nil {
+		return key, err
+	}
+	if location != "local" && !isNodeID(location) {
+		client.addPeer("", location)
+	}
+	logger.GlobalLogger.Info("File " + key + " recorded at " + location)
+
+	client.warehouseChanged(key, location)
+	return key, nil
+}
+
+// RemoveFileLocation forgets the location of a file, leaving its content in the datastore if any.
+// It returns the routing key the file was recorded under.
+func (client *ServiceClient) RemoveFileLocation(key string) (string, error) {
+	if routingKey, err := keys.RoutingKey(key); err == nil {
+		key = routingKey
+	}
+	if _, exists := client.warehouse.GetFileLocation(key); !exists {
+		return key, fmt.Errorf("%w: %s", ErrNotInWarehouse, key)
+	}
+
+	if err := client.warehouse.RemoveFile(key); err != nil {
+		return key, err
+	}
+	logger.GlobalLogger.Info("File " + key + " removed from our warehouse")
+
+	client.warehouseChanged(key, "")
+	return key, nil
+}
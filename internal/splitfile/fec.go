@@ -0,0 +1,131 @@
+package splitfile
+
+import (
+	"fmt"
+	"math"
+
+	"freenet/internal/fec"
+)
+
+// SegmentSize is the number of data blocks encoded together. With at most as many check blocks,
+// a segment fits in the 256 shards of the erasure code.
+const SegmentSize = fec.MaxShards / 2
+
+// MaxRedundancy is the highest redundancy ratio, one check block per data block.
+const MaxRedundancy = 1.0
+
+// CheckBlockCount returns the number of check blocks added to a segment of dataBlocks data blocks.
+func CheckBlockCount(dataBlocks int, redundancy float64) int {
+	return int(math.Ceil(float64(dataBlocks) * redundancy))
+}
+
+// Segments returns the number of segments of a file split into blocks blocks.
+func Segments(blocks int) int {
+	return (blocks + SegmentSize - 1) / SegmentSize
+}
+
+// SegmentBounds returns the range [start, end) of the data blocks of a segment.
+func SegmentBounds(segment, blocks int) (int, int) {
+	start := segment * SegmentSize
+	return start, min(start+SegmentSize, blocks)
+}
+
+// EncodeSegment computes the check blocks of the data blocks of a segment. The last block of the file
+// is padded with zeros to the block size.
+func EncodeSegment(blocks [][]byte, blockSize int, redundancy float64) ([][]byte, error) {
+	checkBlocks := CheckBlockCount(len(blocks), redundancy)
+	if checkBlocks == 0 {
+		return nil, nil
+	}
+
+	code, err := fec.New(len(blocks), checkBlocks)
+	if err != nil {
+		return nil, err
+	}
+	padded := make([][]byte, len(blocks))
+	for i, block := range blocks {
+		padded[i] = pad(block, blockSize)
+	}
+	return code.Encode(padded)
+}
+
+// Recover rebuilds the missing data blocks of a segment in place from the blocks and check blocks present,
+// missing blocks being nil. blocks and checkBlocks hold all the blocks of the segment. The manifest must have been
+// checked by Decode, which bounds the block size every missing block is allocated with.
+func (m *Manifest) Recover(segment int, blocks, checkBlocks [][]byte) error {
+	start, end := SegmentBounds(segment, len(m.Blocks))
+	if len(blocks) != end-start || segment >= len(m.CheckBlocks) || len(checkBlocks) != len(m.CheckBlocks[segment]) {
+		return fmt.Errorf("%w: blocks do not match segment %d", ErrInvalidManifest, segment)
+	}
+
+	code, err := fec.New(len(blocks), len(checkBlocks))
+	if err != nil {
+		return err
+	}
+
+	// Every shard of the code is a full block
+	shards := make([][]byte, 0, len(blocks)+len(checkBlocks))
+	for i, block := range blocks {
+		if block != nil {
+			if len(block) != m.blockLength(start+i) {
+				return fmt.Errorf("%w: block %d holds %d bytes instead of %d", ErrInvalidManifest, start+i, len(block), m.blockLength(start+i))
+			}
+			block = pad(block, m.BlockSize)
+		}
+		shards = append(shards, block)
+	}
+	for _, block := range checkBlocks {
+		if block != nil && len(block) != m.BlockSize {
+			return fmt.Errorf("%w: check block holds %d bytes instead of %d", ErrInvalidManifest, len(block), m.BlockSize)
+		}
+		shards = append(shards, block)
+	}
+	if err := code.Reconstruct(shards); err != nil {
+		return err
+	}
+
+	// Remove the padding of the last block of the file
+	for i := range blocks {
+		blocks[i] = shards[i][:m.blockLength(start+i)]
+	}
+	return nil
+}
+
+// checkRedundancy checks that the manifest lists the check blocks of every segment.
+func (m *Manifest) checkRedundancy() error {
+	if m.Redundancy < 0 || m.Redundancy > MaxRedundancy {
+		return fmt.Errorf("%w: redundancy %g out of range", ErrInvalidManifest, m.Redundancy)
+	}
+	if m.Redundancy == 0 {
+		if len(m.CheckBlocks) != 0 {
+			return fmt.Errorf("%w: check blocks without redundancy", ErrInvalidManifest)
+		}
+		return nil
+	}
+
+	if len(m.CheckBlocks) != Segments(len(m.Blocks)) {
+		return fmt.Errorf("%w: %d segments of check blocks for %d segments", ErrInvalidManifest, len(m.CheckBlocks), Segments(len(m.Blocks)))
+	}
+	for segment, checkBlocks := range m.CheckBlocks {
+		start, end := SegmentBounds(segment, len(m.Blocks))
+		if len(checkBlocks) != CheckBlockCount(end-start, m.Redundancy) {
+			return fmt.Errorf("%w: segment %d has %d check blocks instead of %d", ErrInvalidManifest, segment, len(checkBlocks), CheckBlockCount(end-start, m.Redundancy))
+		}
+	}
+	return nil
+}
+
+// blockLength returns the size of a data block, only the last one being shorter than the block size.
+func (m *Manifest) blockLength(index int) int {
+	return min(m.BlockSize, m.Size-index*m.BlockSize)
+}
+
+// pad extends a block with zeros to the block size.
+func pad(block []byte, blockSize int) []byte {
+	if len(block) >= blockSize {
+		return block
+	}
+	padded := make([]byte, blockSize)
+	copy(padded, block)
+	return padded
+}
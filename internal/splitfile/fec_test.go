@@ -0,0 +1,51 @@
+package splitfile
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestRecover(t *testing.T) {
+	data := make([]byte, 10*1024+100)
+	rand.New(rand.NewSource(1)).Read(data)
+	manifest, blocks, checkBlocks := splitFile(t, data, 1024, 0.5)
+
+	// Lose as many data blocks as there are check blocks, including the short last one
+	received := append([][]byte{}, blocks...)
+	for i := range checkBlocks[0] {
+		received[len(received)-1-i] = nil
+	}
+	if err := manifest.Recover(0, received, checkBlocks[0]); err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	joined, err := manifest.Join(received)
+	if err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	if !bytes.Equal(joined, data) {
+		t.Fatal("recovered data differs from the original")
+	}
+}
+
+func TestRecoverRejectsMismatchedBlocks(t *testing.T) {
+	manifest, blocks, checkBlocks := splitFile(t, make([]byte, 4*1024), 1024, 1)
+
+	tests := []struct {
+		name        string
+		blocks      [][]byte
+		checkBlocks [][]byte
+	}{
+		{"oversized data block", [][]byte{nil, make([]byte, 2*1024), blocks[2], blocks[3]}, checkBlocks[0]},
+		{"short check block", [][]byte{nil, blocks[1], blocks[2], blocks[3]}, [][]byte{checkBlocks[0][0][:10], nil, nil, nil}},
+		{"missing blocks", blocks[1:], checkBlocks[0]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := manifest.Recover(0, test.blocks, test.checkBlocks); !errors.Is(err, ErrInvalidManifest) {
+				t.Fatalf("Recover returned %v, expected ErrInvalidManifest", err)
+			}
+		})
+	}
+}
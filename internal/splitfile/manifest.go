@@ -0,0 +1,114 @@
+// Package splitfile splits large files into fixed-size blocks and describes them in a manifest.
+// Check blocks can be added to the data blocks, so that a file can be rebuilt when some of its blocks are lost.
+package splitfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"freenet/internal/keys"
+)
+
+// Magic is the header marking the content of a file as a splitfile manifest.
+const Magic = "FREENET-SPLITFILE\n"
+
+// MaxFileSize is the size of the largest file a manifest may describe.
+const MaxFileSize = 1 << 30
+
+// ErrInvalidManifest is returned when a manifest cannot be decoded or does not describe its blocks.
+var ErrInvalidManifest = errors.New("invalid splitfile manifest")
+
+// Manifest lists the blocks a file was split into, in order, and the check blocks of every segment.
+type Manifest struct {
+	Size        int        `json:"size"`                   // Size in bytes of the whole file
+	BlockSize   int        `json:"block_size"`             // Size in bytes of every block but the last one
+	Blocks      []string   `json:"blocks"`                 // Content hash keys of the blocks
+	Redundancy  float64    `json:"redundancy,omitempty"`   // Number of check blocks added per data block of a segment
+	CheckBlocks [][]string `json:"check_blocks,omitempty"` // Content hash keys of the check blocks of every segment
+}
+
+// Split cuts data into blocks of blockSize bytes, the last one holding the remainder.
+func Split(data []byte, blockSize int) [][]byte {
+	blocks := make([][]byte, 0, (len(data)+blockSize-1)/blockSize)
+	for start := 0; start < len(data); start += blockSize {
+		end := min(start+blockSize, len(data))
+		blocks = append(blocks, data[start:end])
+	}
+	return blocks
+}
+
+// IsManifest tells whether the content of a file is a splitfile manifest.
+func IsManifest(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+// Encode returns the content of the manifest file: the magic header followed by the manifest in JSON.
+func (m *Manifest) Encode() ([]byte, error) {
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(Magic), raw...), nil
+}
+
+// Decode reads the manifest from the content of a manifest file and checks that it is consistent.
+// The manifest comes from the network: blocks larger than maxBlockSize and files larger than MaxFileSize are refused,
+// so that a hostile manifest cannot make the node allocate more than the blocks it actually fetches.
+func Decode(data []byte, maxBlockSize int) (*Manifest, error) {
+	if !IsManifest(data) {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidManifest)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data[len(Magic):], &m); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+	}
+	if m.BlockSize <= 0 || m.BlockSize > maxBlockSize {
+		return nil, fmt.Errorf("%w: block size %d out of range, at most %d bytes", ErrInvalidManifest, m.BlockSize, maxBlockSize)
+	}
+	if m.Size < 0 || m.Size > MaxFileSize {
+		return nil, fmt.Errorf("%w: file size %d out of range, at most %d bytes", ErrInvalidManifest, m.Size, MaxFileSize)
+	}
+	// Both sizes are bounded, the block count cannot overflow
+	if len(m.Blocks) != (m.Size+m.BlockSize-1)/m.BlockSize {
+		return nil, fmt.Errorf("%w: %d blocks of %d bytes cannot hold %d bytes", ErrInvalidManifest, len(m.Blocks), m.BlockSize, m.Size)
+	}
+	if err := m.checkRedundancy(); err != nil {
+		return nil, err
+	}
+
+	// Blocks are only accepted under keys that let their content be verified
+	for _, key := range m.Blocks {
+		if _, err := keys.ParseCHK(key); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+		}
+	}
+	for _, checkBlocks := range m.CheckBlocks {
+		for _, key := range checkBlocks {
+			if _, err := keys.ParseCHK(key); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+			}
+		}
+	}
+	return &m, nil
+}
+
+// Join reassembles the file from its blocks, in the order of the manifest.
+func (m *Manifest) Join(blocks [][]byte) ([]byte, error) {
+	if len(blocks) != len(m.Blocks) {
+		return nil, fmt.Errorf("%w: expected %d blocks, got %d", ErrInvalidManifest, len(m.Blocks), len(blocks))
+	}
+
+	// The buffer grows with the blocks received rather than with the size announced by the manifest
+	var data []byte
+	for i, block := range blocks {
+		expected := m.blockLength(i)
+		if len(block) != expected {
+			return nil, fmt.Errorf("%w: block %d holds %d bytes instead of %d", ErrInvalidManifest, i, len(block), expected)
+		}
+		data = append(data, block...)
+	}
+	return data, nil
+}
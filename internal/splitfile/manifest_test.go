@@ -0,0 +1,138 @@
+package splitfile
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"freenet/internal/keys"
+)
+
+// splitFile splits data as an inserting node does and returns the manifest listing the keys of the encrypted blocks,
+// with the data blocks and the check blocks of every segment.
+func splitFile(t *testing.T, data []byte, blockSize int, redundancy float64) (*Manifest, [][]byte, [][][]byte) {
+	t.Helper()
+	blocks := Split(data, blockSize)
+	manifest := &Manifest{Size: len(data), BlockSize: blockSize, Blocks: make([]string, len(blocks)), Redundancy: redundancy}
+	for i, block := range blocks {
+		manifest.Blocks[i], _ = keys.EncryptCHK(block)
+	}
+	if redundancy == 0 {
+		return manifest, blocks, nil
+	}
+
+	var checkBlocks [][][]byte
+	for segment := 0; segment < Segments(len(blocks)); segment++ {
+		start, end := SegmentBounds(segment, len(blocks))
+		segmentCheckBlocks, err := EncodeSegment(blocks[start:end], blockSize, redundancy)
+		if err != nil {
+			t.Fatalf("EncodeSegment: %v", err)
+		}
+		checkKeys := make([]string, len(segmentCheckBlocks))
+		for i, block := range segmentCheckBlocks {
+			checkKeys[i], _ = keys.EncryptCHK(block)
+		}
+		manifest.CheckBlocks = append(manifest.CheckBlocks, checkKeys)
+		checkBlocks = append(checkBlocks, segmentCheckBlocks)
+	}
+	return manifest, blocks, checkBlocks
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	data := make([]byte, 300*1024+100)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	for _, redundancy := range []float64{0, 0.5, 1} {
+		manifest, _, _ := splitFile(t, data, 1024, redundancy)
+		encoded, err := manifest.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsManifest(encoded) {
+			t.Fatal("encoded manifest does not start with the magic header")
+		}
+
+		decoded, err := Decode(encoded, 1024)
+		if err != nil {
+			t.Fatalf("Decode with redundancy %g: %v", redundancy, err)
+		}
+		if !reflect.DeepEqual(decoded, manifest) {
+			t.Fatalf("decoded %+v, expected %+v", decoded, manifest)
+		}
+	}
+}
+
+func TestDecodeRejectsHostileManifests(t *testing.T) {
+	// encode returns the manifest of a file of three blocks, modified by the test
+	encode := func(modify func(manifest *Manifest)) []byte {
+		manifest, _, _ := splitFile(t, make([]byte, 2500), 1024, 0.5)
+		modify(manifest)
+		encoded, err := manifest.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encoded
+	}
+	valid := encode(func(*Manifest) {})
+
+	tests := []struct {
+		name     string
+		manifest []byte
+	}{
+		{"missing magic", valid[len(Magic):]},
+		{"invalid JSON", []byte(Magic + `{"size":`)},
+		{"negative size", encode(func(manifest *Manifest) { manifest.Size = -1 })},
+		{"size above the limit", encode(func(manifest *Manifest) { manifest.Size = MaxFileSize + 1 })},
+		{"overflowing size", encode(func(manifest *Manifest) { manifest.Size = math.MaxInt })},
+		{"size larger than the blocks", encode(func(manifest *Manifest) { manifest.Size = 5000 })},
+		{"zero block size", encode(func(manifest *Manifest) { manifest.BlockSize = 0 })},
+		{"negative block size", encode(func(manifest *Manifest) { manifest.BlockSize = -1024 })},
+		{"block size above the limit", encode(func(manifest *Manifest) { manifest.BlockSize = 1025 })},
+		{"huge block size", encode(func(manifest *Manifest) { manifest.BlockSize = math.MaxInt })},
+		{"too many blocks", encode(func(manifest *Manifest) { manifest.Blocks = append(manifest.Blocks, manifest.Blocks[0]) })},
+		{"invalid block key", encode(func(manifest *Manifest) { manifest.Blocks[0] = "CHK@nope" })},
+		{"unverifiable block key", encode(func(manifest *Manifest) { manifest.Blocks[0] = "55" })},
+		{"invalid check block key", encode(func(manifest *Manifest) { manifest.CheckBlocks[0][0] = "CHK@nope" })},
+		{"redundancy out of range", encode(func(manifest *Manifest) { manifest.Redundancy = 2 })},
+		{"check blocks without redundancy", encode(func(manifest *Manifest) { manifest.Redundancy = 0 })},
+		{"missing check blocks", encode(func(manifest *Manifest) { manifest.CheckBlocks = nil })},
+		{"missing check block", encode(func(manifest *Manifest) { manifest.CheckBlocks[0] = manifest.CheckBlocks[0][1:] })},
+	}
+
+	if _, err := Decode(valid, 1024); err != nil {
+		t.Fatalf("Decode of the unmodified manifest: %v", err)
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manifest, err := Decode(test.manifest, 1024)
+			if !errors.Is(err, ErrInvalidManifest) {
+				t.Fatalf("Decode returned %+v, %v, expected ErrInvalidManifest", manifest, err)
+			}
+		})
+	}
+}
+
+func TestJoin(t *testing.T) {
+	data := bytes.Repeat([]byte("splitfile"), 300)
+	manifest, blocks, _ := splitFile(t, data, 1024, 0)
+
+	joined, err := manifest.Join(blocks)
+	if err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	if !bytes.Equal(joined, data) {
+		t.Fatal("joined data differs from the original")
+	}
+
+	// A block shorter than announced is refused
+	blocks[0] = blocks[0][:10]
+	if _, err := manifest.Join(blocks); !errors.Is(err, ErrInvalidManifest) {
+		t.Fatalf("Join of a short block returned %v, expected ErrInvalidManifest", err)
+	}
+	if _, err := manifest.Join(blocks[1:]); !errors.Is(err, ErrInvalidManifest) {
+		t.Fatalf("Join of missing blocks returned %v, expected ErrInvalidManifest", err)
+	}
+}
@@ -0,0 +1,100 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"freenet/internal/logger"
+	"freenet/internal/services"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// batchBarWidth is the number of characters of the progress bar of the batch view.
+const batchBarWidth = 20
+
+// startBatchSearch searches for every key listed in a file and shows the progress in the batch view.
+// Only one batch runs at a time, it is cancelled with cancelBatchSearch.
+func (ui *UI) startBatchSearch(ctx context.Context, path string) {
+	if ui.batchCancel != nil {
+		logger.GlobalLogger.Error("A batch search is already running, press C to cancel it")
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		logger.GlobalLogger.Error("Failed to open key list " + path + ": " + err.Error())
+		return
+	}
+	keys, err := services.ReadKeyList(file)
+	file.Close()
+	if err != nil {
+		logger.GlobalLogger.Error("Failed to read key list " + path + ": " + err.Error())
+		return
+	}
+	if len(keys) == 0 {
+		logger.GlobalLogger.Error("Key list " + path + " is empty")
+		return
+	}
+
+	batchCtx, cancel := context.WithCancel(ctx)
+	ui.batchCancel = cancel
+
+	// The outcome is reported in the batch view, do not block the UI while searching
+	go func() {
+		defer cancel()
+
+		var last services.BatchProgress
+		results := services.Client.SearchBatch(batchCtx, keys, func(progress services.BatchProgress) {
+			last = progress
+			text := formatBatchProgress(path, progress, "running")
+			ui.App.QueueUpdateDraw(func() {
+				ui.BatchView.SetText(text)
+			})
+		})
+
+		for _, result := range results {
+			if result.Err != nil {
+				logger.GlobalLogger.Warn("Batch search for " + result.Key + " failed after " + strconv.Itoa(result.Attempts) + " attempts: " + result.Err.Error())
+			}
+		}
+
+		state := "completed"
+		if batchCtx.Err() != nil && last.Done < last.Total {
+			state = "cancelled"
+		}
+		text := formatBatchProgress(path, last, state)
+		ui.App.QueueUpdateDraw(func() {
+			ui.BatchView.SetText(text)
+			ui.batchCancel = nil
+		})
+	}()
+}
+
+// cancelBatchSearch stops the running batch search, if any.
+func (ui *UI) cancelBatchSearch() {
+	if ui.batchCancel == nil {
+		logger.GlobalLogger.Warn("No batch search to cancel")
+		return
+	}
+	logger.GlobalLogger.Info("Cancelling the batch search")
+	ui.batchCancel()
+}
+
+// formatBatchProgress renders the progress of a batch search for the batch view.
+func formatBatchProgress(path string, progress services.BatchProgress, state string) string {
+	filled := 0
+	if progress.Total > 0 {
+		filled = progress.Done * batchBarWidth / progress.Total
+	}
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", batchBarWidth-filled)
+
+	return fmt.Sprintf(
+		"[yellow]Keys: [white]%s (%s)\n[green]%s [white]%d / %d\n[yellow]Found: [white]%d [yellow]Failed: [white]%d [yellow]Retries: [white]%d\n[yellow]Throughput: [white]%.2f keys/s [yellow]Elapsed: [white]%s\n",
+		path, state,
+		bar, progress.Done, progress.Total,
+		progress.Found, progress.Failed, progress.Retries,
+		progress.Throughput(), progress.Elapsed.Round(time.Millisecond),
+	)
+}
@@ -0,0 +1,62 @@
+package ui
+
+import (
+	"time"
+
+	"github.com/rivo/tview"
+)
+
+// footerText is the help text displayed in the footer when no input is shown.
+const footerText = "[yellow]Press [white]S[yellow] for search, [white]D[yellow] for download, [white]A[yellow] to add a file, [white]I[yellow] to insert a file, [white]U[yellow] to subscribe to a USK, [white]B[yellow] for batch search, [white]C[yellow] to cancel it"
+
+// notificationDuration is how long a notification replaces the help text in the footer.
+const notificationDuration = 10 * time.Second
+
+// showPrompt replaces the footer with the input field and calls onSubmit with the text entered.
+func (ui *UI) showPrompt(label string, onSubmit func(text string)) {
+	// Clear the SearchInput field before displaying it
+	ui.SearchInput.SetText("")
+	ui.SearchInput.SetLabel(label)
+	ui.onSubmit = onSubmit
+
+	// Replace footer with the input (set to full width)
+	ui.layout.RemoveItem(ui.FooterView)
+	ui.layout.AddItem(ui.SearchInput, 1, 1, true) // Full width
+
+	ui.App.SetFocus(ui.SearchInput)
+
+	// Set the input as visible
+	ui.SearchVisible = true
+}
+
+// hidePrompt restores the footer in place of the input field.
+func (ui *UI) hidePrompt() {
+	ui.layout.RemoveItem(ui.SearchInput)
+	ui.layout.AddItem(ui.FooterView, 1, 1, false)
+	ui.FooterView.SetText(footerText)
+	ui.App.SetFocus(ui.FooterView)
+
+	// Set the input as no longer visible
+	ui.SearchVisible = false
+	ui.onSubmit = nil
+}
+
+// notify displays a notification in the footer for a while, unless an input is shown.
+// It can be called from any goroutine.
+func (ui *UI) notify(message string) {
+	text := "[green]" + tview.Escape(message)
+	ui.App.QueueUpdateDraw(func() {
+		if !ui.SearchVisible {
+			ui.FooterView.SetText(text)
+		}
+	})
+
+	time.AfterFunc(notificationDuration, func() {
+		ui.App.QueueUpdateDraw(func() {
+			// Leave any newer notification in place
+			if !ui.SearchVisible && ui.FooterView.GetText(false) == text {
+				ui.FooterView.SetText(footerText)
+			}
+		})
+	})
+}
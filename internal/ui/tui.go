@@ -9,6 +9,7 @@ import (
 	"io"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
@@ -20,10 +21,13 @@ type UI struct {
 	LogView       *tview.TextView
 	WarehouseView *tview.Table
 	SettingsView  *tview.TextView
-	FooterView    *tview.TextView   // FooterView to show the footer text
-	SearchInput   *tview.InputField // InputField for search functionality
-	layout        *tview.Flex       // The layout containing all UI components
-	SearchVisible bool              // Track if the SearchInput is visible
+	BatchView     *tview.TextView    // BatchView to show the progress of the batch search
+	FooterView    *tview.TextView    // FooterView to show the footer text
+	SearchInput   *tview.InputField  // InputField for search functionality
+	layout        *tview.Flex        // The layout containing all UI components
+	SearchVisible bool               // Track if the SearchInput is visible
+	onSubmit      func(text string)  // Action run with the text entered in the SearchInput
+	batchCancel   context.CancelFunc // Cancels the running batch search, nil when none is running
 }
 
 // GlobalUI is a global instance of the UI struct.
@@ -37,6 +41,7 @@ func InitUI(context context.Context) error {
 		LogView:       tview.NewTextView(),
 		WarehouseView: tview.NewTable(),
 		SettingsView:  tview.NewTextView(),
+		BatchView:     tview.NewTextView(),
 		FooterView:    tview.NewTextView(),   // Initialize FooterView
 		SearchInput:   tview.NewInputField(), // Initialize SearchInput
 		SearchVisible: false,                 // Initially, the search input is not visible
@@ -70,10 +75,17 @@ func InitUI(context context.Context) error {
 			configs.GlobalConfig.NetworkConfig.Port,
 		)).SetBorder(true).SetTitle("Settings")
 
+	// Set up batchView
+	GlobalUI.BatchView.
+		SetDynamicColors(true).
+		SetWrap(true).
+		SetText("[yellow]Press [white]B[yellow] to search for every key of a file").
+		SetBorder(true).SetTitle("Batch Search")
+
 	// Set up footerView
 	GlobalUI.FooterView.
 		SetDynamicColors(true).
-		SetText("[yellow]Press [white]S[yellow] for search").
+		SetText(footerText).
 		SetTextAlign(tview.AlignCenter).
 		SetBorder(false)
 
@@ -83,23 +95,17 @@ func InitUI(context context.Context) error {
 		SetFieldWidth(0). // Set to 0 to allow full width
 		SetDoneFunc(func(key tcell.Key) {
 			if key == tcell.KeyEnter {
-				searchTerm := GlobalUI.SearchInput.GetText()
+				text := GlobalUI.SearchInput.GetText()
+				onSubmit := GlobalUI.onSubmit
+
+				// Restore the footer text before running the action
+				GlobalUI.hidePrompt()
 
-				if searchTerm != "" {
-					logger.GlobalLogger.Debug(fmt.Sprintf("Searching for: %s", searchTerm))
-					services.Client.Search(context, searchTerm)
+				if text != "" && onSubmit != nil {
+					onSubmit(text)
 				} else {
 					logger.GlobalLogger.Debug("Closing Search Input")
 				}
-
-				// Restore the footer text after search
-				GlobalUI.layout.RemoveItem(GlobalUI.SearchInput)
-				GlobalUI.layout.AddItem(GlobalUI.FooterView, 1, 1, false)
-				GlobalUI.FooterView.SetText("[yellow]Press [white]S[yellow] for search")
-				GlobalUI.App.SetFocus(GlobalUI.FooterView)
-
-				// Set search as no longer visible
-				GlobalUI.SearchVisible = false
 			}
 		})
 
@@ -113,27 +119,94 @@ func InitUI(context context.Context) error {
 					tview.NewFlex().
 						SetDirection(tview.FlexRow).
 						AddItem(GlobalUI.WarehouseView, 0, 2, false).
+						AddItem(GlobalUI.BatchView, 0, 1, false).
 						AddItem(GlobalUI.SettingsView, 0, 1, false),
 					0, 1, true),
 								0, 1, true).
 		AddItem(GlobalUI.FooterView, 1, 1, false) // Add footer at the bottom
 
-	// Capture 'S' key press for search, and only if the SearchInput is not already visible
+	// Capture the action keys, and only if the SearchInput is not already visible
 	GlobalUI.App.SetRoot(GlobalUI.layout, true).SetFocus(GlobalUI.layout).SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		logger.GlobalLogger.Debug("Pressed key: " + strconv.QuoteRune(event.Rune()))
-		if (event.Rune() == 's' || event.Rune() == 'S') && !GlobalUI.SearchVisible {
-			// Clear the SearchInput field before displaying it
-			GlobalUI.SearchInput.SetText("")
-
-			// Replace footer with search input (set to full width)
-			GlobalUI.layout.RemoveItem(GlobalUI.FooterView)
-			GlobalUI.layout.AddItem(GlobalUI.SearchInput, 1, 1, true) // Full width
-
-			GlobalUI.App.SetFocus(GlobalUI.SearchInput)
+		if GlobalUI.SearchVisible {
+			return event
+		}
 
-			// Set search as visible and prevent 'S' from being entered
-			GlobalUI.SearchVisible = true
+		switch event.Rune() {
+		case 's', 'S':
+			GlobalUI.showPrompt("Search: ", func(searchTerm string) {
+				logger.GlobalLogger.Debug(fmt.Sprintf("Searching for: %s", searchTerm))
+				// The outcome is reported in the logs, do not block the UI while searching
+				services.Client.SearchAsync(context, searchTerm)
+			})
 			return nil // Return nil to discard the first 'S'
+		case 'd', 'D':
+			GlobalUI.showPrompt("Download (key output-path): ", func(text string) {
+				fields := strings.Fields(text)
+				if len(fields) != 2 {
+					logger.GlobalLogger.Error("Download expects a key and an output path separated by a space")
+					return
+				}
+				logger.GlobalLogger.Debug(fmt.Sprintf("Downloading %s to %s", fields[0], fields[1]))
+				go func() {
+					if _, err := services.Client.Download(context, fields[0], fields[1]); err != nil {
+						logger.GlobalLogger.Error("Failed to download file " + fields[0] + ": " + err.Error())
+					}
+				}()
+			})
+			return nil // Return nil to discard the first 'D'
+		case 'a', 'A':
+			GlobalUI.showPrompt("Add file (path): ", func(path string) {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					logger.GlobalLogger.Error("Failed to read file " + path + ": " + err.Error())
+					return
+				}
+				key, err := services.Client.AddLocalFile(data)
+				if err != nil {
+					logger.GlobalLogger.Error("Failed to add file " + path + ": " + err.Error())
+					return
+				}
+				// The URI holds the key decrypting the file, it is only known to this node
+				logger.GlobalLogger.Info("File " + path + " added with key " + key)
+			})
+			return nil // Return nil to discard the first 'A'
+		case 'i', 'I':
+			GlobalUI.showPrompt("Insert file (path): ", func(path string) {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					logger.GlobalLogger.Error("Failed to read file " + path + ": " + err.Error())
+					return
+				}
+				// The outcome is reported in the logs, do not block the UI while inserting
+				go func() {
+					result, err := services.Client.Insert(context, "", data)
+					if err != nil {
+						logger.GlobalLogger.Error("Failed to insert file " + path + ": " + err.Error())
+						return
+					}
+					logger.GlobalLogger.Info("File " + path + " inserted with key " + result.Key)
+				}()
+			})
+			return nil // Return nil to discard the first 'I'
+		case 'u', 'U':
+			GlobalUI.showPrompt("Subscribe (USK@.../name/edition): ", func(key string) {
+				err := services.Client.Subscribe(context, key, func(key string, edition int64) {
+					GlobalUI.notify("New edition " + strconv.FormatInt(edition, 10) + " available: " + key)
+				})
+				if err != nil {
+					logger.GlobalLogger.Error("Failed to subscribe to " + key + ": " + err.Error())
+				}
+			})
+			return nil // Return nil to discard the first 'U'
+		case 'b', 'B':
+			GlobalUI.showPrompt("Batch search (path of a key list): ", func(path string) {
+				GlobalUI.startBatchSearch(context, path)
+			})
+			return nil // Return nil to discard the first 'B'
+		case 'c', 'C':
+			GlobalUI.cancelBatchSearch()
+			return nil
 		}
 		return event
 	})
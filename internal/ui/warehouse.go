@@ -1,20 +1,33 @@
 package ui
 
 import (
-	"freenet/internal/models"
+	"context"
+	"freenet/internal/events"
+	"freenet/internal/services"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
 
-// UpdateWarehouseView refreshes the warehouse table by fetching the latest warehouse data.
-func (client *UI) UpdateWarehouseView(warehouse *models.Warehouse) {
+// WatchWarehouse displays the warehouse and refreshes it whenever the node publishes a change, until the context is cancelled.
+func (client *UI) WatchWarehouse(ctx context.Context) {
+	updates := services.Client.Events(ctx, events.WarehouseChanged)
+	client.UpdateWarehouseView(services.Client.Warehouse())
+
+	go func() {
+		for range updates {
+			client.App.QueueUpdateDraw(func() {
+				client.UpdateWarehouseView(services.Client.Warehouse())
+			})
+		}
+	}()
+}
+
+// UpdateWarehouseView refreshes the warehouse table with the files of the warehouse and their location.
+func (client *UI) UpdateWarehouseView(warehouseData map[string]string) {
 	// Clear the current table content
 	GlobalUI.WarehouseView.Clear()
 
-	// Fetch the latest warehouse data
-	warehouseData := warehouse.ListFiles()
-
 	// Set table headers for better readability
 	GlobalUI.WarehouseView.SetCell(0, 0, tview.NewTableCell("File ID").SetSelectable(true).SetTextColor(tcell.ColorYellow))
 	GlobalUI.WarehouseView.SetCell(0, 1, tview.NewTableCell("Location").SetSelectable(false).SetTextColor(tcell.ColorYellow))
@@ -5,9 +5,13 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
+	"time"
 
+	"freenet/internal/admin"
 	"freenet/internal/configs"
+	"freenet/internal/fcp"
 	"freenet/internal/logger"
 	"freenet/internal/services"
 	"freenet/internal/ui"
@@ -17,10 +21,21 @@ import (
 	"go.uber.org/zap"
 )
 
-func main() {
-	// Save the original stderr before it's piped by logger
-	originalStderr := os.Stderr
+// Save the original stdout and stderr before they're piped by logger
+var (
+	originalStdout = os.Stdout
+	originalStderr = os.Stderr
+)
+
+// offlineCommands run without the service client, so that they never create the identity, warehouse, datastore
+// or peer table of a node.
+var offlineCommands = []string{"keygen", "fingerprint", "help", "h"}
+
+// oneShotCommands reach the network once and exit. Unless a port is given, they listen for the replies on a port
+// chosen by the system, so that they can run next to a live node.
+var oneShotCommands = []string{"insert", "search", "subscribe"}
 
+func main() {
 	// Defer a function to recover from any panics and log the error.
 	defer func() {
 		if rerr := recover(); rerr != nil {
@@ -67,6 +82,190 @@ func main() {
 				EnvVars:     []string{"PORT"},
 				Destination: &configs.GlobalConfig.NetworkConfig.Port,
 			},
+			&cli.IntFlag{
+				Name:        "max-frame-size",
+				Value:       1 << 20,
+				Usage:       "maximum size in bytes of a network message",
+				Category:    "NETWORK",
+				EnvVars:     []string{"MAX_FRAME_SIZE"},
+				Destination: &configs.GlobalConfig.NetworkConfig.MaxFrameSize,
+			},
+			&cli.IntFlag{
+				Name:        "max-connections",
+				Value:       32,
+				Usage:       "maximum number of persistent neighbor connections",
+				Category:    "NETWORK",
+				EnvVars:     []string{"MAX_CONNECTIONS"},
+				Destination: &configs.GlobalConfig.NetworkConfig.MaxConnections,
+			},
+			&cli.DurationFlag{
+				Name:        "idle-timeout",
+				Value:       2 * time.Minute,
+				Usage:       "close neighbor connections unused for this long",
+				Category:    "NETWORK",
+				EnvVars:     []string{"IDLE_TIMEOUT"},
+				Destination: &configs.GlobalConfig.NetworkConfig.IdleTimeout,
+			},
+			&cli.IntFlag{
+				Name:        "queue-size",
+				Value:       64,
+				Usage:       "number of messages that can wait on a neighbor connection",
+				Category:    "NETWORK",
+				EnvVars:     []string{"QUEUE_SIZE"},
+				Destination: &configs.GlobalConfig.NetworkConfig.QueueSize,
+			},
+			&cli.IntFlag{
+				Name:        "rate-limit",
+				Value:       200,
+				Usage:       "number of messages per second accepted from a neighbor, 0 for no limit",
+				Category:    "NETWORK",
+				EnvVars:     []string{"RATE_LIMIT"},
+				Destination: &configs.GlobalConfig.NetworkConfig.RateLimit,
+			},
+			&cli.BoolFlag{
+				Name:        "compression",
+				Value:       true,
+				Usage:       "compress large messages on the connections to neighbors supporting it",
+				Category:    "NETWORK",
+				EnvVars:     []string{"COMPRESSION"},
+				Destination: &configs.GlobalConfig.NetworkConfig.Compression,
+			},
+			&cli.BoolFlag{
+				Name:        "tls",
+				Value:       false,
+				Usage:       "connect to neighbors over mutually authenticated TLS with pinned certificates",
+				Category:    "NETWORK",
+				EnvVars:     []string{"TLS"},
+				Destination: &configs.GlobalConfig.NetworkConfig.TLS,
+			},
+			&cli.BoolFlag{
+				Name:        "darknet",
+				Value:       false,
+				Usage:       "only connect to neighbors whose certificate is pinned in the peer table (requires --tls)",
+				Category:    "NETWORK",
+				EnvVars:     []string{"DARKNET"},
+				Destination: &configs.GlobalConfig.NetworkConfig.Darknet,
+			},
+			&cli.StringFlag{
+				Name:        "router",
+				Value:       "ascii",
+				Usage:       "routing strategy: ascii, circular, xor or random",
+				Category:    "ROUTING",
+				EnvVars:     []string{"ROUTER"},
+				Destination: &configs.GlobalConfig.RoutingConfig.Router,
+			},
+			&cli.IntFlag{
+				Name:        "htl",
+				Value:       10,
+				Usage:       "hops-to-live of the requests created by this node",
+				Category:    "ROUTING",
+				EnvVars:     []string{"HTL"},
+				Destination: &configs.GlobalConfig.RoutingConfig.DefaultHTL,
+			},
+			&cli.IntFlag{
+				Name:        "max-htl",
+				Value:       18,
+				Usage:       "maximum hops-to-live accepted for any request",
+				Category:    "ROUTING",
+				EnvVars:     []string{"MAX_HTL"},
+				Destination: &configs.GlobalConfig.RoutingConfig.MaxHTL,
+			},
+			&cli.BoolFlag{
+				Name:        "probabilistic-htl",
+				Value:       false,
+				Usage:       "randomly skip the HTL decrement at max and min HTL",
+				Category:    "ROUTING",
+				EnvVars:     []string{"PROBABILISTIC_HTL"},
+				Destination: &configs.GlobalConfig.RoutingConfig.ProbabilisticHTL,
+			},
+			&cli.DurationFlag{
+				Name:        "hop-timeout",
+				Value:       5 * time.Second,
+				Usage:       "time given to a neighbor to answer a request forwarded with the maximum HTL, scaled down with the HTL left",
+				Category:    "ROUTING",
+				EnvVars:     []string{"HOP_TIMEOUT"},
+				Destination: &configs.GlobalConfig.RoutingConfig.HopTimeout,
+			},
+			&cli.DurationFlag{
+				Name:        "search-timeout",
+				Value:       30 * time.Second,
+				Usage:       "time given to a search before it times out",
+				Category:    "ROUTING",
+				EnvVars:     []string{"SEARCH_TIMEOUT"},
+				Destination: &configs.GlobalConfig.RoutingConfig.SearchTimeout,
+			},
+			&cli.DurationFlag{
+				Name:        "subscribe-interval",
+				Value:       time.Minute,
+				Usage:       "time between two polls for new editions of a subscribed updatable key",
+				Category:    "ROUTING",
+				EnvVars:     []string{"SUBSCRIBE_INTERVAL"},
+				Destination: &configs.GlobalConfig.RoutingConfig.SubscribeInterval,
+			},
+			&cli.IntFlag{
+				Name:        "batch-concurrency",
+				Value:       4,
+				Usage:       "maximum number of searches of a batch running at once",
+				Category:    "BATCH",
+				EnvVars:     []string{"BATCH_CONCURRENCY"},
+				Destination: &configs.GlobalConfig.BatchConfig.Concurrency,
+			},
+			&cli.IntFlag{
+				Name:        "batch-retries",
+				Value:       2,
+				Usage:       "number of times the search of a key of a batch is retried after timing out or running out of hops",
+				Category:    "BATCH",
+				EnvVars:     []string{"BATCH_RETRIES"},
+				Destination: &configs.GlobalConfig.BatchConfig.Retries,
+			},
+			&cli.IntFlag{
+				Name:        "block-size",
+				Value:       32 << 10,
+				Usage:       "size in bytes of the blocks large files are split into",
+				Category:    "SPLITFILE",
+				EnvVars:     []string{"BLOCK_SIZE"},
+				Destination: &configs.GlobalConfig.SplitfileConfig.BlockSize,
+			},
+			&cli.Float64Flag{
+				Name:        "redundancy",
+				Value:       0.5,
+				Usage:       "number of check blocks inserted per data block of a large file, from 0 to 1",
+				Category:    "SPLITFILE",
+				EnvVars:     []string{"REDUNDANCY"},
+				Destination: &configs.GlobalConfig.SplitfileConfig.Redundancy,
+			},
+			&cli.StringFlag{
+				Name:        "admin-address",
+				Value:       "127.0.0.1",
+				Usage:       "address the admin API listens on, it has no authentication so keep it local",
+				Category:    "ADMIN",
+				EnvVars:     []string{"ADMIN_ADDRESS"},
+				Destination: &configs.GlobalConfig.AdminConfig.Address,
+			},
+			&cli.IntFlag{
+				Name:        "admin-port",
+				Value:       0,
+				Usage:       "port of the local admin JSON API, 0 to disable it",
+				Category:    "ADMIN",
+				EnvVars:     []string{"ADMIN_PORT"},
+				Destination: &configs.GlobalConfig.AdminConfig.Port,
+			},
+			&cli.StringFlag{
+				Name:        "fcp-address",
+				Value:       "127.0.0.1",
+				Usage:       "address the FCP server listens on, it has no authentication so keep it local",
+				Category:    "FCP",
+				EnvVars:     []string{"FCP_ADDRESS"},
+				Destination: &configs.GlobalConfig.FCPConfig.Address,
+			},
+			&cli.IntFlag{
+				Name:        "fcp-port",
+				Value:       0,
+				Usage:       "port of the FCP server for Freenet clients, usually 9481, 0 to disable it",
+				Category:    "FCP",
+				EnvVars:     []string{"FCP_PORT"},
+				Destination: &configs.GlobalConfig.FCPConfig.Port,
+			},
 			&cli.StringFlag{
 				Name:        "warehouse",
 				Value:       "warehouse.yaml",
@@ -75,6 +274,38 @@ func main() {
 				EnvVars:     []string{"WAREHOUSE"},
 				Destination: &configs.GlobalConfig.WarehouseConfig.Path,
 			},
+			&cli.StringFlag{
+				Name:        "peers",
+				Value:       "",
+				Usage:       "peer table file path (default: next to the warehouse file)",
+				Category:    "WAREHOUSE",
+				EnvVars:     []string{"PEERS"},
+				Destination: &configs.GlobalConfig.WarehouseConfig.Peers,
+			},
+			&cli.StringFlag{
+				Name:        "datastore",
+				Value:       "",
+				Usage:       "directory holding the content of local files (default: next to the warehouse file)",
+				Category:    "WAREHOUSE",
+				EnvVars:     []string{"DATASTORE"},
+				Destination: &configs.GlobalConfig.WarehouseConfig.Datastore,
+			},
+			&cli.StringFlag{
+				Name:        "identity",
+				Value:       "",
+				Usage:       "node identity key pair file path, generated if missing (default: next to the warehouse file)",
+				Category:    "WAREHOUSE",
+				EnvVars:     []string{"IDENTITY"},
+				Destination: &configs.GlobalConfig.WarehouseConfig.Identity,
+			},
+			&cli.StringFlag{
+				Name:        "certificate",
+				Value:       "",
+				Usage:       "TLS certificate file path, generated if missing (default: next to the warehouse file)",
+				Category:    "WAREHOUSE",
+				EnvVars:     []string{"CERTIFICATE"},
+				Destination: &configs.GlobalConfig.WarehouseConfig.Certificate,
+			},
 			&cli.BoolFlag{
 				Name:        "debug",
 				Value:       false,
@@ -83,9 +314,42 @@ func main() {
 				EnvVars:     []string{"DEBUG"},
 				Destination: &configs.GlobalConfig.LoggerConfig.Debug,
 			},
+			&cli.StringFlag{
+				Name:        "log-file",
+				Value:       "",
+				Usage:       "file the logs are appended to, instead of stdout when headless",
+				Category:    "LOGS",
+				EnvVars:     []string{"LOG_FILE"},
+				Destination: &configs.GlobalConfig.LoggerConfig.File,
+			},
+			&cli.BoolFlag{
+				Name:        "headless",
+				Value:       false,
+				Usage:       "run the node without the interface, logging to stdout or --log-file, until SIGINT or SIGTERM",
+				Category:    "LOGS",
+				EnvVars:     []string{"HEADLESS"},
+				Destination: &configs.GlobalConfig.LoggerConfig.Headless,
+			},
+		},
+		// Commands run once and exit instead of starting the interface.
+		Commands: []*cli.Command{
+			insertCommand(),
+			keygenCommand(),
+			fingerprintCommand(),
+			identityCommand(),
+			subscribeCommand(),
+			searchCommand(),
+			warehouseCommand(),
+			pingCommand(),
 		},
 		// Before function runs before any other actions.
 		Before: func(cCtx *cli.Context) error {
+			// Commands run without the interface, their logs are only kept in the log file so that scripts can read their output.
+			if cCtx.Args().Present() {
+				configs.GlobalConfig.LoggerConfig.Headless = true
+				configs.GlobalConfig.LoggerConfig.Quiet = true
+			}
+
 			// Initialize the global logger.
 			if err := logger.InitGlobalLogger(cCtx.Context, configs.GlobalConfig.LoggerConfig); err != nil {
 				fmt.Fprintf(originalStderr, "Error: failed to create global logger: %v\n", err)
@@ -93,16 +357,31 @@ func main() {
 				return fmt.Errorf("failed to create global logger: %v", err)
 			}
 
-			// Initialize the ui.
-			ui.InitUI(cCtx.Context)
+			// Initialize the ui, unless running headless.
+			if !configs.GlobalConfig.LoggerConfig.Headless {
+				ui.InitUI(cCtx.Context)
+			}
+
+			// Commands that do not use the node must not create its files.
+			if slices.Contains(offlineCommands, cCtx.Args().First()) {
+				return nil
+			}
+			if slices.Contains(oneShotCommands, cCtx.Args().First()) && !cCtx.IsSet("port") {
+				configs.GlobalConfig.NetworkConfig.Port = 0
+			}
 
 			// Initialize the service client.
-			if err := services.InitServiceClient(cCtx.Context, ui.GlobalUI.UpdateWarehouseView); err != nil {
+			if err := services.InitServiceClient(cCtx.Context); err != nil {
 				fmt.Fprintf(originalStderr, "Error: failed to create service client: %v\n", err)
 
 				return fmt.Errorf("failed to create service client: %v", err)
 			}
 
+			// Display the warehouse, kept up to date by the events of the node.
+			if !configs.GlobalConfig.LoggerConfig.Headless {
+				ui.GlobalUI.WatchWarehouse(cCtx.Context)
+			}
+
 			return nil
 		},
 		Action: func(cCtx *cli.Context) error {
@@ -114,6 +393,24 @@ func main() {
 				return fmt.Errorf("failed to start listening: %v", err)
 			}
 
+			// Serve the admin API, if enabled.
+			if err := admin.Start(cCtx.Context, configs.GlobalConfig.AdminConfig); err != nil {
+				fmt.Fprintf(originalStderr, "Error: %v\n", err)
+
+				return err
+			}
+
+			// Serve FCP for Freenet clients, if enabled.
+			if err := fcp.Start(cCtx.Context, configs.GlobalConfig.FCPConfig); err != nil {
+				fmt.Fprintf(originalStderr, "Error: %v\n", err)
+
+				return err
+			}
+
+			if configs.GlobalConfig.LoggerConfig.Headless {
+				return serveHeadless(cCtx)
+			}
+
 			// Start the application with the layout.
 			return ui.GlobalUI.Start()
 		},
@@ -128,3 +425,15 @@ func main() {
 		}
 	}
 }
+
+// serveHeadless runs the node without the interface until the context is cancelled by SIGINT or SIGTERM,
+// then closes its connections so that neighbors see it leave.
+func serveHeadless(cCtx *cli.Context) error {
+	logger.GlobalLogger.Info("Running headless, send SIGINT or SIGTERM to stop")
+	<-cCtx.Context.Done()
+
+	logger.GlobalLogger.Info("Shutting down...")
+	services.Client.Stop()
+	logger.GlobalLogger.Sync()
+	return nil
+}